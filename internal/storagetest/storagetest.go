@@ -0,0 +1,230 @@
+// Package storagetest provides the matrix of storage configurations that the tests and
+// benchmarks of mightymap and its storage package run against, so each of them only picks the
+// configurations it needs instead of repeating their constructors.
+package storagetest
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+// Backend identifies a storage implementation.
+type Backend int
+
+const (
+	Default Backend = iota
+	Swiss
+	SwissEncoded
+	SwissSharded
+	Sharded
+	ReadOptimized
+	Arena
+	SQLite
+	SQLiteInMemory
+	Redis
+	Badger
+)
+
+var backendNames = [...]string{
+	Default:        "Default",
+	Swiss:          "Swiss",
+	SwissEncoded:   "SwissEncoded",
+	SwissSharded:   "SwissSharded",
+	Sharded:        "Sharded",
+	ReadOptimized:  "ReadOptimized",
+	Arena:          "Arena",
+	SQLite:         "SQLite",
+	SQLiteInMemory: "SQLiteInMemory",
+	Redis:          "Redis",
+	Badger:         "Badger",
+}
+
+func (b Backend) String() string {
+	return backendNames[b]
+}
+
+// Config is one storage configuration of the matrix.
+type Config struct {
+	Backend Backend
+	// FIFO enables FIFO ordering
+	FIFO bool
+	// LockedRange disables snapshot ranges, so the default and Swiss storages hold their lock
+	// during Range
+	LockedRange bool
+}
+
+// String names the configuration for subtests, e.g. RedisFIFO.
+func (c Config) String() string {
+	name := c.Backend.String()
+	if c.FIFO {
+		name += "FIFO"
+	}
+	if c.LockedRange {
+		name += "Locked"
+	}
+	return name
+}
+
+// All returns every configuration of the matrix: each backend, and each backend with FIFO
+// ordering that supports it.
+func All() []Config {
+	configs := make([]Config, 0, len(backendNames)+6)
+	for b := range backendNames {
+		configs = append(configs, Config{Backend: Backend(b)})
+	}
+	for _, b := range []Backend{Default, Swiss, SwissSharded, SQLite, Redis, Badger} {
+		configs = append(configs, Config{Backend: b, FIFO: true})
+	}
+	return configs
+}
+
+// FIFO returns the configurations of All with FIFO ordering.
+func FIFO() []Config {
+	var configs []Config
+	for _, c := range All() {
+		if c.FIFO {
+			configs = append(configs, c)
+		}
+	}
+	return configs
+}
+
+// Storages returns constructors for the configurations whose storages support all of caps,
+// keyed by configuration name. Each constructor returns a new, empty storage.
+func Storages[K comparable, V any](t testing.TB, configs []Config, caps ...storage.Capability) map[string]func(t testing.TB) storage.IMightyMapStorage[K, V] {
+	t.Helper()
+	storages := make(map[string]func(t testing.TB) storage.IMightyMapStorage[K, V], len(configs))
+	for _, c := range configs {
+		if !supports[K, V](t, c, caps) {
+			continue
+		}
+		storages[c.String()] = func(t testing.TB) storage.IMightyMapStorage[K, V] {
+			return Open[K, V](t, c, "")
+		}
+	}
+	return storages
+}
+
+func supports[K comparable, V any](t testing.TB, c Config, caps []storage.Capability) bool {
+	if len(caps) == 0 {
+		return true
+	}
+	store := Open[K, V](t, c, "supports")
+	defer store.Close(t.Context())
+	for _, capability := range caps {
+		if !storage.Supports(store, capability) {
+			return false
+		}
+	}
+	return true
+}
+
+// Open returns a new storage of configuration c. SQLite and Redis storages opened within the same
+// test share the database file or the server, each name in its own table or key prefix.
+func Open[K comparable, V any](t testing.TB, c Config, name string) storage.IMightyMapStorage[K, V] {
+	t.Helper()
+	if name == "" {
+		name = "mightymap"
+	}
+	ordering := storage.Unordered
+	if c.FIFO {
+		ordering = storage.FIFO
+	}
+
+	switch c.Backend {
+	case Default:
+		return storage.NewMightyMapDefaultStorage[K, V](
+			storage.WithDefaultStorageOrdering(ordering),
+			storage.WithDefaultStorageSnapshotRange(!c.LockedRange),
+		)
+	case Swiss:
+		return storage.NewMightyMapSwissStorage[K, V](
+			storage.WithSwissOrdering(ordering),
+			storage.WithSwissSnapshotRange(!c.LockedRange),
+		)
+	case SwissEncoded:
+		return storage.NewMightyMapSwissStorage[K, V](
+			storage.WithSwissOrdering(ordering),
+			storage.WithSwissSnapshotRange(!c.LockedRange),
+			storage.WithSwissEncoding(true),
+		)
+	case SwissSharded:
+		return storage.NewMightyMapSwissStorage[K, V](
+			storage.WithSwissOrdering(ordering),
+			storage.WithSwissSnapshotRange(!c.LockedRange),
+			storage.WithSwissShards(4),
+		)
+	case Sharded:
+		return storage.NewMightyMapShardedStorage[K, V]()
+	case ReadOptimized:
+		return storage.NewMightyMapReadOptimizedStorage[K, V]()
+	case Arena:
+		return storage.NewMightyMapArenaStorage[K, V]()
+	case SQLite:
+		return storage.NewMightyMapSQLiteStorage[K, V](
+			storage.WithSQLiteDBPath(filepath.Join(envOf(t).tempDir(t), "mightymap.db")),
+			storage.WithSQLiteTableName(name),
+			storage.WithSQLiteOrdering(ordering),
+		)
+	case SQLiteInMemory:
+		return storage.NewMightyMapSQLiteStorage[K, V](
+			storage.WithSQLiteInMemory(),
+			storage.WithSQLiteOrdering(ordering),
+		)
+	case Redis:
+		return storage.NewMightyMapRedisStorage[K, V](
+			storage.WithRedisAddr(envOf(t).redisAddr(t)),
+			storage.WithRedisPrefix(name+":"),
+			storage.WithRedisOrdering(ordering),
+			storage.WithRedisScheduling(true),
+			storage.WithRedisPriorities(true),
+			storage.WithRedisStoreNotifications(true),
+		)
+	case Badger:
+		return storage.NewMightyMapBadgerStorage[K, V](
+			storage.WithMemoryStorage(true),
+			storage.WithOrdering(ordering),
+		)
+	}
+	panic(fmt.Sprintf("storagetest: unknown backend %d", c.Backend))
+}
+
+// env holds the temporary directory and the Redis server of one test, created on first use.
+type env struct {
+	mu    sync.Mutex
+	dir   string
+	redis *miniredis.Miniredis
+}
+
+var envs sync.Map // testing.TB -> *env
+
+func envOf(t testing.TB) *env {
+	e, loaded := envs.LoadOrStore(t, &env{})
+	if !loaded {
+		t.Cleanup(func() { envs.Delete(t) })
+	}
+	return e.(*env)
+}
+
+func (e *env) tempDir(t testing.TB) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dir == "" {
+		e.dir = t.TempDir()
+	}
+	return e.dir
+}
+
+func (e *env) redisAddr(t testing.TB) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.redis == nil {
+		e.redis = miniredis.RunT(t)
+	}
+	return e.redis.Addr()
+}
@@ -29,6 +29,7 @@ package mightymap
 
 import (
 	"context"
+	"time"
 
 	"github.com/thisisdevelopment/mightymap/storage"
 )
@@ -98,13 +99,38 @@ func (m *Map[K, V]) Delete(ctx context.Context, keys ...K) {
 }
 
 // Range iterates over the map's key-value pairs in an unspecified order,
+// or in insertion order if the storage is configured with storage.FIFO ordering,
 // calling the provided function for each pair.
 // If the function returns false, iteration stops.
+// The default and Swiss storages iterate over a copy of the keys, so f may write to the map.
+// With storage.WithDefaultStorageSnapshotRange or storage.WithSwissSnapshotRange disabled they
+// hold their read lock while calling f instead, and writes to the map from f panic with
+// storage.ErrReentrantWrite.
 func (m *Map[K, V]) Range(ctx context.Context, f func(key K, value V) bool) {
 	m.storage.Range(ctx, f)
 }
 
-// Keys returns all keys in the map in an unspecified order.
+// ParallelRange calls f for every key-value pair using up to workers concurrent goroutines.
+// f must be safe for concurrent use and pairs are visited in no particular order.
+// If f returns false, the whole iteration stops; calls already in progress complete.
+// The storage reads ahead only a few batches per worker, so a slow f slows down the scan
+// instead of buffering the map in memory.
+// Storages without parallel scanning fall back to a sequential Range calling f from a single goroutine.
+// Returns the context error if ctx is cancelled, or the first error reported by the storage.
+func (m *Map[K, V]) ParallelRange(ctx context.Context, workers int, f func(key K, value V) bool) error {
+	if p, ok := capability[storage.IMightyMapParallelRangeStorage[K, V]](m.storage, storage.CapabilityParallelRange); ok {
+		if err := p.ParallelRange(ctx, workers, f); err != storage.ErrNotSupported {
+			return err
+		}
+	}
+	m.storage.Range(ctx, func(key K, value V) bool {
+		return ctx.Err() == nil && f(key, value)
+	})
+	return ctx.Err()
+}
+
+// Keys returns all keys in the map in an unspecified order, or in insertion order
+// with storage.FIFO ordering.
 func (m *Map[K, V]) Keys(ctx context.Context) []K {
 	return m.storage.Keys(ctx)
 }
@@ -120,14 +146,115 @@ func (m *Map[K, V]) Pop(ctx context.Context, key K) (value V, ok bool) {
 	return value, true
 }
 
-// Next returns the next key-value pair from the map.
-// The iteration order is not specified.
+// Next returns and removes the next key-value pair from the map.
+// The iteration order is not specified, unless the storage is configured with
+// storage.FIFO ordering, in which case the oldest entry is returned, e.g.
+//
+//	m := mightymap.New[string, Job](true, storage.NewMightyMapDefaultStorage[string, Job](
+//		storage.WithDefaultStorageOrdering(storage.FIFO),
+//	))
+//
+// Entries stored with StoreWithPriority are returned before all others, see StoreWithPriority.
 // Returns zero values and false when there are no more items.
 func (m *Map[K, V]) Next(ctx context.Context) (value V, key K, ok bool) {
 	key, value, ok = m.storage.Next(ctx)
 	return
 }
 
+// nextWaitPollInterval is how often NextWait calls Next on storages that can not wait for entries.
+const nextWaitPollInterval = 100 * time.Millisecond
+
+// NextWait returns and removes the next key-value pair like Next, blocking while the map is empty.
+// Concurrent callers each receive a different pair. Storages that can not wait for entries,
+// such as custom implementations, are polled with Next instead.
+// Returns the context error if ctx is cancelled before a pair is available.
+func (m *Map[K, V]) NextWait(ctx context.Context) (value V, key K, err error) {
+	if w, ok := capability[storage.IMightyMapNextWaitStorage[K, V]](m.storage, storage.CapabilityNextWait); ok {
+		key, value, err = w.NextWait(ctx)
+		if err != storage.ErrNotSupported {
+			return value, key, err
+		}
+	}
+	ticker := time.NewTicker(nextWaitPollInterval)
+	defer ticker.Stop()
+	for {
+		if key, value, ok := m.storage.Next(ctx); ok {
+			return value, key, nil
+		}
+		select {
+		case <-ctx.Done():
+			return value, key, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// StoreWithPriority stores a value with a priority. Next returns entries with a priority before
+// all others, the highest priority first and entries with equal priority in the order they were
+// stored. Storing the key again with Store keeps its priority. If the map doesn't allow
+// overwrites, nothing is stored when the key already holds a value.
+// Returns storage.ErrNotSupported if the storage has no priorities.
+func (m *Map[K, V]) StoreWithPriority(ctx context.Context, key K, value V, priority int) error {
+	s, ok := capability[storage.IMightyMapPriorityStorage[K, V]](m.storage, storage.CapabilityPriority)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	if !m.allowOverwrite {
+		if _, exists := m.storage.Load(ctx, key); exists {
+			return nil
+		}
+	}
+	return s.StoreWithPriority(ctx, key, value, priority)
+}
+
+// SetPriority changes the priority of a key, or gives it one, without rewriting its value.
+// The key keeps its place among the keys with the same priority.
+// Returns false if the key is not present, and storage.ErrNotSupported if the storage has
+// no priorities.
+func (m *Map[K, V]) SetPriority(ctx context.Context, key K, priority int) (bool, error) {
+	s, ok := capability[storage.IMightyMapPriorityStorage[K, V]](m.storage, storage.CapabilityPriority)
+	if !ok {
+		return false, storage.ErrNotSupported
+	}
+	return s.SetPriority(ctx, key, priority)
+}
+
+// StoreAt stores a value that stays invisible until visibleAt: Load, Range, Keys, Len and Next
+// ignore it until then. An existing value for the key is hidden as well. Expiration, if
+// configured, starts at visibleAt. If the map doesn't allow overwrites, nothing is stored
+// when the key already holds a visible value.
+// Returns storage.ErrNotSupported if the storage can not schedule entries.
+func (m *Map[K, V]) StoreAt(ctx context.Context, key K, value V, visibleAt time.Time) error {
+	s, ok := capability[storage.IMightyMapScheduleStorage[K, V]](m.storage, storage.CapabilitySchedule)
+	if !ok {
+		return storage.ErrNotSupported
+	}
+	if !m.allowOverwrite {
+		if _, exists := m.storage.Load(ctx, key); exists {
+			return nil
+		}
+	}
+	return s.StoreAt(ctx, key, value, visibleAt)
+}
+
+// StoreAfter stores a value that becomes visible after delay, see StoreAt.
+func (m *Map[K, V]) StoreAfter(ctx context.Context, key K, value V, delay time.Duration) error {
+	return m.StoreAt(ctx, key, value, time.Now().Add(delay))
+}
+
+// NextDue returns and removes the scheduled key-value pair with the earliest due time, once that
+// time has passed. Unlike Next it returns entries in due-time order and only those stored with
+// StoreAt or StoreAfter. Returns false if no scheduled entry is due or the storage can not
+// schedule entries.
+func (m *Map[K, V]) NextDue(ctx context.Context) (value V, key K, ok bool) {
+	s, supported := capability[storage.IMightyMapScheduleStorage[K, V]](m.storage, storage.CapabilitySchedule)
+	if !supported {
+		return value, key, false
+	}
+	key, value, ok = s.NextDue(ctx)
+	return value, key, ok
+}
+
 // Len returns the number of key-value pairs in the map.
 func (m *Map[K, V]) Len(ctx context.Context) int {
 	return m.storage.Len(ctx)
@@ -138,6 +265,106 @@ func (m *Map[K, V]) Clear(ctx context.Context) {
 	m.storage.Clear(ctx)
 }
 
+// Touch restarts the expiration of one or more keys without reading their values,
+// as if they had just been written. Missing keys are ignored.
+// Returns storage.ErrNotSupported if the storage has no notion of expiration.
+func (m *Map[K, V]) Touch(ctx context.Context, keys ...K) error {
+	if t, ok := capability[storage.IMightyMapTouchStorage[K]](m.storage, storage.CapabilityTouch); ok {
+		return t.Touch(ctx, keys...)
+	}
+	return storage.ErrNotSupported
+}
+
+// Stats returns the hit, miss and eviction counters of a storage used as a cache, such as the
+// bounded storage.
+// Returns storage.ErrNotSupported if the storage keeps no counters.
+func (m *Map[K, V]) Stats(ctx context.Context) (storage.CacheStats, error) {
+	if s, ok := capability[storage.IMightyMapStatsStorage](m.storage, storage.CapabilityStats); ok {
+		return s.Stats(ctx)
+	}
+	return storage.CacheStats{}, storage.ErrNotSupported
+}
+
+// MemoryUsage returns the memory held by the index and the entry buffers of a storage that
+// manages its own memory, such as the arena storage.
+// Returns storage.ErrNotSupported if the storage can not report it.
+func (m *Map[K, V]) MemoryUsage(ctx context.Context) (storage.MemoryUsage, error) {
+	if s, ok := capability[storage.IMightyMapMemoryStorage](m.storage, storage.CapabilityMemoryUsage); ok {
+		return s.MemoryUsage(ctx)
+	}
+	return storage.MemoryUsage{}, storage.ErrNotSupported
+}
+
+// LoadVersions returns up to limit historical versions of key, newest first, including deletions.
+// A limit of zero or less returns all versions the storage retains.
+// Returns storage.ErrNotSupported if the storage keeps no history.
+func (m *Map[K, V]) LoadVersions(ctx context.Context, key K, limit int) ([]storage.Versioned[V], error) {
+	if vs, ok := capability[storage.IMightyMapVersionedStorage[K, V]](m.storage, storage.CapabilityVersions); ok {
+		return vs.LoadVersions(ctx, key, limit)
+	}
+	return nil, storage.ErrNotSupported
+}
+
+// LoadAt returns the value key had at version, as returned by CurrentVersion or LoadVersions.
+// Returns storage.ErrNotSupported if the storage keeps no history.
+func (m *Map[K, V]) LoadAt(ctx context.Context, key K, version uint64) (value V, ok bool, err error) {
+	if vs, supported := capability[storage.IMightyMapVersionedStorage[K, V]](m.storage, storage.CapabilityVersions); supported {
+		return vs.LoadAt(ctx, key, version)
+	}
+	return value, false, storage.ErrNotSupported
+}
+
+// CurrentVersion returns the version of the latest write, to be used with LoadAt or SnapshotAt.
+// Returns storage.ErrNotSupported if the storage keeps no history.
+func (m *Map[K, V]) CurrentVersion(ctx context.Context) (uint64, error) {
+	if vs, ok := capability[storage.IMightyMapVersionedStorage[K, V]](m.storage, storage.CapabilityVersions); ok {
+		return vs.CurrentVersion(ctx)
+	}
+	return 0, storage.ErrNotSupported
+}
+
+// SnapshotAt returns a read-only view of the map at version. Writes made after that version,
+// including those made while the snapshot is in use, are not visible through it.
+// Returns storage.ErrNotSupported if the storage keeps no history.
+func (m *Map[K, V]) SnapshotAt(ctx context.Context, version uint64) (*Snapshot[K, V], error) {
+	vs, ok := capability[storage.IMightyMapVersionedStorage[K, V]](m.storage, storage.CapabilityVersions)
+	if !ok {
+		return nil, storage.ErrNotSupported
+	}
+	snapshot, err := vs.SnapshotAt(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot[K, V]{snapshot: snapshot}, nil
+}
+
+// Query returns the entries matching where, a condition in the query language of the storage
+// with placeholders for args, without scanning the whole map with Range. For the SQLite storage
+// this is an SQL condition, see storage.SQLiteJSONPath. Entries are returned in no particular order.
+// Returns storage.ErrNotSupported if the storage can not filter entries natively.
+func (m *Map[K, V]) Query(ctx context.Context, where string, args ...any) ([]storage.Entry[K, V], error) {
+	if q, ok := capability[storage.IMightyMapQueryStorage[K, V]](m.storage, storage.CapabilityQuery); ok {
+		return q.Query(ctx, where, args...)
+	}
+	return nil, storage.ErrNotSupported
+}
+
+// Supports reports whether the storage of the map supports the optional operations of c, so
+// that the corresponding methods do not return storage.ErrNotSupported or, for NextDue, false.
+func (m *Map[K, V]) Supports(c storage.Capability) bool {
+	return storage.Supports(m.storage, c)
+}
+
+// capability returns s as the interface I of capability c if it supports it.
+func capability[I any, K comparable, V any](s storage.IMightyMapStorage[K, V], c storage.Capability) (I, bool) {
+	if !storage.Supports(s, c) {
+		var zero I
+		return zero, false
+	}
+	i, ok := s.(I)
+	return i, ok
+}
+
 // Close closes the map
 func (m *Map[K, V]) Close(ctx context.Context) error {
 	return m.storage.Close(ctx)
@@ -2,9 +2,12 @@ package mightymap_test
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/thisisdevelopment/mightymap"
+	"github.com/thisisdevelopment/mightymap/storage"
 )
 
 func TestMightyMap_DefaultStorage(t *testing.T) {
@@ -126,3 +129,305 @@ func TestMightyMap_DefaultStorage(t *testing.T) {
 		}
 	})
 }
+
+func TestMightyMap_Touch(t *testing.T) {
+	ctx := context.Background()
+	cm := mightymap.New[int, string](true, storage.NewMightyMapDefaultStorage[int, string](
+		storage.WithDefaultStorageExpire(200*time.Millisecond),
+	))
+	defer cm.Close(ctx)
+
+	cm.Store(ctx, 1, "one")
+	cm.Store(ctx, 2, "two")
+	time.Sleep(120 * time.Millisecond)
+	if err := cm.Touch(ctx, 1); err != nil {
+		t.Fatalf("Touch() error: %v", err)
+	}
+	time.Sleep(120 * time.Millisecond)
+
+	if !cm.Has(ctx, 1) {
+		t.Errorf("Expected touched key 1 to be alive")
+	}
+	if cm.Has(ctx, 2) {
+		t.Errorf("Expected key 2 to have expired")
+	}
+}
+
+func TestMightyMap_ParallelRange(t *testing.T) {
+	ctx := context.Background()
+	stores := map[string]storage.IMightyMapStorage[int, int]{
+		// no parallel scan, falls back to Range
+		"Default": storage.NewMightyMapDefaultStorage[int, int](),
+		"Badger":  storage.NewMightyMapBadgerStorage[int, int](storage.WithMemoryStorage(true)),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			cm := mightymap.New[int, int](true, store)
+			defer cm.Close(ctx)
+
+			for i := 0; i < 1000; i++ {
+				cm.Store(ctx, i, i)
+			}
+
+			var sum atomic.Int64
+			if err := cm.ParallelRange(ctx, 4, func(_, value int) bool {
+				sum.Add(int64(value))
+				return true
+			}); err != nil {
+				t.Fatalf("ParallelRange() error: %v", err)
+			}
+			if want := int64(999 * 1000 / 2); sum.Load() != want {
+				t.Errorf("sum of visited values = %d; want %d", sum.Load(), want)
+			}
+
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+			if err := cm.ParallelRange(cancelled, 4, func(int, int) bool { return true }); err != context.Canceled {
+				t.Errorf("ParallelRange() with cancelled context error = %v; want context.Canceled", err)
+			}
+		})
+	}
+}
+
+func TestMightyMap_SnapshotAt(t *testing.T) {
+	ctx := context.Background()
+	cm := mightymap.New[string, int](true, storage.NewMightyMapBadgerStorage[string, int](
+		storage.WithMemoryStorage(true),
+		storage.WithNumVersionsToKeep(5),
+	))
+	defer cm.Close(ctx)
+
+	cm.Store(ctx, "a", 1)
+	version, err := cm.CurrentVersion(ctx)
+	if err != nil {
+		t.Fatalf("CurrentVersion() error: %v", err)
+	}
+	cm.Store(ctx, "a", 2)
+	cm.Store(ctx, "b", 3)
+
+	snapshot, err := cm.SnapshotAt(ctx, version)
+	if err != nil {
+		t.Fatalf("SnapshotAt() error: %v", err)
+	}
+	if v, ok := snapshot.Load(ctx, "a"); !ok || v != 1 {
+		t.Errorf("snapshot Load(a) = %d, %v; want 1, true", v, ok)
+	}
+	if snapshot.Has(ctx, "b") || snapshot.Len(ctx) != 1 {
+		t.Error("snapshot sees a key written after it was taken")
+	}
+	if v, ok, err := cm.LoadAt(ctx, "a", version); err != nil || !ok || v != 1 {
+		t.Errorf("LoadAt() = %d, %v, %v; want 1, true, nil", v, ok, err)
+	}
+
+	versions, err := cm.LoadVersions(ctx, "a", 0)
+	if err != nil {
+		t.Fatalf("LoadVersions() error: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Value != 2 || versions[1].Value != 1 {
+		t.Errorf("LoadVersions() = %+v; want values 2 and 1", versions)
+	}
+
+	plain := mightymap.New[string, int](true)
+	defer plain.Close(ctx)
+	if _, err := plain.SnapshotAt(ctx, 0); err != storage.ErrNotSupported {
+		t.Errorf("SnapshotAt() on default storage error = %v; want ErrNotSupported", err)
+	}
+}
+
+func TestMightyMap_Query(t *testing.T) {
+	type order struct {
+		Status string `json:"status"`
+		Total  int    `json:"total"`
+	}
+	ctx := context.Background()
+	cm := mightymap.New[int, order](true, storage.NewMightyMapSQLiteStorage[int, order](
+		storage.WithSQLiteDBPath(t.TempDir()+"/orders.db"),
+		storage.WithSQLiteJSONValues(true),
+		storage.WithSQLiteJSONIndex("$.status"),
+	))
+	defer cm.Close(ctx)
+
+	cm.Store(ctx, 1, order{Status: "open", Total: 10})
+	cm.Store(ctx, 2, order{Status: "paid", Total: 20})
+	cm.Store(ctx, 3, order{Status: "open", Total: 30})
+
+	entries, err := cm.Query(ctx, storage.SQLiteJSONPath("$.status")+" = ?", "open")
+	if err != nil {
+		t.Fatalf("Query() error: %v", err)
+	}
+	total := 0
+	for _, e := range entries {
+		total += e.Value.Total
+	}
+	if len(entries) != 2 || total != 40 {
+		t.Errorf("Query() = %+v; want orders 1 and 3", entries)
+	}
+
+	plain := mightymap.New[int, order](true)
+	defer plain.Close(ctx)
+	if _, err := plain.Query(ctx, "1"); err != storage.ErrNotSupported {
+		t.Errorf("Query() on default storage error = %v; want ErrNotSupported", err)
+	}
+}
+
+func TestMightyMap_NextWait(t *testing.T) {
+	ctx := context.Background()
+	cm := mightymap.New[int, string](true)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cm.Store(ctx, 1, "one")
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	value, key, err := cm.NextWait(waitCtx)
+	if err != nil || key != 1 || value != "one" {
+		t.Fatalf("NextWait() = %v, %v, %v; want one, 1, nil", value, key, err)
+	}
+
+	cancelCtx, cancelWait := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelWait()
+	if _, _, err := cm.NextWait(cancelCtx); err != context.DeadlineExceeded {
+		t.Errorf("NextWait() on an empty map = %v; want context.DeadlineExceeded", err)
+	}
+}
+
+func TestMightyMap_StoreAfter(t *testing.T) {
+	ctx := context.Background()
+	cm := mightymap.New[int, string](true)
+
+	if err := cm.StoreAfter(ctx, 1, "one", 50*time.Millisecond); err != nil {
+		t.Fatalf("StoreAfter() error: %v", err)
+	}
+	if cm.Has(ctx, 1) {
+		t.Error("Has() = true before the entry is due")
+	}
+	if _, _, ok := cm.NextDue(ctx); ok {
+		t.Error("NextDue() = true before the entry is due")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	value, key, ok := cm.NextDue(ctx)
+	if !ok || key != 1 || value != "one" {
+		t.Fatalf("NextDue() = %v, %v, %v; want one, 1, true", value, key, ok)
+	}
+	if cm.Len(ctx) != 0 {
+		t.Errorf("Len() = %d after NextDue; want 0", cm.Len(ctx))
+	}
+}
+
+func TestMightyMap_StoreWithPriority(t *testing.T) {
+	ctx := context.Background()
+	cm := mightymap.New[int, string](true)
+
+	cm.Store(ctx, 1, "plain")
+	if err := cm.StoreWithPriority(ctx, 2, "low", 1); err != nil {
+		t.Fatalf("StoreWithPriority() error: %v", err)
+	}
+	if err := cm.StoreWithPriority(ctx, 3, "high", 5); err != nil {
+		t.Fatalf("StoreWithPriority() error: %v", err)
+	}
+	if ok, err := cm.SetPriority(ctx, 2, 10); !ok || err != nil {
+		t.Fatalf("SetPriority() = %v, %v; want true, nil", ok, err)
+	}
+
+	for _, want := range []string{"low", "high", "plain"} {
+		if value, _, ok := cm.Next(ctx); !ok || value != want {
+			t.Fatalf("Next() = %v, %v; want %v", value, ok, want)
+		}
+	}
+}
+
+func TestMightyMap_Stats(t *testing.T) {
+	ctx := context.Background()
+	if _, err := mightymap.New[int, string](true).Stats(ctx); err != storage.ErrNotSupported {
+		t.Errorf("Stats() of the default storage error = %v; want ErrNotSupported", err)
+	}
+
+	store := storage.NewMightyMapBoundedStorage[int, string](storage.WithBoundedStorageMaxEntries(2))
+	cm := mightymap.New[int, string](true, store)
+	cm.Store(ctx, 1, "one")
+	cm.Store(ctx, 2, "two")
+	cm.Store(ctx, 3, "three")
+	cm.Load(ctx, 1)
+	cm.Load(ctx, 3)
+
+	stats, err := cm.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats() error: %v", err)
+	}
+	if want := (storage.CacheStats{Hits: 1, Misses: 1, Evictions: 1}); stats != want {
+		t.Errorf("Stats() = %+v; want %+v", stats, want)
+	}
+}
+
+func TestMightyMap_MemoryUsage(t *testing.T) {
+	ctx := context.Background()
+	if _, err := mightymap.New[int, string](true).MemoryUsage(ctx); err != storage.ErrNotSupported {
+		t.Errorf("MemoryUsage() of the default storage error = %v; want ErrNotSupported", err)
+	}
+
+	cm := mightymap.New[int, string](true, storage.NewMightyMapArenaStorage[int, string]())
+	cm.Store(ctx, 1, "one")
+	usage, err := cm.MemoryUsage(ctx)
+	if err != nil {
+		t.Fatalf("MemoryUsage() error: %v", err)
+	}
+	if usage.Live == 0 || usage.Allocated < usage.Live || usage.Index == 0 {
+		t.Errorf("MemoryUsage() = %+v; want index and live bytes", usage)
+	}
+}
+
+func TestMightyMap_Supports(t *testing.T) {
+	ctx := context.Background()
+	cm := mightymap.New[int, string](true, storage.NewMightyMapSwissStorage[int, string](
+		storage.WithSwissShards(2),
+		storage.WithSwissEncoding(true),
+	))
+	if cm.Supports(storage.CapabilityPriority) {
+		t.Error("Supports(CapabilityPriority) = true for a sharded Swiss storage")
+	}
+	if err := cm.StoreWithPriority(ctx, 1, "one", 1); err != storage.ErrNotSupported {
+		t.Errorf("StoreWithPriority() error = %v; want ErrNotSupported", err)
+	}
+	if cm.Supports(storage.CapabilitySchedule) {
+		t.Error("Supports(CapabilitySchedule) = true for a sharded Swiss storage")
+	}
+	if err := cm.StoreAt(ctx, 1, "one", time.Now()); err != storage.ErrNotSupported {
+		t.Errorf("StoreAt() error = %v; want ErrNotSupported", err)
+	}
+	if !cm.Supports(storage.CapabilityTouch) {
+		t.Error("Supports(CapabilityTouch) = false for a Swiss storage")
+	}
+	typed := mightymap.New[int, string](true, storage.NewMightyMapSwissStorage[int, string](
+		storage.WithSwissShards(2),
+		storage.WithSwissOrdering(storage.FIFO),
+	))
+	for _, c := range []storage.Capability{storage.CapabilityPriority, storage.CapabilitySchedule} {
+		if typed.Supports(c) {
+			t.Errorf("Supports(%d) = true for a sharded Swiss storage with FIFO ordering", c)
+		}
+	}
+	if !mightymap.New[int, string](true).Supports(storage.CapabilityPriority) {
+		t.Error("Supports(CapabilityPriority) = false for the default storage")
+	}
+}
+
+func TestMightyMap_RangeWrites(t *testing.T) {
+	ctx := context.Background()
+	cm := mightymap.New[int, int](true)
+	for i := 0; i < 10; i++ {
+		cm.Store(ctx, i, i%2)
+	}
+	cm.Range(ctx, func(key, value int) bool {
+		if value == 0 {
+			cm.Delete(ctx, key)
+		}
+		return true
+	})
+	if n := cm.Len(ctx); n != 5 {
+		t.Errorf("Len() = %d; want 5", n)
+	}
+}
@@ -0,0 +1,344 @@
+package mightymap
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+// ErrQueueInFlight is returned by Queue.Enqueue for a key whose previous item is reserved and
+// has not been acknowledged yet.
+var ErrQueueInFlight = errors.New("mightymap: queue item with this key is in flight")
+
+// defaultQueueRescanInterval is how often a Queue reloads its deadline index from the in-flight
+// storage, to pick up reservations made by queues in other processes.
+const defaultQueueRescanInterval = time.Minute
+
+// QueueEntry is an item of a Queue that has been reserved at least once, as kept in the
+// in-flight and dead-letter storages.
+type QueueEntry[V any] struct {
+	// Value is the enqueued value
+	Value V
+	// Attempts is the number of times the item has been reserved
+	Attempts int
+	// Deadline is the moment the item becomes visible again unless it is acknowledged
+	Deadline time.Time
+	// Receipt identifies the current reservation; zero once the item was released with Nack
+	Receipt uint64
+}
+
+// Delivery is an item handed out by Queue.Reserve.
+type Delivery[K comparable, V any] struct {
+	Key   K
+	Value V
+	// Attempts is the number of times the item has been reserved, including this one
+	Attempts int
+	// Receipt identifies this reservation. Ack and Nack only act while it is the current one,
+	// so a worker whose reservation expired can not acknowledge the redelivered item.
+	Receipt uint64
+}
+
+// QueueOption configures a Queue.
+type QueueOption[K comparable, V any] func(*Queue[K, V])
+
+// WithQueueMaxAttempts sets how many times an item is reserved before it is dead-lettered
+// instead of being delivered again. Zero or less redelivers items forever.
+// **Default value**: `0`
+func WithQueueMaxAttempts[K comparable, V any](attempts int) QueueOption[K, V] {
+	return func(q *Queue[K, V]) {
+		q.maxAttempts = attempts
+	}
+}
+
+// WithQueueDeadLetter sets the storage items are moved to once they have been reserved
+// the maximum number of times. Without it such items are dropped.
+// **Default value**: `nil`
+func WithQueueDeadLetter[K comparable, V any](deadLetter storage.IMightyMapStorage[K, QueueEntry[V]]) QueueOption[K, V] {
+	return func(q *Queue[K, V]) {
+		q.deadLetter = deadLetter
+	}
+}
+
+// WithQueueRescanInterval sets how often the queue reloads the deadlines of the in-flight items
+// from the in-flight storage. Between reloads it only tracks its own reservations, so expired
+// reservations of queues in other processes sharing the storages are redelivered up to this
+// much later.
+// **Default value**: `1 minute`
+func WithQueueRescanInterval[K comparable, V any](interval time.Duration) QueueOption[K, V] {
+	return func(q *Queue[K, V]) {
+		q.rescanInterval = interval
+	}
+}
+
+// Queue is a work queue with at-least-once delivery on top of two storages: pending holds
+// the enqueued items and inflight the reserved ones with their deadline and number of attempts.
+// A reserved item stays in the in-flight storage until it is acknowledged with Ack; if it is
+// not acknowledged before its visibility timeout passes, for example because the worker
+// crashed, it is delivered again. With persistent storages the in-flight items, and
+// therefore their redelivery, survive restarts. An item is taken from the pending storage with
+// its atomic Next and recorded as in flight right after, so a crash between these two writes
+// loses that one item.
+//
+// Items are taken from the pending storage in the order of its Next, so use FIFO ordering for a
+// first-in first-out queue, or StoreWithPriority on the pending storage to prioritize items. The deadlines of the in-flight items are kept in a
+// min-heap, so Reserve only looks at the earliest one.
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+type Queue[K comparable, V any] struct {
+	pending        storage.IMightyMapStorage[K, V]
+	inflight       storage.IMightyMapStorage[K, QueueEntry[V]]
+	deadLetter     storage.IMightyMapStorage[K, QueueEntry[V]]
+	maxAttempts    int
+	rescanInterval time.Duration
+	// mu serializes changes to the in-flight storage and the deadline index within this process
+	mu        sync.Mutex
+	deadlines queueDeadlines[K]
+	scannedAt time.Time
+}
+
+// NewQueue creates a queue on the given storages. Nil storages are replaced by the default
+// in-memory storage. Several queues, also in other processes, may share the same storages. Each
+// pending item is then reserved by only one of them, as Next removes it atomically, but an item
+// whose visibility timeout passed can occasionally be redelivered by two of them at once, which
+// the at-least-once contract allows for.
+func NewQueue[K comparable, V any](pending storage.IMightyMapStorage[K, V], inflight storage.IMightyMapStorage[K, QueueEntry[V]], opts ...QueueOption[K, V]) *Queue[K, V] {
+	if pending == nil {
+		pending = storage.NewMightyMapDefaultStorage[K, V]()
+	}
+	if inflight == nil {
+		inflight = storage.NewMightyMapDefaultStorage[K, QueueEntry[V]]()
+	}
+	q := &Queue[K, V]{
+		pending:        pending,
+		inflight:       inflight,
+		rescanInterval: defaultQueueRescanInterval,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+// Enqueue adds an item to the queue. An item with the same key that is still pending is replaced.
+// Returns ErrQueueInFlight if an item with the same key is reserved and not acknowledged yet;
+// enqueue it again once it is.
+func (q *Queue[K, V]) Enqueue(ctx context.Context, key K, value V) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.inflight.Load(ctx, key); ok {
+		return ErrQueueInFlight
+	}
+	q.pending.Store(ctx, key, value)
+	return nil
+}
+
+// Reserve hands out the next item and hides it from other consumers for visibilityTimeout.
+// Items whose visibility timeout has passed are delivered again before new items are taken.
+// The item must be acknowledged with Ack once it is processed, or released with Nack.
+// Returns false when no item is available.
+func (q *Queue[K, V]) Reserve(ctx context.Context, visibilityTimeout time.Duration) (Delivery[K, V], bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	if q.scannedAt.IsZero() || now.Sub(q.scannedAt) >= q.rescanInterval {
+		q.rescan(ctx)
+		q.scannedAt = now
+	}
+	deadline := now.Add(visibilityTimeout)
+
+	for {
+		key, ok := q.deadlines.expired(now)
+		if !ok {
+			break
+		}
+		entry, ok := q.inflight.Load(ctx, key)
+		if !ok {
+			// acknowledged by a queue in another process
+			q.deadlines.remove(key)
+			continue
+		}
+		if entry.Deadline.After(now) {
+			// reserved again by a queue in another process
+			q.deadlines.set(key, entry.Deadline)
+			continue
+		}
+		if q.maxAttempts > 0 && entry.Attempts >= q.maxAttempts {
+			if q.deadLetter != nil {
+				q.deadLetter.Store(ctx, key, entry)
+			}
+			q.inflight.Delete(ctx, key)
+			q.deadlines.remove(key)
+			continue
+		}
+		return q.reserve(ctx, key, entry, deadline), true
+	}
+
+	key, value, ok := q.pending.Next(ctx)
+	if !ok {
+		return Delivery[K, V]{}, false
+	}
+	return q.reserve(ctx, key, QueueEntry[V]{Value: value}, deadline), true
+}
+
+// rescan reloads the deadline index from the in-flight storage.
+func (q *Queue[K, V]) rescan(ctx context.Context) {
+	q.deadlines.reset()
+	entries := map[K]time.Time{}
+	q.inflight.Range(ctx, func(k K, e QueueEntry[V]) bool {
+		entries[k] = e.Deadline
+		return true
+	})
+	for k, deadline := range entries {
+		q.deadlines.set(k, deadline)
+	}
+}
+
+// reserve records entry as in flight until deadline under a new receipt.
+func (q *Queue[K, V]) reserve(ctx context.Context, key K, entry QueueEntry[V], deadline time.Time) Delivery[K, V] {
+	entry.Attempts++
+	entry.Deadline = deadline
+	entry.Receipt = rand.Uint64() | 1
+	q.inflight.Store(ctx, key, entry)
+	q.deadlines.set(key, deadline)
+	return Delivery[K, V]{Key: key, Value: entry.Value, Attempts: entry.Attempts, Receipt: entry.Receipt}
+}
+
+// Ack removes a reserved item from the queue for good.
+// Returns false if d is no longer the current reservation of the item, because its visibility
+// timeout passed and the item was reserved again, or it was acknowledged or released already.
+func (q *Queue[K, V]) Ack(ctx context.Context, d Delivery[K, V]) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.inflight.Load(ctx, d.Key)
+	if !ok || entry.Receipt != d.Receipt {
+		return false
+	}
+	q.inflight.Delete(ctx, d.Key)
+	q.deadlines.remove(d.Key)
+	return true
+}
+
+// Nack releases a reserved item, making it available to Reserve again right away.
+// The attempt still counts towards the maximum number of attempts.
+// Returns false if d is no longer the current reservation of the item, see Ack.
+func (q *Queue[K, V]) Nack(ctx context.Context, d Delivery[K, V]) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.inflight.Load(ctx, d.Key)
+	if !ok || entry.Receipt != d.Receipt {
+		return false
+	}
+	entry.Deadline = time.Time{}
+	entry.Receipt = 0
+	q.inflight.Store(ctx, d.Key, entry)
+	q.deadlines.set(d.Key, entry.Deadline)
+	return true
+}
+
+// Len returns the number of pending items, not counting the items in flight.
+func (q *Queue[K, V]) Len(ctx context.Context) int {
+	return q.pending.Len(ctx)
+}
+
+// InFlight returns the number of reserved items that have not been acknowledged yet.
+func (q *Queue[K, V]) InFlight(ctx context.Context) int {
+	return q.inflight.Len(ctx)
+}
+
+// Close closes the storages of the queue.
+func (q *Queue[K, V]) Close(ctx context.Context) error {
+	err := q.pending.Close(ctx)
+	if e := q.inflight.Close(ctx); err == nil {
+		err = e
+	}
+	if q.deadLetter != nil {
+		if e := q.deadLetter.Close(ctx); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// queueDeadlines indexes the deadlines of the in-flight items in a min-heap, like the due index
+// of the in-memory storages. It must be used with the queue lock held.
+type queueDeadlines[K comparable] struct {
+	items map[K]*queueDeadline[K]
+	heap  queueDeadlineHeap[K]
+}
+
+type queueDeadline[K comparable] struct {
+	key      K
+	deadline time.Time
+	index    int
+}
+
+// queueDeadlineHeap implements heap.Interface ordered by deadline.
+type queueDeadlineHeap[K comparable] []*queueDeadline[K]
+
+func (h queueDeadlineHeap[K]) Len() int           { return len(h) }
+func (h queueDeadlineHeap[K]) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+func (h queueDeadlineHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *queueDeadlineHeap[K]) Push(x any) {
+	item := x.(*queueDeadline[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *queueDeadlineHeap[K]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// set records the deadline of key.
+func (d *queueDeadlines[K]) set(key K, deadline time.Time) {
+	if item, ok := d.items[key]; ok {
+		item.deadline = deadline
+		heap.Fix(&d.heap, item.index)
+		return
+	}
+	if d.items == nil {
+		d.items = make(map[K]*queueDeadline[K])
+	}
+	item := &queueDeadline[K]{key: key, deadline: deadline}
+	heap.Push(&d.heap, item)
+	d.items[key] = item
+}
+
+// remove forgets key.
+func (d *queueDeadlines[K]) remove(key K) {
+	if item, ok := d.items[key]; ok {
+		heap.Remove(&d.heap, item.index)
+		delete(d.items, key)
+	}
+}
+
+// reset forgets all keys.
+func (d *queueDeadlines[K]) reset() {
+	d.items = nil
+	d.heap = nil
+}
+
+// expired returns the key with the earliest deadline if it is not after now, without removing it.
+func (d *queueDeadlines[K]) expired(now time.Time) (key K, ok bool) {
+	if len(d.heap) == 0 || d.heap[0].deadline.After(now) {
+		return key, false
+	}
+	return d.heap[0].key, true
+}
@@ -0,0 +1,186 @@
+package mightymap_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thisisdevelopment/mightymap"
+	"github.com/thisisdevelopment/mightymap/internal/storagetest"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+type job struct {
+	Name string
+}
+
+func queueTestCases() map[string]func(t *testing.T) *mightymap.Queue[string, job] {
+	cases := make(map[string]func(t *testing.T) *mightymap.Queue[string, job])
+	for _, b := range []storagetest.Backend{storagetest.Default, storagetest.SQLite, storagetest.Redis, storagetest.Badger} {
+		cases[b.String()] = func(t *testing.T) *mightymap.Queue[string, job] {
+			return mightymap.NewQueue[string, job](
+				storagetest.Open[string, job](t, storagetest.Config{Backend: b, FIFO: true}, "pending"),
+				storagetest.Open[string, mightymap.QueueEntry[job]](t, storagetest.Config{Backend: b}, "inflight"),
+				mightymap.WithQueueMaxAttempts[string, job](2),
+				mightymap.WithQueueDeadLetter[string, job](storagetest.Open[string, mightymap.QueueEntry[job]](t, storagetest.Config{Backend: b}, "dead")),
+			)
+		}
+	}
+	return cases
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newQueue := range queueTestCases() {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue(t)
+			defer q.Close(ctx)
+
+			q.Enqueue(ctx, "a", job{Name: "first"})
+			q.Enqueue(ctx, "b", job{Name: "second"})
+
+			d, ok := q.Reserve(ctx, time.Hour)
+			if !ok || d.Key != "a" || d.Value.Name != "first" || d.Attempts != 1 {
+				t.Fatalf("Reserve() = %+v, %v; want a, first, 1 attempt", d, ok)
+			}
+			if n := q.InFlight(ctx); n != 1 {
+				t.Errorf("InFlight() = %d; want 1", n)
+			}
+			if err := q.Enqueue(ctx, "a", job{Name: "again"}); err != mightymap.ErrQueueInFlight {
+				t.Errorf("Enqueue() of an item in flight error = %v; want ErrQueueInFlight", err)
+			}
+			if !q.Ack(ctx, d) {
+				t.Error("Ack() = false; want true")
+			}
+			if q.Ack(ctx, d) {
+				t.Error("Ack() of an acknowledged item = true; want false")
+			}
+
+			// a released item comes back before new ones, a reservation that times out as well
+			d, _ = q.Reserve(ctx, time.Hour)
+			if !q.Nack(ctx, d) {
+				t.Fatal("Nack() = false; want true")
+			}
+			if q.Nack(ctx, mightymap.Delivery[string, job]{Key: "missing"}) {
+				t.Error("Nack() of an unknown key = true; want false")
+			}
+			expired, ok := q.Reserve(ctx, 0)
+			if !ok || expired.Key != "b" || expired.Attempts != 2 {
+				t.Fatalf("Reserve() after Nack = %+v, %v; want b, 2 attempts", expired, ok)
+			}
+			if q.Ack(ctx, d) {
+				t.Error("Ack() with the receipt of an earlier reservation = true; want false")
+			}
+
+			// the third attempt exceeds the maximum, so the item is dead-lettered
+			if d, ok := q.Reserve(ctx, time.Hour); ok {
+				t.Fatalf("Reserve() = %+v; want the item to be dead-lettered", d)
+			}
+			if n := q.InFlight(ctx); n != 0 {
+				t.Errorf("InFlight() = %d; want 0", n)
+			}
+			if n := q.Len(ctx); n != 0 {
+				t.Errorf("Len() = %d; want 0", n)
+			}
+		})
+	}
+}
+
+func TestQueueRedeliveryAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.db")
+	open := func() *mightymap.Queue[string, job] {
+		return mightymap.NewQueue[string, job](
+			storage.NewMightyMapSQLiteStorage[string, job](storage.WithSQLiteDBPath(path)),
+			storage.NewMightyMapSQLiteStorage[string, mightymap.QueueEntry[job]](storage.WithSQLiteDBPath(path), storage.WithSQLiteTableName("inflight")),
+		)
+	}
+
+	q := open()
+	if err := q.Enqueue(ctx, "a", job{Name: "crashes"}); err != nil {
+		t.Fatalf("Enqueue() error: %v", err)
+	}
+	if _, ok := q.Reserve(ctx, 50*time.Millisecond); !ok {
+		t.Fatal("Reserve() = false; want true")
+	}
+	// the worker never acknowledges the item
+	q.Close(ctx)
+
+	q = open()
+	defer q.Close(ctx)
+	if d, ok := q.Reserve(ctx, time.Hour); ok {
+		t.Fatalf("Reserve() = %+v before the visibility timeout; want nothing", d)
+	}
+	time.Sleep(100 * time.Millisecond)
+	d, ok := q.Reserve(ctx, time.Hour)
+	if !ok || d.Key != "a" || d.Value.Name != "crashes" || d.Attempts != 2 {
+		t.Fatalf("Reserve() = %+v, %v; want a redelivered on its second attempt", d, ok)
+	}
+}
+
+func TestQueueConcurrentConsumers(t *testing.T) {
+	ctx := context.Background()
+	const items, consumers = 200, 8
+
+	for _, b := range []storagetest.Backend{storagetest.Default, storagetest.SQLite, storagetest.Redis, storagetest.Badger} {
+		t.Run(b.String(), func(t *testing.T) {
+			pending := storagetest.Open[string, job](t, storagetest.Config{Backend: b, FIFO: true}, "pending")
+			inflight := storagetest.Open[string, mightymap.QueueEntry[job]](t, storagetest.Config{Backend: b}, "inflight")
+			defer pending.Close(ctx)
+			defer inflight.Close(ctx)
+			for i := 0; i < items; i++ {
+				pending.Store(ctx, fmt.Sprint(i), job{Name: fmt.Sprint(i)})
+			}
+
+			// every consumer has a queue of its own on the shared storages, like separate processes
+			var mu sync.Mutex
+			delivered := map[string]int{}
+			var wg sync.WaitGroup
+			for c := 0; c < consumers; c++ {
+				q := mightymap.NewQueue[string, job](pending, inflight)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						d, ok := q.Reserve(ctx, time.Hour)
+						if !ok {
+							return
+						}
+						mu.Lock()
+						delivered[d.Key]++
+						mu.Unlock()
+						q.Ack(ctx, d)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if len(delivered) != items {
+				t.Errorf("delivered %d items; want %d", len(delivered), items)
+			}
+			for key, n := range delivered {
+				if n != 1 {
+					t.Errorf("item %s delivered %d times; want once", key, n)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueReservePriority(t *testing.T) {
+	ctx := context.Background()
+	pending := storage.NewMightyMapDefaultStorage[string, job]()
+	q := mightymap.NewQueue[string, job](pending, nil)
+	defer q.Close(ctx)
+
+	q.Enqueue(ctx, "low", job{Name: "low"})
+	pending.(storage.IMightyMapPriorityStorage[string, job]).StoreWithPriority(ctx, "high", job{Name: "high"}, 10)
+	d, ok := q.Reserve(ctx, time.Hour)
+	if !ok || d.Key != "high" {
+		t.Fatalf("Reserve() = %+v, %v; want the item with the higher priority", d, ok)
+	}
+}
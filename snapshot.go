@@ -0,0 +1,49 @@
+package mightymap
+
+import (
+	"context"
+
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+// Snapshot is a read-only view of a Map at a fixed version, created by Map.SnapshotAt.
+// All reads through a snapshot are consistent with each other while writers continue.
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+type Snapshot[K comparable, V any] struct {
+	snapshot storage.IMightyMapSnapshot[K, V]
+}
+
+// Version returns the version the snapshot reads at.
+func (s *Snapshot[K, V]) Version() uint64 {
+	return s.snapshot.Version()
+}
+
+// Load retrieves the value key had at the snapshot version.
+// Returns the value and true if found, zero value and false if not present.
+func (s *Snapshot[K, V]) Load(ctx context.Context, key K) (value V, ok bool) {
+	return s.snapshot.Load(ctx, key)
+}
+
+// Has checks if a key existed at the snapshot version.
+func (s *Snapshot[K, V]) Has(ctx context.Context, key K) (ok bool) {
+	_, ok = s.snapshot.Load(ctx, key)
+	return
+}
+
+// Range iterates over the key-value pairs present at the snapshot version.
+// If the function returns false, iteration stops.
+func (s *Snapshot[K, V]) Range(ctx context.Context, f func(key K, value V) bool) {
+	s.snapshot.Range(ctx, f)
+}
+
+// Keys returns the keys present at the snapshot version.
+func (s *Snapshot[K, V]) Keys(ctx context.Context) []K {
+	return s.snapshot.Keys(ctx)
+}
+
+// Len returns the number of key-value pairs present at the snapshot version.
+func (s *Snapshot[K, V]) Len(ctx context.Context) int {
+	return s.snapshot.Len(ctx)
+}
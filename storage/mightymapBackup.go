@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoBackup is returned by RestoreBackups when the directory holds no full backup.
+var ErrNoBackup = errors.New("mightymap: no full backup found")
+
+const (
+	// backupFilePrefix and the extensions below name the files written by BackupScheduler:
+	// mightymap-<version>.full or mightymap-<version>.incr, where version is the zero padded
+	// value returned by Backup. Versions only grow, so sorting by name sorts chronologically.
+	backupFilePrefix = "mightymap-"
+	backupFullExt    = ".full"
+	backupIncrExt    = ".incr"
+	backupDirPerm    = 0o755
+
+	defaultBackupInterval  = time.Hour
+	defaultBackupFullEvery = 24
+	defaultBackupRetention = 7
+)
+
+type backupOpts struct {
+	interval  time.Duration
+	fullEvery int
+	retention int
+	onError   func(error)
+}
+
+// OptionFuncBackup is a function type that modifies the configuration of a BackupScheduler.
+type OptionFuncBackup func(*backupOpts)
+
+// WithBackupInterval sets the time between scheduled backups.
+// A zero interval disables the schedule; backups are then only taken by BackupNow.
+// **Default value**: `1h`
+func WithBackupInterval(interval time.Duration) OptionFuncBackup {
+	return func(o *backupOpts) {
+		o.interval = interval
+	}
+}
+
+// WithBackupFullEvery makes every n-th backup a full backup; the others are incremental
+// backups on top of the previous one. A full backup and its incrementals form a chain.
+// **Default value**: `24`
+func WithBackupFullEvery(n int) OptionFuncBackup {
+	return func(o *backupOpts) {
+		o.fullEvery = max(n, 1)
+	}
+}
+
+// WithBackupRetention sets the number of chains kept in the backup directory. Older chains are
+// removed after a new full backup has been written.
+// **Default value**: `7`
+func WithBackupRetention(chains int) OptionFuncBackup {
+	return func(o *backupOpts) {
+		o.retention = max(chains, 1)
+	}
+}
+
+// WithBackupErrorHandler sets the function called when a scheduled backup fails.
+// **Default value**: errors are logged
+func WithBackupErrorHandler(f func(error)) OptionFuncBackup {
+	return func(o *backupOpts) {
+		o.onError = f
+	}
+}
+
+// BackupScheduler periodically writes backups of a storage into a directory, rotating between
+// full and incremental backups and removing chains beyond the retention.
+//
+// The scheduler resumes from the files already in the directory, so restarting the application
+// continues the current chain.
+type BackupScheduler struct {
+	store IMightyMapBackupStorage
+	dir   string
+	opts  *backupOpts
+
+	mu           sync.Mutex
+	since        uint64
+	incrementals int
+	hasFull      bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBackupScheduler creates the backup directory if needed and starts taking backups of store
+// every interval. Stop must be called to end the schedule.
+//
+// Parameters:
+//   - store: the storage to back up, e.g. a Badger storage
+//   - dir: the directory receiving the backup files
+//   - optfuncs: optional configuration functions
+//
+// Returns an error if the directory can not be created or read.
+func NewBackupScheduler(store IMightyMapBackupStorage, dir string, optfuncs ...OptionFuncBackup) (*BackupScheduler, error) {
+	opts := &backupOpts{
+		interval:  defaultBackupInterval,
+		fullEvery: defaultBackupFullEvery,
+		retention: defaultBackupRetention,
+		onError: func(err error) {
+			log.Printf("mightymap: scheduled backup failed: %v", err)
+		},
+	}
+	for _, optfunc := range optfuncs {
+		optfunc(opts)
+	}
+
+	if err := os.MkdirAll(dir, backupDirPerm); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	files, err := listBackups(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BackupScheduler{
+		store: store,
+		dir:   dir,
+		opts:  opts,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	for _, f := range files {
+		s.since = f.version
+		if f.full {
+			s.hasFull = true
+			s.incrementals = 0
+		} else {
+			s.incrementals++
+		}
+	}
+
+	go s.run()
+	return s, nil
+}
+
+func (s *BackupScheduler) run() {
+	defer close(s.done)
+	if s.opts.interval <= 0 {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(s.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if _, err := s.BackupNow(context.Background()); err != nil {
+				s.opts.onError(err)
+			}
+		}
+	}
+}
+
+// BackupNow takes the next backup of the schedule immediately and returns the path of the file
+// written. An incremental backup without any changes writes no file and returns an empty path.
+func (s *BackupScheduler) BackupNow(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	full := !s.hasFull || s.incrementals+1 >= s.opts.fullEvery
+	since := s.since
+	if full {
+		since = 0
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".mightymap-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	w := bufio.NewWriter(tmp)
+	next, err := s.store.Backup(ctx, w, since)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	// Backup returns since unchanged when it wrote nothing, and one after the newest version
+	// written otherwise
+	if !full && next == since {
+		return "", nil
+	}
+
+	ext := backupIncrExt
+	if full {
+		ext = backupFullExt
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", backupFilePrefix, next, ext))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	s.since = next
+	if full {
+		s.hasFull = true
+		s.incrementals = 0
+		if err := s.prune(); err != nil {
+			return path, err
+		}
+	} else {
+		s.incrementals++
+	}
+	return path, nil
+}
+
+// prune removes all chains older than the retention.
+func (s *BackupScheduler) prune() error {
+	files, err := listBackups(s.dir)
+	if err != nil {
+		return err
+	}
+	var fulls []int
+	for i, f := range files {
+		if f.full {
+			fulls = append(fulls, i)
+		}
+	}
+	if len(fulls) <= s.opts.retention {
+		return nil
+	}
+	for _, f := range files[:fulls[len(fulls)-s.opts.retention]] {
+		if err := os.Remove(f.path); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+	}
+	return nil
+}
+
+// Stop ends the schedule and waits for a running backup to finish.
+func (s *BackupScheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// RestoreBackups restores the newest chain in dir, i.e. the newest full backup followed by the
+// incremental backups taken after it, into store.
+// Returns ErrNoBackup if dir holds no full backup.
+func RestoreBackups(ctx context.Context, store IMightyMapBackupStorage, dir string) error {
+	files, err := listBackups(dir)
+	if err != nil {
+		return err
+	}
+	start := -1
+	for i, f := range files {
+		if f.full {
+			start = i
+		}
+	}
+	if start < 0 {
+		return ErrNoBackup
+	}
+
+	for _, f := range files[start:] {
+		if err := restoreBackupFile(ctx, store, f.path); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", filepath.Base(f.path), err)
+		}
+	}
+	return nil
+}
+
+func restoreBackupFile(ctx context.Context, store IMightyMapBackupStorage, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return store.Restore(ctx, bufio.NewReader(f))
+}
+
+type backupFile struct {
+	path    string
+	version uint64
+	full    bool
+}
+
+// listBackups returns the backup files in dir sorted from oldest to newest.
+func listBackups(dir string) ([]backupFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var files []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupFilePrefix) {
+			continue
+		}
+		ext := filepath.Ext(name)
+		if ext != backupFullExt && ext != backupIncrExt {
+			continue
+		}
+		version, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, backupFilePrefix), ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, backupFile{
+			path:    filepath.Join(dir, name),
+			version: version,
+			full:    ext == backupFullExt,
+		})
+	}
+
+	// a full backup taken without changes since the previous backup has the same version
+	// as that backup and starts the newer chain
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].version != files[j].version {
+			return files[i].version < files[j].version
+		}
+		return !files[i].full && files[j].full
+	})
+	return files, nil
+}
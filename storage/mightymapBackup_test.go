@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBackupTestStore() IMightyMapStorage[string, int] {
+	return NewMightyMapBadgerStorage[string, int](WithMemoryStorage(true))
+}
+
+func TestBadgerBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	src := newBackupTestStore()
+	defer src.Close(ctx)
+	backuper := src.(IMightyMapBackupStorage)
+
+	src.Store(ctx, "a", 1)
+	src.Store(ctx, "b", 2)
+	src.Store(ctx, "c", 3)
+
+	var full bytes.Buffer
+	since, err := backuper.Backup(ctx, &full, 0)
+	if err != nil {
+		t.Fatalf("Backup() error: %v", err)
+	}
+
+	src.Store(ctx, "b", 20)
+	src.Store(ctx, "d", 4)
+	src.Delete(ctx, "a")
+
+	var incr bytes.Buffer
+	next, err := backuper.Backup(ctx, &incr, since)
+	if err != nil {
+		t.Fatalf("incremental Backup() error: %v", err)
+	}
+	if next <= since {
+		t.Errorf("incremental Backup() returned version %d; want more than %d", next, since)
+	}
+
+	// without changes an incremental backup writes nothing, not the last entry again
+	var empty bytes.Buffer
+	if v, err := backuper.Backup(ctx, &empty, next); err != nil || v != next || empty.Len() != 0 {
+		t.Errorf("Backup() without changes = %d, %v and %d bytes; want %d, nil and 0 bytes", v, err, empty.Len(), next)
+	}
+
+	// restoring into a non-empty store must recount the keys
+	dst := newBackupTestStore()
+	defer dst.Close(ctx)
+	dst.Store(ctx, "existing", 99)
+
+	restorer := dst.(IMightyMapBackupStorage)
+	if err := restorer.Restore(ctx, &full); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if n := dst.Len(ctx); n != 4 {
+		t.Errorf("Len() after full restore = %d; want 4", n)
+	}
+	if err := restorer.Restore(ctx, &incr); err != nil {
+		t.Fatalf("incremental Restore() error: %v", err)
+	}
+
+	want := map[string]int{"b": 20, "c": 3, "d": 4, "existing": 99}
+	for k, v := range want {
+		if got, ok := dst.Load(ctx, k); !ok || got != v {
+			t.Errorf("Load(%q) = %v, %v; want %v, true", k, got, ok, v)
+		}
+	}
+	if _, ok := dst.Load(ctx, "a"); ok {
+		t.Error("key deleted before the incremental backup was restored")
+	}
+	if n := dst.Len(ctx); n != len(want) {
+		t.Errorf("Len() after restore = %d; want %d", n, len(want))
+	}
+}
+
+func TestBadgerBackupCancelled(t *testing.T) {
+	ctx := context.Background()
+	store := newBackupTestStore()
+	defer store.Close(ctx)
+	store.Store(ctx, "a", 1)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	var buf bytes.Buffer
+	if _, err := store.(IMightyMapBackupStorage).Backup(cancelled, &buf, 0); err == nil {
+		t.Error("Backup() with a cancelled context succeeded")
+	}
+}
+
+func TestBackupNotSupported(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapSQLiteStorage[string, int]()
+	defer store.Close(ctx)
+
+	var buf bytes.Buffer
+	if _, err := store.(IMightyMapBackupStorage).Backup(ctx, &buf, 0); err != ErrNotSupported {
+		t.Errorf("Backup() error = %v; want ErrNotSupported", err)
+	}
+}
+
+func backupFileNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestBackupSchedulerRotation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := newBackupTestStore()
+	defer src.Close(ctx)
+
+	scheduler, err := NewBackupScheduler(src.(IMightyMapBackupStorage), dir,
+		WithBackupInterval(0),
+		WithBackupFullEvery(3),
+		WithBackupRetention(2),
+	)
+	if err != nil {
+		t.Fatalf("NewBackupScheduler() error: %v", err)
+	}
+
+	// three chains of a full and two incremental backups each
+	for i := 0; i < 9; i++ {
+		src.Store(ctx, "key", i)
+		src.Store(ctx, string(rune('a'+i)), i)
+		path, err := scheduler.BackupNow(ctx)
+		if err != nil {
+			t.Fatalf("BackupNow() error: %v", err)
+		}
+		wantExt := backupIncrExt
+		if i%3 == 0 {
+			wantExt = backupFullExt
+		}
+		if filepath.Ext(path) != wantExt {
+			t.Errorf("backup %d = %s; want a %s backup", i, path, wantExt)
+		}
+
+		if i == 0 {
+			// an incremental backup without changes writes nothing and does not count
+			if path, err := scheduler.BackupNow(ctx); err != nil || path != "" {
+				t.Errorf("BackupNow() without changes = %q, %v; want no file", path, err)
+			}
+		}
+	}
+	scheduler.Stop()
+
+	names := backupFileNames(t, dir)
+	if len(names) != 6 {
+		t.Fatalf("backup directory holds %v; want the last 2 chains", names)
+	}
+	fulls := 0
+	for _, name := range names {
+		if strings.HasSuffix(name, backupFullExt) {
+			fulls++
+		}
+	}
+	if fulls != 2 {
+		t.Errorf("backup directory holds %d full backups; want 2", fulls)
+	}
+
+	dst := newBackupTestStore()
+	defer dst.Close(ctx)
+	if err := RestoreBackups(ctx, dst.(IMightyMapBackupStorage), dir); err != nil {
+		t.Fatalf("RestoreBackups() error: %v", err)
+	}
+	if v, _ := dst.Load(ctx, "key"); v != 8 {
+		t.Errorf("restored key = %d; want 8", v)
+	}
+	if n, want := dst.Len(ctx), src.Len(ctx); n != want {
+		t.Errorf("restored Len() = %d; want %d", n, want)
+	}
+}
+
+func TestBackupSchedulerResume(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := newBackupTestStore()
+	defer src.Close(ctx)
+	backuper := src.(IMightyMapBackupStorage)
+
+	scheduler, err := NewBackupScheduler(backuper, dir, WithBackupInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Store(ctx, "a", 1)
+	if _, err := scheduler.BackupNow(ctx); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Stop()
+
+	// a new scheduler continues the chain with an incremental backup
+	scheduler, err = NewBackupScheduler(backuper, dir, WithBackupInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Stop()
+	src.Store(ctx, "b", 2)
+	path, err := scheduler.BackupNow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(path) != backupIncrExt {
+		t.Errorf("backup after resume = %s; want an incremental backup", path)
+	}
+}
+
+func TestBackupSchedulerInterval(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := newBackupTestStore()
+	defer src.Close(ctx)
+	src.Store(ctx, "a", 1)
+
+	scheduler, err := NewBackupScheduler(src.(IMightyMapBackupStorage), dir,
+		WithBackupInterval(20*time.Millisecond),
+		WithBackupErrorHandler(func(err error) { t.Errorf("scheduled backup failed: %v", err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(backupFileNames(t, dir)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	scheduler.Stop()
+
+	if len(backupFileNames(t, dir)) == 0 {
+		t.Fatal("no backup was written by the schedule")
+	}
+}
+
+func TestRestoreBackupsEmptyDir(t *testing.T) {
+	store := newBackupTestStore()
+	defer store.Close(context.Background())
+
+	if err := RestoreBackups(context.Background(), store.(IMightyMapBackupStorage), t.TempDir()); err != ErrNoBackup {
+		t.Errorf("RestoreBackups() error = %v; want ErrNoBackup", err)
+	}
+}
@@ -0,0 +1,384 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotSupported is returned by optional operations that the underlying storage implementation
+// does not provide.
+var ErrNotSupported = errors.New("mightymap: operation not supported by storage")
+
+// The interfaces below describe optional capabilities. Storage implementations only implement
+// the ones their backend can support; callers detect them with Supports, e.g.
+//
+//	if storage.Supports(store, storage.CapabilityTouch) {
+//		err := store.(storage.IMightyMapTouchStorage[string]).Touch(ctx, "session-1")
+//	}
+//
+// Storages returned by the constructors in this package that wrap a byte-level backend satisfy
+// all these interfaces and report ErrNotSupported when the backend lacks the capability, so a
+// type assertion alone does not tell whether the capability is available.
+
+// Capability identifies one of the optional storage interfaces, see Supports.
+type Capability int
+
+const (
+	// CapabilityTouch is IMightyMapTouchStorage
+	CapabilityTouch Capability = iota + 1
+	// CapabilityParallelRange is IMightyMapParallelRangeStorage
+	CapabilityParallelRange
+	// CapabilityNextWait is IMightyMapNextWaitStorage
+	CapabilityNextWait
+	// CapabilitySchedule is IMightyMapScheduleStorage
+	CapabilitySchedule
+	// CapabilityPriority is IMightyMapPriorityStorage
+	CapabilityPriority
+	// CapabilityBackup is IMightyMapBackupStorage
+	CapabilityBackup
+	// CapabilityCompact is IMightyMapCompactStorage
+	CapabilityCompact
+	// CapabilityMemoryUsage is IMightyMapMemoryStorage
+	CapabilityMemoryUsage
+	// CapabilitySize is IMightyMapSizeStorage
+	CapabilitySize
+	// CapabilityMaintenance is IMightyMapMaintenanceStorage
+	CapabilityMaintenance
+	// CapabilityVersions is IMightyMapVersionedStorage
+	CapabilityVersions
+	// CapabilityBulkLoad is IMightyMapBulkLoadStorage
+	CapabilityBulkLoad
+	// CapabilityQuery is IMightyMapQueryStorage
+	CapabilityQuery
+	// CapabilityStats is IMightyMapStatsStorage
+	CapabilityStats
+)
+
+// IMightyMapCapabilityStorage is implemented by storages that satisfy capability interfaces
+// they can not always serve, such as the wrappers of byte-level backends.
+type IMightyMapCapabilityStorage interface {
+	// Supports reports whether the methods of the interface of c work, rather than return
+	// ErrNotSupported.
+	Supports(c Capability) bool
+}
+
+// Supports reports whether s implements the interface of capability c and can serve it.
+func Supports[K comparable, V any](s IMightyMapStorage[K, V], c Capability) bool {
+	return supports[K, V](s, c)
+}
+
+// supports is Supports for storages of any interface, such as byteStorage.
+func supports[K comparable, V any](s any, c Capability) bool {
+	var ok bool
+	switch c {
+	case CapabilityTouch:
+		_, ok = s.(IMightyMapTouchStorage[K])
+	case CapabilityParallelRange:
+		_, ok = s.(IMightyMapParallelRangeStorage[K, V])
+	case CapabilityNextWait:
+		_, ok = s.(IMightyMapNextWaitStorage[K, V])
+	case CapabilitySchedule:
+		_, ok = s.(IMightyMapScheduleStorage[K, V])
+	case CapabilityPriority:
+		_, ok = s.(IMightyMapPriorityStorage[K, V])
+	case CapabilityBackup:
+		_, ok = s.(IMightyMapBackupStorage)
+	case CapabilityCompact:
+		_, ok = s.(IMightyMapCompactStorage)
+	case CapabilityMemoryUsage:
+		_, ok = s.(IMightyMapMemoryStorage)
+	case CapabilitySize:
+		_, ok = s.(IMightyMapSizeStorage)
+	case CapabilityMaintenance:
+		_, ok = s.(IMightyMapMaintenanceStorage)
+	case CapabilityVersions:
+		_, ok = s.(IMightyMapVersionedStorage[K, V])
+	case CapabilityBulkLoad:
+		_, ok = s.(IMightyMapBulkLoadStorage[K, V])
+	case CapabilityQuery:
+		_, ok = s.(IMightyMapQueryStorage[K, V])
+	case CapabilityStats:
+		_, ok = s.(IMightyMapStatsStorage)
+	}
+	if cs, reports := s.(IMightyMapCapabilityStorage); ok && reports {
+		return cs.Supports(c)
+	}
+	return ok
+}
+
+// IMightyMapTouchStorage is implemented by storages whose entries can expire.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+type IMightyMapTouchStorage[K comparable] interface {
+	// Touch resets the expiration of the given keys as if they had just been written,
+	// without reading their values. Missing keys and keys without an expiration are ignored.
+	Touch(ctx context.Context, keys ...K) error
+}
+
+// IMightyMapParallelRangeStorage is implemented by storages that can scan their entries with
+// several goroutines at once.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapParallelRangeStorage[K comparable, V any] interface {
+	// ParallelRange calls f for every key-value pair, using up to workers goroutines.
+	// f is called concurrently and must be safe for concurrent use; no ordering is guaranteed.
+	// Returning false from f stops the whole scan: calls already in progress complete, but no
+	// new calls are started. Entries are read ahead by at most a few batches per worker, so a
+	// slow f slows down the scan instead of buffering the storage in memory.
+	// Returns the context error if ctx is cancelled, or the first error reported by the backend.
+	ParallelRange(ctx context.Context, workers int, f func(key K, value V) bool) error
+}
+
+// IMightyMapNextWaitStorage is implemented by storages that can wait for entries to be stored.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapNextWaitStorage[K comparable, V any] interface {
+	// NextWait removes and returns an entry like Next, blocking while the storage is empty.
+	// Concurrent callers each receive a different entry.
+	// Returns the context error if ctx is cancelled before an entry is available.
+	NextWait(ctx context.Context) (key K, value V, err error)
+}
+
+// IMightyMapScheduleStorage is implemented by storages that can hold entries back until a
+// point in time, for retries with backoff or scheduled jobs.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapScheduleStorage[K comparable, V any] interface {
+	// StoreAt stores the entry like Store, but Load, Range, Keys, Len and Next ignore it until
+	// visibleAt. Storing the key again with Store makes it visible at once. The expiration of
+	// a scheduled entry starts at visibleAt.
+	StoreAt(ctx context.Context, key K, value V, visibleAt time.Time) error
+	// NextDue removes and returns the scheduled entry with the earliest due time, if that time
+	// has passed. Entries stored with Store are not scheduled and never returned.
+	NextDue(ctx context.Context) (key K, value V, ok bool)
+}
+
+// IMightyMapPriorityStorage is implemented by storages whose Next can return entries by priority.
+// Entries with a priority are returned before all entries without one, the highest priority
+// first and, among equal priorities, the one that got its priority first. Storing an entry
+// again with Store keeps its priority; Delete, Next and StoreAt drop it.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapPriorityStorage[K comparable, V any] interface {
+	// StoreWithPriority stores the entry like Store and gives it priority, moving it behind the
+	// entries that already have the same priority.
+	StoreWithPriority(ctx context.Context, key K, value V, priority int) error
+	// SetPriority changes the priority of an entry, or gives it one, without rewriting its value.
+	// The entry keeps its place among the entries with the same priority.
+	// Returns false if the key is not present.
+	SetPriority(ctx context.Context, key K, priority int) (bool, error)
+}
+
+// IMightyMapBackupStorage is implemented by storages that can write and load portable backups.
+type IMightyMapBackupStorage interface {
+	// Backup writes all entries changed after version since to w and returns the version
+	// to pass as since to the next call, so incremental backups chain. Pass 0 for a full backup.
+	Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error)
+	// Restore loads a backup written by Backup into the storage. Entries in the backup replace
+	// existing entries with the same key; other existing entries are kept. A chain of
+	// incremental backups must be restored in the order it was written.
+	Restore(ctx context.Context, r io.Reader) error
+}
+
+// IMightyMapCompactStorage is implemented by storages that can reclaim disk space, or memory
+// for the Swiss and arena storages, on demand.
+type IMightyMapCompactStorage interface {
+	// Compact rewrites the storage files, or the in-memory tables, to reclaim the space of
+	// deleted, overwritten and expired entries. It blocks until the compaction is finished or
+	// ctx is cancelled.
+	Compact(ctx context.Context) error
+}
+
+// MemoryUsage describes the memory held by an in-memory storage that manages its own buffers.
+type MemoryUsage struct {
+	// Index is the size in bytes of the index tables.
+	Index int64
+	// Allocated is the size in bytes of the buffers holding the entries.
+	Allocated int64
+	// Live is the part of Allocated used by current entries.
+	Live int64
+	// Dead is the part of Allocated used by overwritten and deleted entries, until compaction.
+	Dead int64
+}
+
+// IMightyMapMemoryStorage is implemented by in-memory storages that can report their memory
+// usage, such as the arena storage.
+type IMightyMapMemoryStorage interface {
+	// MemoryUsage returns the current memory usage of the storage.
+	MemoryUsage(ctx context.Context) (MemoryUsage, error)
+}
+
+// IMightyMapSizeStorage is implemented by storages that can report their disk usage.
+type IMightyMapSizeStorage interface {
+	// Size returns the disk usage in bytes of the index (for Badger the LSM tree) and of
+	// the value data (for Badger the value log).
+	Size(ctx context.Context) (index, values int64, err error)
+}
+
+// CheckpointMode selects how much work Checkpoint does, see IMightyMapMaintenanceStorage.
+type CheckpointMode string
+
+// Checkpoint modes, named after the modes of SQLite's wal_checkpoint pragma.
+const (
+	// CheckpointPassive copies as much of the write-ahead log into the database as possible
+	// without waiting for readers or writers.
+	CheckpointPassive CheckpointMode = "PASSIVE"
+	// CheckpointFull waits for writers to finish and copies the whole log.
+	CheckpointFull CheckpointMode = "FULL"
+	// CheckpointRestart works like CheckpointFull and also waits for readers, so the next
+	// writer starts the log from the beginning.
+	CheckpointRestart CheckpointMode = "RESTART"
+	// CheckpointTruncate works like CheckpointRestart and also truncates the log file to zero bytes.
+	CheckpointTruncate CheckpointMode = "TRUNCATE"
+)
+
+// ErrCheckpointBusy is returned by Checkpoint when concurrent readers or writers kept it from
+// copying the whole write-ahead log. The checkpoint can be retried later.
+var ErrCheckpointBusy = errors.New("mightymap: checkpoint did not complete because the database is busy")
+
+// IMightyMapMaintenanceStorage is implemented by persistent storages that can be backed up to a
+// file and maintained while they are in use.
+type IMightyMapMaintenanceStorage interface {
+	// BackupFile writes a consistent copy of the storage to destPath, replacing an existing file.
+	// Reads and writes continue while the backup runs. For SQLite the copy is a database file
+	// that can be opened with WithSQLiteDBPath; for Badger it is a full backup for Restore.
+	BackupFile(ctx context.Context, destPath string) error
+	// Vacuum reclaims the space of deleted and expired entries. For SQLite it runs an
+	// incremental vacuum when auto_vacuum is INCREMENTAL and rebuilds the database file
+	// otherwise; for Badger it is the same as Compact.
+	Vacuum(ctx context.Context) error
+	// Checkpoint writes the write-ahead log into the main database files so the log does not
+	// grow unbounded under constant writes. Badger syncs its value log and ignores mode.
+	Checkpoint(ctx context.Context, mode CheckpointMode) error
+}
+
+// Versioned is one historical version of a value.
+//
+// Type parameters:
+//   - V: the value type
+type Versioned[V any] struct {
+	// Value is the value of this version; the zero value if Deleted is set.
+	Value V
+	// Version is the storage-wide version of the write, increasing with every commit.
+	Version uint64
+	// Timestamp is the time of the write, or the zero time if the storage did not record it.
+	Timestamp time.Time
+	// Deleted reports that this version removed the key, or that the entry had expired.
+	Deleted bool
+}
+
+// IMightyMapSnapshot is a read-only view of a storage at a fixed version. Writes made after
+// that version are not visible through it.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapSnapshot[K comparable, V any] interface {
+	// Version returns the version the snapshot reads at.
+	Version() uint64
+	Load(ctx context.Context, key K) (value V, ok bool)
+	Range(ctx context.Context, f func(key K, value V) bool)
+	Keys(ctx context.Context) []K
+	Len(ctx context.Context) int
+}
+
+// IMightyMapVersionedStorage is implemented by storages that keep a history of values.
+// How much history is available depends on the storage configuration, e.g.
+// WithNumVersionsToKeep for Badger; versions that have been discarded are not returned.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapVersionedStorage[K comparable, V any] interface {
+	// LoadVersions returns up to limit versions of key, newest first. A limit of zero or less
+	// returns all retained versions.
+	LoadVersions(ctx context.Context, key K, limit int) ([]Versioned[V], error)
+	// LoadAt returns the value key had at version.
+	LoadAt(ctx context.Context, key K, version uint64) (value V, ok bool, err error)
+	// CurrentVersion returns the version of the latest committed write.
+	CurrentVersion(ctx context.Context) (uint64, error)
+	// SnapshotAt returns a read-only view at version. Versions newer than the current
+	// version are rejected with ErrFutureVersion.
+	SnapshotAt(ctx context.Context, version uint64) (IMightyMapSnapshot[K, V], error)
+}
+
+// ErrFutureVersion is returned when a snapshot is requested at a version that has not been
+// committed yet, since later writes would change what the snapshot shows.
+var ErrFutureVersion = errors.New("mightymap: version is newer than the current version")
+
+// ErrReadOnly is returned, or used as the panic value of methods without an error result,
+// when a storage opened in read-only mode is written to.
+var ErrReadOnly = errors.New("mightymap: storage is read-only")
+
+// IMightyMapBulkLoadStorage is implemented by storages that can ingest a sorted stream of
+// entries into an empty database much faster than individual writes.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapBulkLoadStorage[K comparable, V any] interface {
+	// BulkLoader starts a bulk load. The storage must be empty, otherwise ErrNotEmpty is
+	// returned. Until the loader is finished or cancelled, other writes to the storage wait.
+	BulkLoader(ctx context.Context) (IMightyMapBulkLoader[K, V], error)
+}
+
+// IMightyMapBulkLoader receives the entries of a bulk load. It is not safe for concurrent use.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapBulkLoader[K comparable, V any] interface {
+	// Add appends an entry. Keys must be added in strictly ascending order of their MessagePack
+	// encoding, otherwise ErrUnsortedKeys is returned.
+	Add(key K, value V) error
+	// Finish makes the loaded entries visible and releases the storage for other writes.
+	Finish() error
+	// Cancel aborts the load and releases the storage. Entries already written may remain.
+	Cancel()
+}
+
+var (
+	// ErrUnsortedKeys is returned by a bulk loader when a key is not greater than the previous one.
+	ErrUnsortedKeys = errors.New("mightymap: bulk load keys are not in ascending order")
+	// ErrNotEmpty is returned when a bulk load is started on a storage that holds entries.
+	ErrNotEmpty = errors.New("mightymap: bulk load requires an empty storage")
+)
+
+// Entry is a key-value pair returned by queries.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// IMightyMapQueryStorage is implemented by storages that can filter their entries natively.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type
+type IMightyMapQueryStorage[K comparable, V any] interface {
+	// Query returns the entries matching where, a condition in the query language of the
+	// backend with placeholders for args. See the SQLite storage for the supported syntax.
+	Query(ctx context.Context, where string, args ...any) ([]Entry[K, V], error)
+}
+
+// IMightyMapStatsStorage is implemented by storages that count their cache hits, misses and
+// evictions.
+type IMightyMapStatsStorage interface {
+	// Stats returns the counters since the storage was created.
+	Stats(ctx context.Context) (CacheStats, error)
+}
@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"container/heap"
+	"container/list"
+	"hash/maphash"
+)
+
+// EvictionPolicy selects which entry the bounded storage evicts when it is over its limits.
+type EvictionPolicy int
+
+const (
+	// LRU evicts the least recently used entry. It is the default.
+	LRU EvictionPolicy = iota
+	// LFU evicts the least frequently used entry, the least recently used one among entries
+	// used equally often. Frequencies are exact and never decay, so entries that were popular
+	// once stay cached.
+	LFU
+	// TinyLFU is W-TinyLFU: new entries pass a small LRU window and are then only admitted to
+	// the main segmented LRU if they were used more often than the entry they would replace,
+	// according to an aging frequency sketch. It resists scans and one-hit wonders best.
+	TinyLFU
+)
+
+// evictionPolicy tracks the keys of the bounded storage and picks the ones to evict. Methods are
+// called with the policy lock of the storage held. access and remove must ignore unknown keys,
+// as buffered accesses can arrive after the key was removed.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+type evictionPolicy[K comparable] interface {
+	// add tracks a new key.
+	add(key K)
+	// access records a read or an overwrite of key.
+	access(key K)
+	// remove forgets key.
+	remove(key K)
+	// evict forgets and returns the key to evict next, false if no key is tracked.
+	evict() (K, bool)
+	// reset forgets all keys.
+	reset()
+}
+
+// newEvictionPolicy returns the policy for p. capacity is the expected number of entries and
+// sizes the frequency sketch of TinyLFU.
+func newEvictionPolicy[K comparable](p EvictionPolicy, capacity int) evictionPolicy[K] {
+	switch p {
+	case LFU:
+		return newLFUPolicy[K]()
+	case TinyLFU:
+		return newTinyLFUPolicy[K](capacity)
+	default:
+		return newLRUPolicy[K]()
+	}
+}
+
+// lruPolicy keeps the keys in a list, the most recently used first.
+type lruPolicy[K comparable] struct {
+	keys     *list.List
+	elements map[K]*list.Element
+}
+
+func newLRUPolicy[K comparable]() *lruPolicy[K] {
+	return &lruPolicy[K]{keys: list.New(), elements: make(map[K]*list.Element)}
+}
+
+func (p *lruPolicy[K]) add(key K) {
+	p.elements[key] = p.keys.PushFront(key)
+}
+
+func (p *lruPolicy[K]) access(key K) {
+	if e, ok := p.elements[key]; ok {
+		p.keys.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy[K]) remove(key K) {
+	if e, ok := p.elements[key]; ok {
+		p.keys.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *lruPolicy[K]) evict() (key K, ok bool) {
+	e := p.keys.Back()
+	if e == nil {
+		return key, false
+	}
+	key = p.keys.Remove(e).(K)
+	delete(p.elements, key)
+	return key, true
+}
+
+func (p *lruPolicy[K]) reset() {
+	p.keys.Init()
+	p.elements = make(map[K]*list.Element)
+}
+
+// lfuPolicy keeps the keys in a min-heap ordered by use count, then by last use.
+type lfuPolicy[K comparable] struct {
+	items   map[K]*lfuItem[K]
+	heap    lfuHeap[K]
+	lastSeq uint64
+}
+
+type lfuItem[K comparable] struct {
+	key   K
+	count uint64
+	seq   uint64
+	index int
+}
+
+// lfuHeap implements heap.Interface with the lowest count, then the lowest sequence number, first.
+type lfuHeap[K comparable] []*lfuItem[K]
+
+func (h lfuHeap[K]) Len() int { return len(h) }
+func (h lfuHeap[K]) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].seq < h[j].seq
+}
+func (h lfuHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap[K]) Push(x any) {
+	item := x.(*lfuItem[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap[K]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newLFUPolicy[K comparable]() *lfuPolicy[K] {
+	return &lfuPolicy[K]{items: make(map[K]*lfuItem[K])}
+}
+
+func (p *lfuPolicy[K]) add(key K) {
+	p.lastSeq++
+	item := &lfuItem[K]{key: key, count: 1, seq: p.lastSeq}
+	p.items[key] = item
+	heap.Push(&p.heap, item)
+}
+
+func (p *lfuPolicy[K]) access(key K) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+	p.lastSeq++
+	item.count++
+	item.seq = p.lastSeq
+	heap.Fix(&p.heap, item.index)
+}
+
+func (p *lfuPolicy[K]) remove(key K) {
+	if item, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, item.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfuPolicy[K]) evict() (key K, ok bool) {
+	if len(p.heap) == 0 {
+		return key, false
+	}
+	item := heap.Pop(&p.heap).(*lfuItem[K])
+	delete(p.items, item.key)
+	return item.key, true
+}
+
+func (p *lfuPolicy[K]) reset() {
+	p.items = make(map[K]*lfuItem[K])
+	p.heap = nil
+}
+
+// The regions of TinyLFU. New keys enter the window; keys leaving the window enter probation;
+// keys used again while on probation are protected.
+const (
+	tinyLFUWindow = iota
+	tinyLFUProbation
+	tinyLFUProtected
+)
+
+const (
+	// tinyLFUWindowPercent is the share of the entries kept in the window
+	tinyLFUWindowPercent = 1
+	// tinyLFUProtectedPercent is the share of the main region kept in the protected segment
+	tinyLFUProtectedPercent = 80
+)
+
+// tinyLFUPolicy implements W-TinyLFU. Keys leaving the window land at the front of probation.
+// When an entry has to go, that newest probation key, the candidate, competes with the least
+// recently used probation key, the victim: the one the sketch estimates to be used less often
+// is evicted, the candidate on a tie, so one-off keys can not push out popular ones. Without keys
+// on probation the least recently used protected key, then window key, is evicted.
+type tinyLFUPolicy[K comparable] struct {
+	regions  [3]*list.List
+	elements map[K]*list.Element
+	sketch   *frequencySketch[K]
+}
+
+type tinyLFUEntry[K comparable] struct {
+	key    K
+	region int
+}
+
+func newTinyLFUPolicy[K comparable](capacity int) *tinyLFUPolicy[K] {
+	return &tinyLFUPolicy[K]{
+		regions:  [3]*list.List{list.New(), list.New(), list.New()},
+		elements: make(map[K]*list.Element),
+		sketch:   newFrequencySketch[K](capacity),
+	}
+}
+
+func (p *tinyLFUPolicy[K]) add(key K) {
+	p.sketch.increment(key)
+	p.elements[key] = p.regions[tinyLFUWindow].PushFront(&tinyLFUEntry[K]{key: key})
+
+	window := p.regions[tinyLFUWindow]
+	if window.Len() > max(1, len(p.elements)*tinyLFUWindowPercent/100) {
+		p.move(window.Back(), tinyLFUProbation)
+	}
+}
+
+func (p *tinyLFUPolicy[K]) access(key K) {
+	e, ok := p.elements[key]
+	if !ok {
+		return
+	}
+	p.sketch.increment(key)
+	switch e.Value.(*tinyLFUEntry[K]).region {
+	case tinyLFUProbation:
+		p.move(e, tinyLFUProtected)
+		protected := p.regions[tinyLFUProtected]
+		main := len(p.elements) - p.regions[tinyLFUWindow].Len()
+		if protected.Len() > max(1, main*tinyLFUProtectedPercent/100) {
+			p.move(protected.Back(), tinyLFUProbation)
+		}
+	default:
+		p.regions[e.Value.(*tinyLFUEntry[K]).region].MoveToFront(e)
+	}
+}
+
+// move puts e at the front of region.
+func (p *tinyLFUPolicy[K]) move(e *list.Element, region int) {
+	entry := e.Value.(*tinyLFUEntry[K])
+	p.regions[entry.region].Remove(e)
+	entry.region = region
+	p.elements[entry.key] = p.regions[region].PushFront(entry)
+}
+
+func (p *tinyLFUPolicy[K]) remove(key K) {
+	if e, ok := p.elements[key]; ok {
+		p.regions[e.Value.(*tinyLFUEntry[K]).region].Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *tinyLFUPolicy[K]) evict() (key K, ok bool) {
+	e := p.regions[tinyLFUProbation].Back()
+	if candidate := p.regions[tinyLFUProbation].Front(); candidate != e {
+		c, v := candidate.Value.(*tinyLFUEntry[K]).key, e.Value.(*tinyLFUEntry[K]).key
+		if p.sketch.estimate(c) <= p.sketch.estimate(v) {
+			e = candidate
+		}
+	}
+	for _, region := range []int{tinyLFUProtected, tinyLFUWindow} {
+		if e == nil {
+			e = p.regions[region].Back()
+		}
+	}
+	if e == nil {
+		return key, false
+	}
+	key = e.Value.(*tinyLFUEntry[K]).key
+	p.remove(key)
+	return key, true
+}
+
+func (p *tinyLFUPolicy[K]) reset() {
+	for _, region := range p.regions {
+		region.Init()
+	}
+	p.elements = make(map[K]*list.Element)
+	p.sketch.reset()
+}
+
+const (
+	// frequencySketchDepth is the number of counters per key
+	frequencySketchDepth = 4
+	// frequencySketchMaxCount is the value counters saturate at
+	frequencySketchMaxCount = 15
+	// frequencySketchWidth is the number of counters per row per expected key
+	frequencySketchWidth = 4
+	// frequencySketchSamples is the number of increments per expected key after which all
+	// counters are halved, so old popularity fades
+	frequencySketchSamples = 10
+)
+
+// frequencySketch is a count-min sketch estimating how often keys were used recently, in a fixed
+// amount of memory regardless of the number of distinct keys.
+type frequencySketch[K comparable] struct {
+	seed      maphash.Seed
+	counters  []uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+// newFrequencySketch returns a sketch sized for capacity keys.
+func newFrequencySketch[K comparable](capacity int) *frequencySketch[K] {
+	capacity = max(capacity, 16)
+	width := 1
+	for width < capacity*frequencySketchWidth {
+		width <<= 1
+	}
+	return &frequencySketch[K]{
+		seed:     maphash.MakeSeed(),
+		counters: make([]uint8, width*frequencySketchDepth),
+		mask:     uint64(width - 1),
+		resetAt:  capacity * frequencySketchSamples,
+	}
+}
+
+// indexes returns the counter of key in every row.
+func (s *frequencySketch[K]) indexes(key K) (idx [frequencySketchDepth]uint64) {
+	h := hashKey(s.seed, key)
+	h1, h2 := h&0xffffffff, h>>32|1
+	width := s.mask + 1
+	for i := range idx {
+		idx[i] = uint64(i)*width + (h1+uint64(i)*h2)&s.mask
+	}
+	return idx
+}
+
+func (s *frequencySketch[K]) increment(key K) {
+	for _, i := range s.indexes(key) {
+		if s.counters[i] < frequencySketchMaxCount {
+			s.counters[i]++
+		}
+	}
+	if s.additions++; s.additions >= s.resetAt {
+		for i := range s.counters {
+			s.counters[i] >>= 1
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch[K]) estimate(key K) uint8 {
+	count := uint8(frequencySketchMaxCount)
+	for _, i := range s.indexes(key) {
+		count = min(count, s.counters[i])
+	}
+	return count
+}
+
+func (s *frequencySketch[K]) reset() {
+	clear(s.counters)
+	s.additions = 0
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// expiryTracker keeps per-key deadlines for the in-memory storages.
+//
+// Deadlines are stored as atomic unix nanosecond timestamps so that a sliding expiration can be
+// refreshed by Load while only holding the storage read lock. All other methods must be called
+// with the storage write lock held, except alive and slide which only need the read lock.
+// A nil *expiryTracker means expiration is disabled and every method is a no-op.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+type expiryTracker[K comparable] struct {
+	expire    time.Duration
+	sliding   bool
+	deadlines map[K]*atomic.Int64
+	lastPurge time.Time
+}
+
+// newExpiryTracker returns a tracker for the given expiration, or nil if expire is not positive.
+func newExpiryTracker[K comparable](expire time.Duration, sliding bool) *expiryTracker[K] {
+	if expire <= 0 {
+		return nil
+	}
+	return &expiryTracker[K]{
+		expire:    expire,
+		sliding:   sliding,
+		deadlines: make(map[K]*atomic.Int64),
+		lastPurge: time.Now(),
+	}
+}
+
+// set starts or restarts the expiration of key.
+func (e *expiryTracker[K]) set(key K) {
+	e.setFrom(key, time.Time{})
+}
+
+// setFrom starts or restarts the expiration of key at start, or now if start is zero.
+func (e *expiryTracker[K]) setFrom(key K, start time.Time) {
+	if e == nil {
+		return
+	}
+	if start.IsZero() {
+		start = time.Now()
+	}
+	deadline := start.Add(e.expire).UnixNano()
+	if d, ok := e.deadlines[key]; ok {
+		d.Store(deadline)
+		return
+	}
+	d := &atomic.Int64{}
+	d.Store(deadline)
+	e.deadlines[key] = d
+}
+
+// remove forgets the deadline of key.
+func (e *expiryTracker[K]) remove(key K) {
+	if e == nil {
+		return
+	}
+	delete(e.deadlines, key)
+}
+
+// reset forgets all deadlines.
+func (e *expiryTracker[K]) reset() {
+	if e == nil {
+		return
+	}
+	e.deadlines = make(map[K]*atomic.Int64)
+}
+
+// alive reports whether key has not expired at now (unix nanoseconds).
+func (e *expiryTracker[K]) alive(key K, now int64) bool {
+	if e == nil {
+		return true
+	}
+	d, ok := e.deadlines[key]
+	return !ok || d.Load() > now
+}
+
+// slide extends the deadline of key if sliding expiration is enabled.
+// It only needs the read lock of the storage.
+func (e *expiryTracker[K]) slide(key K) {
+	if e == nil || !e.sliding {
+		return
+	}
+	e.touch(key)
+}
+
+// touch extends the deadline of key if it is tracked and still alive.
+// It only needs the read lock of the storage.
+func (e *expiryTracker[K]) touch(key K) {
+	if e == nil {
+		return
+	}
+	now := time.Now()
+	if d, ok := e.deadlines[key]; ok && d.Load() > now.UnixNano() {
+		d.Store(now.Add(e.expire).UnixNano())
+	}
+}
+
+// now returns the current time in unix nanoseconds, or 0 when expiration is disabled
+// so callers can skip the clock read.
+func (e *expiryTracker[K]) now() int64 {
+	if e == nil {
+		return 0
+	}
+	return time.Now().UnixNano()
+}
+
+// purgeDue reports whether enough time has passed since the last purge to scan for expired keys.
+// Purging at most once per expiration period keeps the amortized cost of Store constant.
+func (e *expiryTracker[K]) purgeDue() bool {
+	if e == nil || time.Since(e.lastPurge) < e.expire {
+		return false
+	}
+	e.lastPurge = time.Now()
+	return true
+}
+
+// expired returns and forgets all keys whose deadline has passed.
+func (e *expiryTracker[K]) expired() []K {
+	if e == nil {
+		return nil
+	}
+	now := time.Now().UnixNano()
+	var keys []K
+	for k, d := range e.deadlines {
+		if d.Load() <= now {
+			keys = append(keys, k)
+			delete(e.deadlines, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+type expiryTestCase struct {
+	name string
+	// newStore creates a storage with the given expiration and sliding setting
+	newStore func(t *testing.T, expire time.Duration, sliding bool) IMightyMapStorage[string, int]
+	// advance moves the clock of the backend forward
+	advance func(d time.Duration)
+	expire  time.Duration
+	// first and second are the two clock steps of the test; each is shorter than expire
+	// (minus the backend TTL granularity) but together they exceed it
+	first, second time.Duration
+}
+
+func expiryTestCases(t *testing.T) []expiryTestCase {
+	mr := miniredis.RunT(t)
+	sleep := func(d time.Duration) { time.Sleep(d) }
+
+	return []expiryTestCase{
+		{
+			name: "Default",
+			newStore: func(_ *testing.T, expire time.Duration, sliding bool) IMightyMapStorage[string, int] {
+				return NewMightyMapDefaultStorage[string, int](
+					WithDefaultStorageExpire(expire),
+					WithDefaultStorageSlidingExpiration(sliding),
+				)
+			},
+			advance: sleep,
+			expire:  300 * time.Millisecond,
+			first:   200 * time.Millisecond,
+			second:  200 * time.Millisecond,
+		},
+		{
+			name: "Swiss",
+			newStore: func(_ *testing.T, expire time.Duration, sliding bool) IMightyMapStorage[string, int] {
+				return NewMightyMapSwissStorage[string, int](
+					WithSwissExpire(expire),
+					WithSwissSlidingExpiration(sliding),
+				)
+			},
+			advance: sleep,
+			expire:  300 * time.Millisecond,
+			first:   200 * time.Millisecond,
+			second:  200 * time.Millisecond,
+		},
+		{
+			name: "SQLite",
+			newStore: func(_ *testing.T, expire time.Duration, sliding bool) IMightyMapStorage[string, int] {
+				return NewMightyMapSQLiteStorage[string, int](
+					WithSQLiteExpire(expire),
+					WithSQLiteSlidingExpiration(sliding),
+					WithSQLiteCountCacheDuration(0),
+				)
+			},
+			advance: sleep,
+			expire:  300 * time.Millisecond,
+			first:   200 * time.Millisecond,
+			second:  200 * time.Millisecond,
+		},
+		{
+			name: "Redis",
+			newStore: func(_ *testing.T, expire time.Duration, sliding bool) IMightyMapStorage[string, int] {
+				mr.FlushAll()
+				return NewMightyMapRedisStorage[string, int](
+					WithRedisAddr(mr.Addr()),
+					WithRedisExpire(expire),
+					WithRedisSlidingExpiration(sliding),
+				)
+			},
+			advance: mr.FastForward,
+			expire:  10 * time.Second,
+			first:   6 * time.Second,
+			second:  6 * time.Second,
+		},
+		{
+			// Badger TTLs have a granularity of one second
+			name: "Badger",
+			newStore: func(_ *testing.T, expire time.Duration, sliding bool) IMightyMapStorage[string, int] {
+				return NewMightyMapBadgerStorage[string, int](
+					WithMemoryStorage(true),
+					WithExpire(expire),
+					WithSlidingExpiration(sliding),
+				)
+			},
+			advance: sleep,
+			expire:  3 * time.Second,
+			first:   1500 * time.Millisecond,
+			second:  1600 * time.Millisecond,
+		},
+	}
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range expiryTestCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := tc.newStore(t, tc.expire, true)
+			defer store.Close(ctx)
+
+			store.Store(ctx, "read", 1)
+			store.Store(ctx, "idle", 2)
+			store.Store(ctx, "touched", 3)
+
+			tc.advance(tc.first)
+			if v, ok := store.Load(ctx, "read"); !ok || v != 1 {
+				t.Fatalf("Load() = %v, %v; want 1, true", v, ok)
+			}
+			if err := store.(IMightyMapTouchStorage[string]).Touch(ctx, "touched", "missing"); err != nil {
+				t.Fatalf("Touch() error: %v", err)
+			}
+			tc.advance(tc.second)
+
+			if _, ok := store.Load(ctx, "idle"); ok {
+				t.Error("expected idle entry to have expired")
+			}
+			if v, ok := store.Load(ctx, "read"); !ok || v != 1 {
+				t.Errorf("expected read entry to be kept alive by Load, got %v, %v", v, ok)
+			}
+			if v, ok := store.Load(ctx, "touched"); !ok || v != 3 {
+				t.Errorf("expected touched entry to be kept alive by Touch, got %v, %v", v, ok)
+			}
+
+			keys := store.Keys(ctx)
+			if len(keys) != 2 {
+				t.Errorf("Keys() = %v; want 2 live keys", keys)
+			}
+			if n := store.Len(ctx); n != 2 {
+				t.Errorf("Len() = %d; want 2", n)
+			}
+		})
+	}
+}
+
+func TestFixedExpiration(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range expiryTestCases(t) {
+		if tc.name == "Badger" {
+			// native Badger TTLs, covered by the sliding test
+			continue
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := tc.newStore(t, tc.expire, false)
+			defer store.Close(ctx)
+
+			store.Store(ctx, "read", 1)
+			tc.advance(tc.first)
+			if _, ok := store.Load(ctx, "read"); !ok {
+				t.Fatal("expected entry to be alive before the expiration")
+			}
+			tc.advance(tc.second)
+
+			if _, ok := store.Load(ctx, "read"); ok {
+				t.Error("Load must not extend a fixed expiration")
+			}
+			count := 0
+			store.Range(ctx, func(string, int) bool {
+				count++
+				return true
+			})
+			if count != 0 {
+				t.Errorf("Range() visited %d expired entries", count)
+			}
+			if _, _, ok := store.Next(ctx); ok {
+				t.Error("Next() returned an expired entry")
+			}
+		})
+	}
+}
+
+func TestTouchWithoutExpiration(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapDefaultStorage[string, int]()
+	store.Store(ctx, "key", 1)
+
+	if err := store.(IMightyMapTouchStorage[string]).Touch(ctx, "key"); err != nil {
+		t.Fatalf("Touch() error: %v", err)
+	}
+	if _, ok := store.Load(ctx, "key"); !ok {
+		t.Fatal("expected entry without expiration to remain")
+	}
+}
+
+func TestExpiredEntriesArePurged(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapDefaultStorage[string, int](WithDefaultStorageExpire(10 * time.Millisecond))
+	direct := store.(*mightyMapDirectStorage[string, int])
+
+	store.Store(ctx, "old", 1)
+	time.Sleep(20 * time.Millisecond)
+	store.Store(ctx, "new", 2)
+
+	direct.mutex.RLock()
+	defer direct.mutex.RUnlock()
+	if _, ok := direct.data["old"]; ok {
+		t.Error("expected expired entry to be purged by a later Store")
+	}
+}
@@ -0,0 +1,9 @@
+package storage
+
+import "hash/maphash"
+
+// hashKey hashes key with seed, consistently for keys that are equal by ==, including -0 and
+// +0 floats.
+func hashKey[K comparable](seed maphash.Seed, key K) uint64 {
+	return maphash.Comparable(seed, key)
+}
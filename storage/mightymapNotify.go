@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultNextWaitPollInterval is how often NextWait of the persistent storages looks for entries
+// written by other processes, which do not wake up waiters in this process.
+const defaultNextWaitPollInterval = time.Second
+
+// storeNotifier wakes up the goroutines waiting in NextWait when an entry is stored.
+// A nil notifier is valid and never signals.
+type storeNotifier struct {
+	mu sync.Mutex
+	// ch is closed by the next notify; it is only created once somebody waits
+	ch chan struct{}
+}
+
+// newStoreNotifier returns a notifier without waiters.
+func newStoreNotifier() *storeNotifier {
+	return &storeNotifier{}
+}
+
+// notify wakes up all current waiters. It must be called after the entry is visible to Next.
+func (n *storeNotifier) notify() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+	n.mu.Unlock()
+}
+
+// wait returns a channel that is closed by the next notify. It must be called before looking for
+// an entry, so that an entry stored in between is not missed.
+func (n *storeNotifier) wait() <-chan struct{} {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	return n.ch
+}
+
+// waitNext calls next until it returns an entry, sleeping until n signals a store in between.
+// With a positive poll interval next is also retried after every interval.
+// Returns the context error if ctx is cancelled first.
+func waitNext[K comparable, V any](ctx context.Context, n *storeNotifier, poll time.Duration, next func(ctx context.Context) (K, V, bool)) (key K, value V, err error) {
+	var tick <-chan time.Time
+	if poll > 0 {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		stored := n.wait()
+		if key, value, ok := next(ctx); ok {
+			return key, value, nil
+		}
+		select {
+		case <-ctx.Done():
+			return key, value, ctx.Err()
+		case <-stored:
+		case <-tick:
+		}
+	}
+}
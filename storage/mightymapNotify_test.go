@@ -0,0 +1,96 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thisisdevelopment/mightymap/internal/storagetest"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+func TestNextWait(t *testing.T) {
+	ctx := context.Background()
+	const waiters = 4
+
+	for name, newStore := range storagetest.Storages[int, int](t, storagetest.All(), storage.CapabilityNextWait) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+			w := store.(storage.IMightyMapNextWaitStorage[int, int])
+
+			waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			var (
+				wg   sync.WaitGroup
+				mu   sync.Mutex
+				seen = map[int]int{}
+			)
+			for range waiters {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					key, value, err := w.NextWait(waitCtx)
+					if err != nil {
+						t.Errorf("NextWait() error: %v", err)
+						return
+					}
+					mu.Lock()
+					seen[key] = value
+					mu.Unlock()
+				}()
+			}
+
+			// let the waiters block on the empty storage first
+			time.Sleep(50 * time.Millisecond)
+			for i := 1; i <= waiters; i++ {
+				store.Store(ctx, i, i*10)
+			}
+			wg.Wait()
+
+			if len(seen) != waiters {
+				t.Fatalf("waiters received %v; want %d distinct entries", seen, waiters)
+			}
+			for key, value := range seen {
+				if value != key*10 {
+					t.Errorf("NextWait() returned %d for key %d; want %d", value, key, key*10)
+				}
+			}
+			if n := store.Len(ctx); n != 0 {
+				t.Errorf("Len() = %d; want 0", n)
+			}
+
+			cancelCtx, cancelWait := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancelWait()
+			if _, _, err := w.NextWait(cancelCtx); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("NextWait() on an empty storage = %v; want context.DeadlineExceeded", err)
+			}
+		})
+	}
+}
+
+func TestNextWaitPollsForOtherWriters(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "wait.db")
+
+	reader := storage.NewMightyMapSQLiteStorage[int, int](storage.WithSQLiteDBPath(path), storage.WithSQLiteNextWaitPollInterval(20*time.Millisecond))
+	defer reader.Close(ctx)
+	writer := storage.NewMightyMapSQLiteStorage[int, int](storage.WithSQLiteDBPath(path))
+	defer writer.Close(ctx)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		writer.Store(ctx, 1, 2)
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	key, value, err := reader.(storage.IMightyMapNextWaitStorage[int, int]).NextWait(waitCtx)
+	if err != nil || key != 1 || value != 2 {
+		t.Fatalf("NextWait() = %d, %d, %v; want 1, 2, nil", key, value, err)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Ordering selects the order in which a storage returns its entries from Next, Range and Keys.
+type Ordering int
+
+const (
+	// Unordered leaves the order to the backend: map order for the in-memory storages, key byte
+	// order for Badger and SQLite, SCAN order for Redis. It is the default.
+	Unordered Ordering = iota
+	// FIFO returns entries in insertion order: Next always removes the oldest entry and Range and
+	// Keys start with it. Overwriting a key keeps its position; deleting it and storing it again
+	// moves it to the end.
+	FIFO
+)
+
+// orderIndex keeps the insertion order of the keys of the in-memory storages as a linked list
+// with an index into it. All methods must be called with the storage write lock held, except
+// each which only needs the read lock. An index shared by the shards of a sharded storage also
+// locks mu, so it can be changed under the lock of any shard.
+// A nil *orderIndex means FIFO ordering is disabled and every method is a no-op.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+type orderIndex[K comparable] struct {
+	keys     *list.List
+	elements map[K]*list.Element
+	mu       *sync.Mutex
+}
+
+// newOrderIndex returns an index for the given ordering, or nil if it needs none.
+func newOrderIndex[K comparable](ordering Ordering) *orderIndex[K] {
+	if ordering != FIFO {
+		return nil
+	}
+	return &orderIndex[K]{
+		keys:     list.New(),
+		elements: make(map[K]*list.Element),
+	}
+}
+
+// newSharedOrderIndex returns an index for the given ordering that several shards can share,
+// or nil if it needs none.
+func newSharedOrderIndex[K comparable](ordering Ordering) *orderIndex[K] {
+	o := newOrderIndex[K](ordering)
+	if o != nil {
+		o.mu = &sync.Mutex{}
+	}
+	return o
+}
+
+// lock locks mu of a shared index and returns the function that unlocks it.
+func (o *orderIndex[K]) lock() (unlock func()) {
+	if o.mu == nil {
+		return func() {}
+	}
+	o.mu.Lock()
+	return o.mu.Unlock
+}
+
+// add appends key unless it is already present, so overwrites keep their position.
+func (o *orderIndex[K]) add(key K) {
+	if o == nil {
+		return
+	}
+	defer o.lock()()
+	if _, ok := o.elements[key]; ok {
+		return
+	}
+	o.elements[key] = o.keys.PushBack(key)
+}
+
+// remove forgets key.
+func (o *orderIndex[K]) remove(key K) {
+	if o == nil {
+		return
+	}
+	defer o.lock()()
+	if e, ok := o.elements[key]; ok {
+		o.keys.Remove(e)
+		delete(o.elements, key)
+	}
+}
+
+// reset forgets all keys.
+func (o *orderIndex[K]) reset() {
+	if o == nil {
+		return
+	}
+	defer o.lock()()
+	o.keys.Init()
+	o.elements = make(map[K]*list.Element)
+}
+
+// each calls f for every key from the oldest to the newest until f returns false.
+func (o *orderIndex[K]) each(f func(key K) bool) {
+	if o == nil {
+		return
+	}
+	defer o.lock()()
+	for e := o.keys.Front(); e != nil; e = e.Next() {
+		if !f(e.Value.(K)) {
+			return
+		}
+	}
+}
+
+// front returns the oldest key.
+func (o *orderIndex[K]) front() (key K, ok bool) {
+	if o == nil {
+		return key, false
+	}
+	defer o.lock()()
+	if e := o.keys.Front(); e != nil {
+		return e.Value.(K), true
+	}
+	return key, false
+}
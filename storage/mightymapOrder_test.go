@@ -0,0 +1,111 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thisisdevelopment/mightymap/internal/storagetest"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+func TestFIFOOrdering(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newStore := range storagetest.Storages[string, int](t, storagetest.FIFO()) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+
+			for i, key := range []string{"c", "a", "d", "b"} {
+				store.Store(ctx, key, i)
+			}
+			// overwriting keeps the position, storing a deleted key again appends it
+			store.Store(ctx, "a", 10)
+			store.Delete(ctx, "d")
+			store.Store(ctx, "d", 20)
+
+			want := []string{"c", "a", "b", "d"}
+			if keys := store.Keys(ctx); !reflect.DeepEqual(keys, want) {
+				t.Errorf("Keys() = %v; want %v", keys, want)
+			}
+			var ranged []string
+			store.Range(ctx, func(key string, _ int) bool {
+				ranged = append(ranged, key)
+				return true
+			})
+			if !reflect.DeepEqual(ranged, want) {
+				t.Errorf("Range() visited %v; want %v", ranged, want)
+			}
+
+			wantValues := []int{0, 10, 3, 20}
+			for i, wantKey := range want {
+				key, value, ok := store.Next(ctx)
+				if !ok || key != wantKey || value != wantValues[i] {
+					t.Fatalf("Next() = %v, %v, %v; want %v, %v, true", key, value, ok, wantKey, wantValues[i])
+				}
+			}
+			if key, _, ok := store.Next(ctx); ok {
+				t.Errorf("Next() on empty storage returned %v", key)
+			}
+			if n := store.Len(ctx); n != 0 {
+				t.Errorf("Len() = %d; want 0", n)
+			}
+
+			store.Store(ctx, "x", 1)
+			store.Clear(ctx)
+			store.Store(ctx, "y", 2)
+			store.Store(ctx, "x", 3)
+			if keys := store.Keys(ctx); !reflect.DeepEqual(keys, []string{"y", "x"}) {
+				t.Errorf("Keys() after Clear = %v; want [y x]", keys)
+			}
+		})
+	}
+}
+
+func TestFIFOOrderingReopen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("SQLite", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "order.db")
+		unordered := storage.NewMightyMapSQLiteStorage[string, int](storage.WithSQLiteDBPath(path))
+		unordered.Store(ctx, "b", 1)
+		unordered.Store(ctx, "a", 2)
+		unordered.Close(ctx)
+
+		// existing rows are ordered by key, new rows follow them
+		store := storage.NewMightyMapSQLiteStorage[string, int](storage.WithSQLiteDBPath(path), storage.WithSQLiteOrdering(storage.FIFO))
+		defer store.Close(ctx)
+		store.Store(ctx, "0", 3)
+		if keys := store.Keys(ctx); !reflect.DeepEqual(keys, []string{"a", "b", "0"}) {
+			t.Errorf("Keys() = %v; want [a b 0]", keys)
+		}
+	})
+
+	t.Run("Badger", func(t *testing.T) {
+		dir := t.TempDir()
+		unordered := storage.NewMightyMapBadgerStorage[string, int](storage.WithTempDir(dir), storage.WithMemoryStorage(false))
+		unordered.Store(ctx, "b", 1)
+		unordered.Store(ctx, "a", 2)
+		unordered.Close(ctx)
+
+		store := storage.NewMightyMapBadgerStorage[string, int](storage.WithTempDir(dir), storage.WithMemoryStorage(false), storage.WithOrdering(storage.FIFO))
+		store.Store(ctx, "0", 3)
+		store.Close(ctx)
+
+		// the order survives reopening
+		store = storage.NewMightyMapBadgerStorage[string, int](storage.WithTempDir(dir), storage.WithMemoryStorage(false), storage.WithOrdering(storage.FIFO))
+		defer store.Close(ctx)
+		store.Store(ctx, "c", 4)
+		if keys := store.Keys(ctx); !reflect.DeepEqual(keys, []string{"a", "b", "0", "c"}) {
+			t.Errorf("Keys() = %v; want [a b 0 c]", keys)
+		}
+		if key, _, ok := store.Next(ctx); !ok || key != "a" {
+			t.Errorf("Next() = %v, %v; want a, true", key, ok)
+		}
+		if n := store.Len(ctx); n != 3 {
+			t.Errorf("Len() = %d; want 3", n)
+		}
+	})
+}
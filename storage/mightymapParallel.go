@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// parallelDispatch runs a bounded producer/consumer pipeline used by the ParallelRange
+// implementations.
+//
+// produce is called once from the calling goroutine and hands batches of work to emit; emit
+// blocks while all workers are busy and the queue is full, and returns false once the scan
+// has been stopped. consume is called from up to workers goroutines and returns false to
+// stop the scan. The first consume error, or the producer error if the scan was not stopped,
+// is returned; cancellation of ctx is reported as ctx.Err().
+func parallelDispatch[T any](
+	ctx context.Context,
+	workers int,
+	produce func(ctx context.Context, emit func(T) bool) error,
+	consume func(ctx context.Context, item T) (bool, error),
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	scanCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		consumeE error
+	)
+	items := make(chan T, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				if scanCtx.Err() != nil {
+					// drain the queue so the producer is never blocked
+					continue
+				}
+				more, err := consume(scanCtx, item)
+				switch {
+				case err != nil && scanCtx.Err() == nil:
+					errOnce.Do(func() { consumeE = err })
+					stop()
+				case err != nil || !more:
+					// errors after the scan was stopped are caused by the cancellation
+					stop()
+				}
+			}
+		}()
+	}
+
+	emit := func(item T) bool {
+		select {
+		case items <- item:
+			return true
+		case <-scanCtx.Done():
+			return false
+		}
+	}
+	produceErr := produce(scanCtx, emit)
+	close(items)
+	wg.Wait()
+
+	if consumeE != nil {
+		return consumeE
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if scanCtx.Err() != nil {
+		// stopped by a callback; the producer only saw the cancellation
+		return nil
+	}
+	return produceErr
+}
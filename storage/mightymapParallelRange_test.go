@@ -0,0 +1,138 @@
+package storage_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thisisdevelopment/mightymap/internal/storagetest"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+const parallelRangeTestEntries = 5000
+
+func TestParallelRange(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newStore := range storagetest.Storages[int, int](t, storagetest.All(), storage.CapabilityParallelRange) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+
+			for i := 0; i < parallelRangeTestEntries; i++ {
+				store.Store(ctx, i, i*2)
+			}
+			// overwritten and deleted entries must not show up
+			store.Store(ctx, 0, -1)
+			store.Delete(ctx, 1)
+
+			var (
+				mu   sync.Mutex
+				seen = make(map[int]int)
+			)
+			err := store.(storage.IMightyMapParallelRangeStorage[int, int]).ParallelRange(ctx, 8, func(key, value int) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				if _, dup := seen[key]; dup {
+					t.Errorf("key %d visited twice", key)
+				}
+				seen[key] = value
+				return true
+			})
+			if err != nil {
+				t.Fatalf("ParallelRange() error: %v", err)
+			}
+
+			if len(seen) != parallelRangeTestEntries-1 {
+				t.Fatalf("visited %d entries; want %d", len(seen), parallelRangeTestEntries-1)
+			}
+			if seen[0] != -1 {
+				t.Errorf("key 0 = %d; want the latest value -1", seen[0])
+			}
+			if _, ok := seen[1]; ok {
+				t.Error("deleted key 1 was visited")
+			}
+			for i := 2; i < parallelRangeTestEntries; i++ {
+				if seen[i] != i*2 {
+					t.Fatalf("key %d = %d; want %d", i, seen[i], i*2)
+				}
+			}
+		})
+	}
+}
+
+func TestParallelRangeStop(t *testing.T) {
+	ctx := context.Background()
+	const workers = 4
+
+	for name, newStore := range storagetest.Storages[int, int](t, storagetest.All(), storage.CapabilityParallelRange) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+
+			for i := 0; i < parallelRangeTestEntries; i++ {
+				store.Store(ctx, i, i)
+			}
+
+			var calls atomic.Int64
+			err := store.(storage.IMightyMapParallelRangeStorage[int, int]).ParallelRange(ctx, workers, func(int, int) bool {
+				return calls.Add(1) < 10
+			})
+			if err != nil {
+				t.Fatalf("ParallelRange() error: %v", err)
+			}
+			// every worker may finish the call it started before the stop was observed
+			if n := calls.Load(); n < 10 || n > 10+workers {
+				t.Errorf("callback called %d times after stopping at 10", n)
+			}
+		})
+	}
+}
+
+func TestParallelRangeCancel(t *testing.T) {
+	for name, newStore := range storagetest.Storages[int, int](t, storagetest.All(), storage.CapabilityParallelRange) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(context.Background())
+
+			for i := 0; i < parallelRangeTestEntries; i++ {
+				store.Store(context.Background(), i, i)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			var calls atomic.Int64
+			err := store.(storage.IMightyMapParallelRangeStorage[int, int]).ParallelRange(ctx, 4, func(int, int) bool {
+				if calls.Add(1) == 5 {
+					cancel()
+				}
+				return true
+			})
+			if err != context.Canceled {
+				t.Errorf("ParallelRange() error = %v; want context.Canceled", err)
+			}
+			if calls.Load() >= parallelRangeTestEntries {
+				t.Error("scan continued after the context was cancelled")
+			}
+		})
+	}
+}
+
+func TestParallelRangeEmpty(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newStore := range storagetest.Storages[int, int](t, storagetest.All(), storage.CapabilityParallelRange) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+
+			err := store.(storage.IMightyMapParallelRangeStorage[int, int]).ParallelRange(ctx, 4, func(int, int) bool {
+				t.Error("callback called on an empty storage")
+				return true
+			})
+			if err != nil {
+				t.Fatalf("ParallelRange() error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import "container/heap"
+
+// priorityIndex keeps the keys stored with a priority of the in-memory storages in a max-heap,
+// so Next finds the entry with the highest priority without scanning. Keys with equal priority
+// are ordered by the sequence number they got when their priority was set. The map is only
+// allocated once a priority is set. All methods must be called with the storage write lock held.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+type priorityIndex[K comparable] struct {
+	items   map[K]*priorityItem[K]
+	heap    priorityHeap[K]
+	lastSeq uint64
+}
+
+type priorityItem[K comparable] struct {
+	key      K
+	priority int
+	seq      uint64
+	index    int
+}
+
+// priorityHeap implements heap.Interface with the highest priority, then the lowest sequence
+// number, first.
+type priorityHeap[K comparable] []*priorityItem[K]
+
+func (h priorityHeap[K]) Len() int { return len(h) }
+func (h priorityHeap[K]) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h priorityHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *priorityHeap[K]) Push(x any) {
+	item := x.(*priorityItem[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *priorityHeap[K]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// newPriorityIndex returns an empty index.
+func newPriorityIndex[K comparable]() *priorityIndex[K] {
+	return &priorityIndex[K]{}
+}
+
+// set gives key a priority. With requeue the key moves behind the keys that already have
+// the same priority, as if it was stored anew; otherwise it keeps its place among them.
+func (p *priorityIndex[K]) set(key K, priority int, requeue bool) {
+	if item, ok := p.items[key]; ok {
+		item.priority = priority
+		if requeue {
+			p.lastSeq++
+			item.seq = p.lastSeq
+		}
+		heap.Fix(&p.heap, item.index)
+		return
+	}
+	if p.items == nil {
+		p.items = make(map[K]*priorityItem[K])
+	}
+	p.lastSeq++
+	item := &priorityItem[K]{key: key, priority: priority, seq: p.lastSeq}
+	heap.Push(&p.heap, item)
+	p.items[key] = item
+}
+
+// remove drops the priority of key.
+func (p *priorityIndex[K]) remove(key K) {
+	if item, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, item.index)
+		delete(p.items, key)
+	}
+}
+
+// reset drops all priorities.
+func (p *priorityIndex[K]) reset() {
+	p.items = nil
+	p.heap = nil
+}
+
+// pop removes and returns the key with the highest priority.
+func (p *priorityIndex[K]) pop() (key K, ok bool) {
+	if len(p.heap) == 0 {
+		return key, false
+	}
+	item := heap.Pop(&p.heap).(*priorityItem[K])
+	delete(p.items, item.key)
+	return item.key, true
+}
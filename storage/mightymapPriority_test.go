@@ -0,0 +1,116 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thisisdevelopment/mightymap/internal/storagetest"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+// drain empties store with Next and returns the keys and values in the order they were returned.
+func drain(ctx context.Context, store storage.IMightyMapStorage[string, int]) (keys []string, values []int) {
+	for {
+		key, value, ok := store.Next(ctx)
+		if !ok {
+			return keys, values
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+}
+
+func TestPriorityNext(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newStore := range storagetest.Storages[string, int](t, storagetest.All(), storage.CapabilityPriority) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+			p := store.(storage.IMightyMapPriorityStorage[string, int])
+
+			store.Store(ctx, "plain", 0)
+			for _, e := range []struct {
+				key      string
+				value    int
+				priority int
+			}{
+				{"low", 1, 1},
+				{"high", 2, 10},
+				{"first", 3, 5},
+				{"second", 4, 5},
+				{"negative", 5, -3},
+			} {
+				if err := p.StoreWithPriority(ctx, e.key, e.value, e.priority); err != nil {
+					t.Fatalf("StoreWithPriority(%q) error: %v", e.key, err)
+				}
+			}
+
+			// raising a priority keeps the value, storing again keeps the priority
+			if ok, err := p.SetPriority(ctx, "low", 20); !ok || err != nil {
+				t.Fatalf("SetPriority() = %v, %v; want true, nil", ok, err)
+			}
+			if ok, err := p.SetPriority(ctx, "missing", 20); ok || err != nil {
+				t.Errorf("SetPriority() of a missing key = %v, %v; want false, nil", ok, err)
+			}
+			store.Store(ctx, "first", 33)
+
+			keys, values := drain(ctx, store)
+			wantKeys := []string{"low", "high", "first", "second", "negative", "plain"}
+			wantValues := []int{1, 2, 33, 4, 5, 0}
+			if !reflect.DeepEqual(keys, wantKeys) || !reflect.DeepEqual(values, wantValues) {
+				t.Errorf("Next() returned %v %v; want %v %v", keys, values, wantKeys, wantValues)
+			}
+
+			// a deleted key loses its priority
+			if err := p.StoreWithPriority(ctx, "deleted", 1, 100); err != nil {
+				t.Fatalf("StoreWithPriority() error: %v", err)
+			}
+			store.Delete(ctx, "deleted")
+			store.Store(ctx, "deleted", 2)
+			if err := p.StoreWithPriority(ctx, "urgent", 3, 1); err != nil {
+				t.Fatalf("StoreWithPriority() error: %v", err)
+			}
+			keys, _ = drain(ctx, store)
+			if want := []string{"urgent", "deleted"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("Next() returned %v; want %v", keys, want)
+			}
+		})
+	}
+}
+
+func TestPriorityReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for name, open := range map[string]func() storage.IMightyMapStorage[string, int]{
+		"SQLite": func() storage.IMightyMapStorage[string, int] {
+			return storage.NewMightyMapSQLiteStorage[string, int](storage.WithSQLiteDBPath(filepath.Join(dir, "priority.db")))
+		},
+		"Badger": func() storage.IMightyMapStorage[string, int] {
+			return storage.NewMightyMapBadgerStorage[string, int](storage.WithTempDir(filepath.Join(dir, "badger")), storage.WithMemoryStorage(false))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			p := store.(storage.IMightyMapPriorityStorage[string, int])
+			store.Store(ctx, "a", 1)
+			if err := p.StoreWithPriority(ctx, "b", 2, 1); err != nil {
+				t.Fatalf("StoreWithPriority() error: %v", err)
+			}
+			if err := p.StoreWithPriority(ctx, "c", 3, 2); err != nil {
+				t.Fatalf("StoreWithPriority() error: %v", err)
+			}
+			store.Close(ctx)
+
+			store = open()
+			defer store.Close(ctx)
+			keys, _ := drain(ctx, store)
+			if want := []string{"c", "b", "a"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("Next() after reopening returned %v; want %v", keys, want)
+			}
+		})
+	}
+}
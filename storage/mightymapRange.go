@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrReentrantWrite is the panic value of a write to the default or Swiss storage from inside a
+// Range callback when snapshot ranges are disabled, so Range holds the read lock the write would
+// wait for forever. Keep snapshot ranges enabled to write from Range callbacks.
+var ErrReentrantWrite = errors.New("mightymap: write from inside Range while it holds the read lock")
+
+// lock takes the write lock of mutex, first panicking with ErrReentrantWrite if the calling
+// goroutine holds the read lock in a Range callback.
+func (g *rangeGuard) lock(mutex *sync.RWMutex) {
+	g.check()
+	mutex.Lock()
+}
+
+// rangeGuard tracks the goroutines running Range callbacks under the read lock of a storage, so
+// that their writes panic instead of waiting for a lock they hold themselves. Go offers no cheap
+// goroutine identity, so only Range pays for looking it up; writes only do while a callback runs.
+type rangeGuard struct {
+	// active counts the callbacks running, so writes only look up the goroutine when there are any
+	active     atomic.Int32
+	mu         sync.Mutex
+	goroutines map[uint64]int
+}
+
+// newRangeGuard returns a guard without running callbacks.
+func newRangeGuard() *rangeGuard {
+	return &rangeGuard{goroutines: make(map[uint64]int)}
+}
+
+// enter records that the calling goroutine is about to run Range callbacks and returns its id
+// for leave.
+func (g *rangeGuard) enter() uint64 {
+	id := goroutineID()
+	g.mu.Lock()
+	g.goroutines[id]++
+	g.mu.Unlock()
+	g.active.Add(1)
+	return id
+}
+
+// leave undoes enter.
+func (g *rangeGuard) leave(id uint64) {
+	g.active.Add(-1)
+	g.mu.Lock()
+	if g.goroutines[id]--; g.goroutines[id] == 0 {
+		delete(g.goroutines, id)
+	}
+	g.mu.Unlock()
+}
+
+// check panics with ErrReentrantWrite if the calling goroutine is running a Range callback.
+func (g *rangeGuard) check() {
+	if g.active.Load() == 0 {
+		return
+	}
+	id := goroutineID()
+	g.mu.Lock()
+	inside := g.goroutines[id] > 0
+	g.mu.Unlock()
+	if inside {
+		panic(ErrReentrantWrite)
+	}
+}
+
+// goroutineID returns the id of the calling goroutine, parsed from the header of its stack trace
+// "goroutine 42 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
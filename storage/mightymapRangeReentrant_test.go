@@ -0,0 +1,74 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+// recoverReentrant runs f and returns the error it panicked with.
+func recoverReentrant(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, _ = r.(error)
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestRangeReentrantWrite(t *testing.T) {
+	ctx := context.Background()
+	for name, newStore := range rangeStorages(t, false) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+			store.Store(ctx, 1, 1)
+			store.Store(ctx, 2, 2)
+
+			// writes go to the key being visited, other shards of a sharded storage are not locked
+			writes := map[string]func(key int){
+				"Store":  func(key int) { store.Store(ctx, key, 3) },
+				"Delete": func(key int) { store.Delete(ctx, key) },
+				"Clear":  func(int) { store.Clear(ctx) },
+			}
+			if name != "SwissShardedLocked" {
+				writes["Next"] = func(int) { store.Next(ctx) }
+				writes["StoreAt"] = func(key int) {
+					_ = store.(storage.IMightyMapScheduleStorage[int, int]).StoreAt(ctx, key, 4, time.Now())
+				}
+			}
+			for op, write := range writes {
+				var err error
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					store.Range(ctx, func(key, _ int) bool {
+						err = recoverReentrant(func() { write(key) })
+						return false
+					})
+				}()
+				select {
+				case <-done:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("%s from inside Range() deadlocked", op)
+				}
+				if !errors.Is(err, storage.ErrReentrantWrite) {
+					t.Errorf("%s from inside Range() panicked with %v; want ErrReentrantWrite", op, err)
+				}
+			}
+
+			// the failed writes changed nothing and released nothing they did not take
+			if n := store.Len(ctx); n != 2 {
+				t.Errorf("Len() = %d; want 2", n)
+			}
+			store.Store(ctx, 3, 3)
+			if n := store.Len(ctx); n != 3 {
+				t.Errorf("Len() = %d; want 3", n)
+			}
+		})
+	}
+}
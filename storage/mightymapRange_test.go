@@ -0,0 +1,60 @@
+package storage_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/thisisdevelopment/mightymap/internal/storagetest"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+// rangeStorages returns the storages that hold their lock during Range when snapshot ranges are
+// disabled.
+func rangeStorages(t *testing.T, snapshot bool) map[string]func(t testing.TB) storage.IMightyMapStorage[int, int] {
+	var configs []storagetest.Config
+	for _, b := range []storagetest.Backend{storagetest.Default, storagetest.Swiss, storagetest.SwissEncoded, storagetest.SwissSharded} {
+		configs = append(configs, storagetest.Config{Backend: b, LockedRange: !snapshot})
+	}
+	return storagetest.Storages[int, int](t, configs)
+}
+
+func TestRangeSnapshot(t *testing.T) {
+	ctx := context.Background()
+	for name, newStore := range rangeStorages(t, true) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+			for i := 0; i < 10; i++ {
+				store.Store(ctx, i, i)
+			}
+
+			var visited []int
+			store.Range(ctx, func(key, value int) bool {
+				visited = append(visited, key)
+				if key%2 == 0 {
+					// deleted keys are skipped, stored keys are not visited
+					store.Delete(ctx, key+1)
+					store.Store(ctx, key+100, key)
+				}
+				store.Store(ctx, key, value*10)
+				return true
+			})
+
+			sort.Ints(visited)
+			for _, key := range visited {
+				if key >= 100 {
+					t.Errorf("Range() visited %d, which was stored during the iteration", key)
+				}
+			}
+			for i := 0; i < 10; i++ {
+				if v, ok := store.Load(ctx, i); ok && v != i*10 {
+					t.Errorf("Load(%d) = %d; want %d", i, v, i*10)
+				}
+			}
+			if len(visited) < 5 || len(visited) > 10 {
+				t.Errorf("Range() visited %v; want every even key and the odd keys not deleted first", visited)
+			}
+		})
+	}
+}
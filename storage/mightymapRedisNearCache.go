@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// redisMetaPrefix namespaces the bookkeeping keys and channels used by the Redis storage.
+	// It is deliberately not derived from the key prefix so SCAN patterns never match it.
+	redisMetaPrefix = "__mightymap__:"
+	// redisNearCacheRetryDelay is the pause between failed pub/sub receives before retrying
+	redisNearCacheRetryDelay = 100 * time.Millisecond
+	// redisNearCacheTouchFraction limits how often hits restart the sliding expiration of a key in
+	// Redis: at most once per this fraction of the expiration.
+	redisNearCacheTouchFraction = 10
+)
+
+// redisNearCache wraps the Redis storage with a bounded, in-process LRU cache of decoded values.
+//
+// Every write made through a mightymap instance publishes an invalidation message on a
+// per-map channel; every instance subscribes to that channel and evicts the affected key.
+// An empty message flushes the whole cache (used by Clear).
+//
+// Consistency guarantees:
+//   - A writer never serves its own stale value: the local entry is evicted before Store,
+//     Delete, Clear or Next return.
+//   - Other instances may serve the previous value until they receive the invalidation
+//     message, which normally takes a single network round trip.
+//   - A Load racing with an invalidation never caches the value it read, so once the
+//     invalidation has been delivered the stale value cannot reappear.
+//   - Redis pub/sub is at-most-once. Whenever the subscription errors or is
+//     re-established after a reconnect, the complete cache is flushed.
+//   - Writes that bypass mightymap (e.g. redis-cli, key expiry) are not observed; use
+//     WithRedisNearCacheTTL to bound how long such changes can go unnoticed. With WithRedisExpire
+//     the TTL is at most the expiration, so an expired key is served for less than that.
+//   - A failed publish is logged; the other instances then serve the previous value until
+//     their TTL passes or their subscription reconnects.
+//
+// With WithRedisSlidingExpiration, hits restart the expiration of the key in Redis, at most once
+// per tenth of the expiration, so keys that are only read from the cache do not expire.
+//
+// Cached values are shared between callers and must be treated as read-only.
+type redisNearCache[K comparable, V any] struct {
+	*msgpackAdapter[K, V]
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	channel string
+	timeout time.Duration
+
+	mu      sync.Mutex
+	entries map[K]*list.Element
+	lru     *list.List
+	size    int
+	ttl     time.Duration
+	touch   time.Duration
+	epoch   uint64
+	closed  bool
+	done    chan struct{}
+}
+
+type redisNearCacheEntry[K comparable, V any] struct {
+	key       K
+	value     V
+	cachedAt  time.Time
+	touchedAt time.Time
+}
+
+// newRedisNearCache subscribes to the invalidation channel of the map and starts the
+// background goroutine that applies invalidations.
+// Panics if the subscription cannot be established.
+func newRedisNearCache[K comparable, V any](adapter *msgpackAdapter[K, V], client *redis.Client, opts *redisOpts) *redisNearCache[K, V] {
+	c := &redisNearCache[K, V]{
+		msgpackAdapter: adapter,
+		client:         client,
+		channel:        redisMetaPrefix + opts.prefix + ":invalidate",
+		timeout:        opts.timeout,
+		entries:        make(map[K]*list.Element),
+		lru:            list.New(),
+		size:           opts.nearCacheSize,
+		ttl:            opts.nearCacheTTL,
+		done:           make(chan struct{}),
+	}
+	if opts.expire > 0 && (c.ttl <= 0 || c.ttl > opts.expire) {
+		// keys expiring in Redis publish no invalidation
+		c.ttl = opts.expire
+	}
+	if opts.slidingExpiration && opts.expire > 0 {
+		c.touch = opts.expire / redisNearCacheTouchFraction
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	c.pubsub = client.Subscribe(ctx, c.channel)
+	// wait for the subscription to be confirmed so no invalidation published after
+	// the constructor returns can be missed
+	if _, err := c.pubsub.ReceiveTimeout(ctx, opts.timeout); err != nil {
+		_ = c.pubsub.Close()
+		panic(err)
+	}
+
+	go c.listen()
+	return c
+}
+
+// listen applies invalidation messages until the cache is closed.
+func (c *redisNearCache[K, V]) listen() {
+	defer close(c.done)
+	for {
+		msg, err := c.pubsub.Receive(context.Background())
+		if c.isClosed() {
+			return
+		}
+		if err != nil {
+			// messages may have been lost while the connection was broken
+			c.flush()
+			time.Sleep(redisNearCacheRetryDelay)
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			// (re)subscribed after a reconnect, anything could have changed meanwhile
+			c.flush()
+		case *redis.Message:
+			if m.Payload == "" {
+				c.flush()
+				continue
+			}
+			var key K
+			if err := msgpack.Unmarshal([]byte(m.Payload), &key); err != nil {
+				log.Printf("error: unmarshalling invalidated key: '%v' err: %v", m.Payload, err)
+				c.flush()
+				continue
+			}
+			c.evict(key)
+		}
+	}
+}
+
+// Load returns the cached value for key, falling back to Redis on a miss. With sliding
+// expiration a hit restarts the expiration in Redis if it was not restarted recently.
+func (c *redisNearCache[K, V]) Load(ctx context.Context, key K) (value V, ok bool) {
+	c.mu.Lock()
+	if e, hit := c.entries[key]; hit {
+		entry := e.Value.(*redisNearCacheEntry[K, V])
+		if c.ttl <= 0 || time.Since(entry.cachedAt) < c.ttl {
+			c.lru.MoveToFront(e)
+			touch := c.touch > 0 && time.Since(entry.touchedAt) >= c.touch
+			if touch {
+				entry.touchedAt = time.Now()
+			}
+			c.mu.Unlock()
+			if touch {
+				if err := c.msgpackAdapter.Touch(ctx, key); err != nil {
+					log.Printf("error: restarting expiration of cached key: '%v' err: %v", key, err)
+				}
+			}
+			return entry.value, true
+		}
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+	epoch := c.epoch
+	c.mu.Unlock()
+
+	value, ok = c.msgpackAdapter.Load(ctx, key)
+	if !ok {
+		return value, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// an invalidation arrived while we were reading; the value may already be stale
+	if c.epoch != epoch || c.closed {
+		return value, true
+	}
+	if e, hit := c.entries[key]; hit {
+		entry := e.Value.(*redisNearCacheEntry[K, V])
+		entry.value = value
+		entry.cachedAt = time.Now()
+		entry.touchedAt = entry.cachedAt
+		c.lru.MoveToFront(e)
+		return value, true
+	}
+	now := time.Now()
+	c.entries[key] = c.lru.PushFront(&redisNearCacheEntry[K, V]{key: key, value: value, cachedAt: now, touchedAt: now})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*redisNearCacheEntry[K, V]).key)
+	}
+	return value, true
+}
+
+// Store writes the value to Redis and invalidates the key in every instance.
+func (c *redisNearCache[K, V]) Store(ctx context.Context, key K, value V) {
+	c.msgpackAdapter.Store(ctx, key, value)
+	c.invalidate(ctx, key)
+}
+
+// Delete removes the keys from Redis and invalidates them in every instance.
+func (c *redisNearCache[K, V]) Delete(ctx context.Context, keys ...K) {
+	c.msgpackAdapter.Delete(ctx, keys...)
+	c.invalidate(ctx, keys...)
+}
+
+// StoreWithPriority writes the value and its priority to Redis and invalidates the key in every
+// instance.
+func (c *redisNearCache[K, V]) StoreWithPriority(ctx context.Context, key K, value V, priority int) error {
+	if err := c.msgpackAdapter.StoreWithPriority(ctx, key, value, priority); err != nil {
+		return err
+	}
+	c.invalidate(ctx, key)
+	return nil
+}
+
+// Next pops an entry from Redis and invalidates it in every instance.
+func (c *redisNearCache[K, V]) Next(ctx context.Context) (key K, value V, ok bool) {
+	key, value, ok = c.msgpackAdapter.Next(ctx)
+	if ok {
+		c.invalidate(ctx, key)
+	}
+	return key, value, ok
+}
+
+// NextWait waits for an entry, pops it from Redis and invalidates it in every instance.
+func (c *redisNearCache[K, V]) NextWait(ctx context.Context) (key K, value V, err error) {
+	key, value, err = c.msgpackAdapter.NextWait(ctx)
+	if err == nil {
+		c.invalidate(ctx, key)
+	}
+	return key, value, err
+}
+
+// StoreAt schedules the value in Redis and invalidates the key in every instance, as the
+// value visible until then is hidden.
+func (c *redisNearCache[K, V]) StoreAt(ctx context.Context, key K, value V, visibleAt time.Time) error {
+	if err := c.msgpackAdapter.StoreAt(ctx, key, value, visibleAt); err != nil {
+		return err
+	}
+	c.invalidate(ctx, key)
+	return nil
+}
+
+// NextDue pops a due scheduled entry from Redis and invalidates it in every instance.
+func (c *redisNearCache[K, V]) NextDue(ctx context.Context) (key K, value V, ok bool) {
+	key, value, ok = c.msgpackAdapter.NextDue(ctx)
+	if ok {
+		c.invalidate(ctx, key)
+	}
+	return key, value, ok
+}
+
+// Clear removes all entries from Redis and flushes every instance.
+func (c *redisNearCache[K, V]) Clear(ctx context.Context) {
+	c.msgpackAdapter.Clear(ctx)
+	c.flush()
+	c.publish(ctx, "")
+}
+
+// Close stops the invalidation listener and closes the underlying storage.
+func (c *redisNearCache[K, V]) Close(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	_ = c.pubsub.Close()
+	<-c.done
+	c.flush()
+	return c.msgpackAdapter.Close(ctx)
+}
+
+func (c *redisNearCache[K, V]) invalidate(ctx context.Context, keys ...K) {
+	for _, key := range keys {
+		c.evict(key)
+		keyBytes, err := msgpack.Marshal(key)
+		if err != nil {
+			// the write is done, so flush every instance instead of failing it
+			log.Printf("error: marshalling invalidated key: '%v' err: %v", key, err)
+			c.publish(ctx, "")
+			continue
+		}
+		c.publish(ctx, string(keyBytes))
+	}
+}
+
+// publish sends an invalidation message. It runs after the write succeeded, so a failure is only
+// logged.
+func (c *redisNearCache[K, V]) publish(ctx context.Context, payload string) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if err := c.client.Publish(ctx, c.channel, payload).Err(); err != nil {
+		log.Printf("error: publishing invalidation on channel: '%v' err: %v", c.channel, err)
+	}
+}
+
+func (c *redisNearCache[K, V]) evict(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	if e, ok := c.entries[key]; ok {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+func (c *redisNearCache[K, V]) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.entries = make(map[K]*list.Element)
+	c.lru.Init()
+}
+
+func (c *redisNearCache[K, V]) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// waitFor polls cond until it returns true or the timeout elapses.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newNearCachedRedisStorage(t *testing.T, mr *miniredis.Miniredis, size int) *redisNearCache[string, int] {
+	t.Helper()
+	store := NewMightyMapRedisStorage[string, int](
+		WithRedisAddr(mr.Addr()),
+		WithRedisPrefix("near:"),
+		WithRedisNearCache(size),
+	)
+	nc, ok := store.(*redisNearCache[string, int])
+	if !ok {
+		t.Fatalf("expected near cache storage, got %T", store)
+	}
+	return nc
+}
+
+func (c *redisNearCache[K, V]) cached(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+// loadCached loads key until it is cached; a Load racing with a pending invalidation
+// deliberately does not populate the cache.
+func loadCached[K comparable, V any](t *testing.T, c *redisNearCache[K, V], key K) {
+	t.Helper()
+	waitFor(t, time.Second, func() bool {
+		c.Load(context.Background(), key)
+		return c.cached(key)
+	})
+}
+
+func TestRedisNearCache(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	a := newNearCachedRedisStorage(t, mr, 100)
+	defer a.Close(ctx)
+	b := newNearCachedRedisStorage(t, mr, 100)
+	defer b.Close(ctx)
+
+	t.Run("Load populates cache", func(t *testing.T) {
+		a.Store(ctx, "key1", 1)
+		if v, ok := b.Load(ctx, "key1"); !ok || v != 1 {
+			t.Fatalf("Load() = %v, %v; want 1, true", v, ok)
+		}
+		loadCached(t, b, "key1")
+
+		// served from the cache even though redis no longer has it
+		mr.Del("near:" + mustMarshalKey(t, "key1"))
+		if v, ok := b.Load(ctx, "key1"); !ok || v != 1 {
+			t.Fatalf("cached Load() = %v, %v; want 1, true", v, ok)
+		}
+	})
+
+	t.Run("Store invalidates other instances", func(t *testing.T) {
+		a.Store(ctx, "key2", 2)
+		loadCached(t, b, "key2")
+		a.Store(ctx, "key2", 20)
+
+		waitFor(t, time.Second, func() bool { return !b.cached("key2") })
+		if v, ok := b.Load(ctx, "key2"); !ok || v != 20 {
+			t.Fatalf("Load() after invalidation = %v, %v; want 20, true", v, ok)
+		}
+	})
+
+	t.Run("Writer never serves its own stale value", func(t *testing.T) {
+		a.Store(ctx, "key3", 3)
+		a.Load(ctx, "key3")
+		a.Store(ctx, "key3", 30)
+		if v, ok := a.Load(ctx, "key3"); !ok || v != 30 {
+			t.Fatalf("Load() = %v, %v; want 30, true", v, ok)
+		}
+	})
+
+	t.Run("Delete and Next invalidate", func(t *testing.T) {
+		a.Clear(ctx)
+		a.Store(ctx, "key4", 4)
+		loadCached(t, b, "key4")
+		a.Delete(ctx, "key4")
+		waitFor(t, time.Second, func() bool { return !b.cached("key4") })
+		if _, ok := b.Load(ctx, "key4"); ok {
+			t.Fatal("Load() returned deleted key")
+		}
+
+		a.Store(ctx, "key5", 5)
+		loadCached(t, b, "key5")
+		if k, _, ok := a.Next(ctx); !ok || k != "key5" {
+			t.Fatalf("Next() = %v, %v; want key5, true", k, ok)
+		}
+		waitFor(t, time.Second, func() bool { return !b.cached("key5") })
+	})
+
+	t.Run("Clear flushes other instances", func(t *testing.T) {
+		a.Store(ctx, "key6", 6)
+		a.Store(ctx, "key7", 7)
+		loadCached(t, b, "key6")
+		loadCached(t, b, "key7")
+		a.Clear(ctx)
+		waitFor(t, time.Second, func() bool { return !b.cached("key6") && !b.cached("key7") })
+	})
+
+	t.Run("Resubscribe flushes cache", func(t *testing.T) {
+		a.Store(ctx, "key8", 8)
+		loadCached(t, b, "key8")
+		// dropping the connection makes the client reconnect and resubscribe
+		mr.Close()
+		if err := mr.Restart(); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, 5*time.Second, func() bool { return !b.cached("key8") })
+	})
+}
+
+func TestRedisNearCacheBounded(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	store := newNearCachedRedisStorage(t, mr, 2)
+	defer store.Close(ctx)
+
+	store.Store(ctx, "a", 1)
+	store.Store(ctx, "b", 2)
+	store.Store(ctx, "c", 3)
+	loadCached(t, store, "a")
+	loadCached(t, store, "b")
+	store.Load(ctx, "a")
+	loadCached(t, store, "c")
+
+	if store.cached("b") {
+		t.Error("expected least recently used key b to be evicted")
+	}
+	if !store.cached("a") || !store.cached("c") {
+		t.Error("expected keys a and c to be cached")
+	}
+}
+
+func TestRedisNearCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	store := NewMightyMapRedisStorage[string, int](
+		WithRedisAddr(mr.Addr()),
+		WithRedisNearCache(10),
+		WithRedisNearCacheTTL(20*time.Millisecond),
+	)
+	defer store.Close(ctx)
+
+	store.Store(ctx, "key", 1)
+	loadCached(t, store.(*redisNearCache[string, int]), "key")
+	mr.Del("mightymap_" + mustMarshalKey(t, "key"))
+
+	if _, ok := store.Load(ctx, "key"); !ok {
+		t.Fatal("expected cached value before the ttl elapsed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := store.Load(ctx, "key"); ok {
+		t.Fatal("expected cached value to be refreshed after the ttl elapsed")
+	}
+}
+
+func TestRedisNearCacheExpire(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	store := NewMightyMapRedisStorage[string, int](
+		WithRedisAddr(mr.Addr()),
+		WithRedisExpire(50*time.Millisecond),
+		WithRedisNearCache(10),
+	)
+	defer store.Close(ctx)
+
+	store.Store(ctx, "key", 1)
+	loadCached(t, store.(*redisNearCache[string, int]), "key")
+	mr.FastForward(60 * time.Millisecond)
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := store.Load(ctx, "key"); ok {
+		t.Fatal("expected a key expired in Redis not to be served from the near cache")
+	}
+}
+
+func TestRedisNearCachePublishFailure(t *testing.T) {
+	mr := miniredis.RunT(t)
+	nc := newNearCachedRedisStorage(t, mr, 10)
+	defer nc.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the write is done by the time it publishes, so a failure must not panic
+	nc.publish(ctx, "")
+}
+
+func TestRedisNearCacheDisabledByDefault(t *testing.T) {
+	store := NewMightyMapRedisStorage[string, int](WithRedisMock(t))
+	defer store.Close(context.Background())
+	if _, ok := store.(*redisNearCache[string, int]); ok {
+		t.Fatal("near cache should be disabled by default")
+	}
+}
+
+func mustMarshalKey(t *testing.T, key string) string {
+	t.Helper()
+	b, err := msgpack.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRedisNearCacheSlidingExpiration(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	store := NewMightyMapRedisStorage[string, int](
+		WithRedisAddr(mr.Addr()),
+		WithRedisExpire(100*time.Millisecond),
+		WithRedisSlidingExpiration(true),
+		WithRedisNearCache(10),
+	)
+	defer store.Close(ctx)
+
+	store.Store(ctx, "key", 1)
+	loadCached(t, store.(*redisNearCache[string, int]), "key")
+	time.Sleep(20 * time.Millisecond)
+	mr.FastForward(60 * time.Millisecond)
+
+	// a hit restarts the expiration in Redis
+	if _, ok := store.Load(ctx, "key"); !ok {
+		t.Fatal("expected cached value")
+	}
+	mr.FastForward(60 * time.Millisecond)
+	if !mr.Exists("mightymap_" + mustMarshalKey(t, "key")) {
+		t.Fatal("expected a cache hit to restart the expiration in Redis")
+	}
+}
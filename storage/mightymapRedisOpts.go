@@ -19,6 +19,15 @@ type redisOpts struct {
 	timeout    time.Duration
 	expire     time.Duration
 	mock       *testing.T
+
+	slidingExpiration bool
+	nearCacheSize     int
+	nearCacheTTL      time.Duration
+	ordering          Ordering
+	pollInterval      time.Duration
+	scheduling        bool
+	priorities        bool
+	notifications     bool
 }
 
 type OptionFuncRedis func(*redisOpts)
@@ -32,6 +41,70 @@ func WithRedisExpire(expire time.Duration) OptionFuncRedis {
 	}
 }
 
+// WithRedisSlidingExpiration makes Load refresh the expiration set by WithRedisExpire (using GETEX),
+// so keys expire after their last access instead of their last write.
+// Only effective together with WithRedisExpire. Loads answered by the near cache
+// (WithRedisNearCache) refresh the expiration with EXPIRE at most once per tenth of it.
+func WithRedisSlidingExpiration(sliding bool) OptionFuncRedis {
+	return func(opts *redisOpts) {
+		opts.slidingExpiration = sliding
+	}
+}
+
+// WithRedisOrdering sets the order of Next, Range and Keys. FIFO keeps the keys in a sorted
+// set scored by an insertion sequence number, next to the values, so Next and Range no longer
+// depend on SCAN order. Store then runs a script that writes the value and its position
+// atomically. Every storage sharing the prefix must use the same ordering.
+// **Default value**: `Unordered`
+func WithRedisOrdering(ordering Ordering) OptionFuncRedis {
+	return func(opts *redisOpts) {
+		opts.ordering = ordering
+	}
+}
+
+// WithRedisNextWaitPollInterval sets how long NextWait blocks on the notification list before it
+// looks for entries again, which bounds how long it misses entries written by other clients
+// than mightymap, or by any client without WithRedisStoreNotifications. Redis blocks for whole
+// seconds.
+// **Default value**: `1s`
+func WithRedisNextWaitPollInterval(interval time.Duration) OptionFuncRedis {
+	return func(opts *redisOpts) {
+		opts.pollInterval = interval
+	}
+}
+
+// WithRedisScheduling enables StoreAt, StoreAfter and NextDue. Store and Delete then also drop a
+// pending schedule of their key, and reads first promote the entries that have become due.
+// Without it those methods return ErrNotSupported and Store and Delete only touch the key.
+// Every storage sharing the prefix must use the same setting.
+// **Default value**: `false`
+func WithRedisScheduling(enabled bool) OptionFuncRedis {
+	return func(opts *redisOpts) {
+		opts.scheduling = enabled
+	}
+}
+
+// WithRedisPriorities enables StoreWithPriority and SetPriority. Delete then also drops the
+// priority of its keys, and Next looks for the entry with the highest priority first.
+// Without it those methods return ErrNotSupported.
+// Every storage sharing the prefix must use the same setting.
+// **Default value**: `false`
+func WithRedisPriorities(enabled bool) OptionFuncRedis {
+	return func(opts *redisOpts) {
+		opts.priorities = enabled
+	}
+}
+
+// WithRedisStoreNotifications makes every write push a notification that wakes up NextWait
+// callers in all processes sharing the prefix. Without it NextWait still works, but notices new
+// entries only once per WithRedisNextWaitPollInterval.
+// **Default value**: `false`
+func WithRedisStoreNotifications(enabled bool) OptionFuncRedis {
+	return func(opts *redisOpts) {
+		opts.notifications = enabled
+	}
+}
+
 // WithRedisTimeout sets the timeout duration for Redis client operations.
 // This timeout value is used to create a context with timeout for Redis operations.
 // It helps prevent operations from hanging indefinitely.
@@ -123,6 +196,28 @@ func WithRedisPrefix(prefix string) OptionFuncRedis {
 	}
 }
 
+// WithRedisNearCache enables a bounded in-process cache of decoded values in front of Redis.
+// The size parameter is the maximum number of cached entries, least recently used entries are
+// evicted first. Writes through any mightymap instance using the same prefix publish an
+// invalidation message that every instance applies; see redisNearCache for the exact
+// consistency guarantees. A size of 0 (the default) disables the cache.
+func WithRedisNearCache(size int) OptionFuncRedis {
+	return func(opts *redisOpts) {
+		opts.nearCacheSize = size
+	}
+}
+
+// WithRedisNearCacheTTL bounds how long an entry may be served from the near cache before it is
+// read from Redis again. This limits staleness caused by changes the invalidation channel cannot
+// see, such as keys expiring through WithRedisExpire or writes made by other Redis clients.
+// A ttl of 0 (the default) keeps entries until they are invalidated or evicted. With
+// WithRedisExpire the ttl is capped at the expiration, which is also its default then.
+func WithRedisNearCacheTTL(ttl time.Duration) OptionFuncRedis {
+	return func(opts *redisOpts) {
+		opts.nearCacheTTL = ttl
+	}
+}
+
 // WithRedisMock (not implemented) sets the Redis client to use a mock implementation.
 // This is useful for testing and development environments where a real Redis server is not available.
 func WithRedisMock(t *testing.T) OptionFuncRedis {
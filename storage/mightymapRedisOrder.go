@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// redisStoreOrderedScript stores a value and, unless the key exists, appends it to the order
+// sorted set with the next sequence number. Keys that expired are appended again. Like Store
+// without ordering it notifies NextWait, see notifyStored, unless the backlog is 0.
+//
+// KEYS: data key, order set, sequence counter, notification list.
+// ARGV: value, member, expiration in milliseconds, notification backlog.
+var redisStoreOrderedScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('ZADD', KEYS[2], redis.call('INCR', KEYS[3]), ARGV[2])
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call('RPUSH', KEYS[4], 1)
+	redis.call('LTRIM', KEYS[4], -tonumber(ARGV[4]), -1)
+end
+return 0
+`)
+
+// redisNextOrderedScript removes and returns the oldest entry of the order sorted set.
+// Members whose key has expired are dropped on the way.
+//
+// KEYS: order set. ARGV: key prefix.
+var redisNextOrderedScript = redis.NewScript(`
+while true do
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0)
+	if #oldest == 0 then
+		return false
+	end
+	redis.call('ZREM', KEYS[1], oldest[1])
+	local value = redis.call('GET', ARGV[1] .. oldest[1])
+	if value then
+		redis.call('DEL', ARGV[1] .. oldest[1])
+		return {oldest[1], value}
+	end
+end
+`)
+
+// orderKey returns the sorted set holding the keys in insertion order, scored by sequence number.
+func (c *mightyMapRedisStorage[K]) orderKey() string {
+	return redisMetaPrefix + c.opts.prefix + ":order"
+}
+
+// seqKey returns the counter the sequence numbers are taken from.
+func (c *mightyMapRedisStorage[K]) seqKey() string {
+	return redisMetaPrefix + c.opts.prefix + ":seq"
+}
+
+// storeOrdered is Store for FIFO ordering; the value and its position are written atomically.
+func (c *mightyMapRedisStorage[K]) storeOrdered(ctx context.Context, member string, value []byte) error {
+	keys := []string{c.opts.prefix + member, c.orderKey(), c.seqKey(), c.notifyKey()}
+	return redisStoreOrderedScript.Run(ctx, c.redisClient, keys, value, member, c.opts.expire.Milliseconds(), c.notifyBacklog()).Err()
+}
+
+// nextOrdered is Next for FIFO ordering. The oldest entry is read and removed by a single script,
+// so concurrent callers never receive the same entry.
+func (c *mightyMapRedisStorage[K]) nextOrdered(ctx context.Context) (key K, value []byte, ok bool) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	res, err := redisNextOrderedScript.Run(ctx, c.redisClient, []string{c.orderKey()}, c.opts.prefix).Slice()
+	if err == redis.Nil {
+		return key, nil, false
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	member, _ := res[0].(string)
+	v, _ := res[1].(string)
+	if err := msgpack.Unmarshal([]byte(member), &key); err != nil {
+		panic(err)
+	}
+	return key, []byte(v), true
+}
+
+// rangeOrdered is Range for FIFO ordering. It pages through the order sorted set by score and
+// fetches the values of every page with MGET; members whose key has expired are skipped.
+func (c *mightyMapRedisStorage[K]) rangeOrdered(ctx context.Context, f func(key K, value []byte) bool) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	from := "-inf"
+	for {
+		page, err := c.redisClient.ZRangeByScoreWithScores(ctx, c.orderKey(), &redis.ZRangeBy{
+			Min:   from,
+			Max:   "+inf",
+			Count: defaultRedisCursorSize,
+		}).Result()
+		if err != nil {
+			panic(err)
+		}
+		if len(page) == 0 {
+			return
+		}
+
+		keys := make([]string, len(page))
+		for i, z := range page {
+			keys[i] = c.opts.prefix + z.Member.(string)
+		}
+		values, err := c.redisClient.MGet(ctx, keys...).Result()
+		if err != nil {
+			panic(err)
+		}
+
+		for i, v := range values {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			var k K
+			if err := msgpack.Unmarshal([]byte(page[i].Member.(string)), &k); err != nil {
+				panic(err)
+			}
+			if !f(k, []byte(s)) {
+				return
+			}
+		}
+
+		if int64(len(page)) < defaultRedisCursorSize {
+			return
+		}
+		from = "(" + strconv.FormatFloat(page[len(page)-1].Score, 'f', -1, 64)
+	}
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// Priorities are kept in a sorted set scored by priority. Its members are ranks: a fixed-width
+// prefix followed by the key, where the prefix counts down as priorities are handed out, so
+// ZPOPMAX, which takes the lexicographically largest member among equal scores, returns the key
+// that got its priority first. A hash maps every key to its rank, so the priority of a key can be
+// changed or removed. Priorities are compared as doubles and are exact up to 2^53.
+
+// redisRankPrefix is the Lua expression computing the 15 digit prefix of a new rank from the
+// sequence counter KEYS[4] of the scripts that use it.
+const redisRankPrefix = `string.format('%015.0f', 1e15 - redis.call('INCR', KEYS[4]))`
+
+// redisStorePriorityScript stores a value with a priority, like redisStoreOrderedScript with the
+// ordered flag, and drops a pending schedule of the key.
+//
+// KEYS: data key, priority set, rank hash, sequence counter, notification list, order set,
+// due set, scheduled hash.
+// ARGV: value, member, expiration in milliseconds, ordered flag, notification backlog, priority.
+var redisStorePriorityScript = redis.NewScript(`
+redis.call('ZREM', KEYS[7], ARGV[2])
+redis.call('HDEL', KEYS[8], ARGV[2])
+if ARGV[4] == '1' and redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('ZADD', KEYS[6], redis.call('INCR', KEYS[4]), ARGV[2])
+end
+local old = redis.call('HGET', KEYS[3], ARGV[2])
+if old then
+	redis.call('ZREM', KEYS[2], old)
+end
+local rank = ` + redisRankPrefix + ` .. ARGV[2]
+redis.call('ZADD', KEYS[2], ARGV[6], rank)
+redis.call('HSET', KEYS[3], ARGV[2], rank)
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+if tonumber(ARGV[5]) > 0 then
+	redis.call('RPUSH', KEYS[5], 1)
+	redis.call('LTRIM', KEYS[5], -tonumber(ARGV[5]), -1)
+end
+return 0
+`)
+
+// redisSetPriorityScript changes the priority of an existing key, keeping its rank if it has one.
+// Returns 0 if the key does not exist.
+//
+// KEYS: data key, priority set, rank hash, sequence counter. ARGV: member, priority.
+var redisSetPriorityScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local rank = redis.call('HGET', KEYS[3], ARGV[1])
+if not rank then
+	rank = ` + redisRankPrefix + ` .. ARGV[1]
+	redis.call('HSET', KEYS[3], ARGV[1], rank)
+end
+redis.call('ZADD', KEYS[2], ARGV[2], rank)
+return 1
+`)
+
+// redisUnprioritizeScript drops the priority of a key.
+//
+// KEYS: priority set, rank hash. ARGV: member.
+var redisUnprioritizeScript = redis.NewScript(`
+local rank = redis.call('HGET', KEYS[2], ARGV[1])
+if rank then
+	redis.call('ZREM', KEYS[1], rank)
+	redis.call('HDEL', KEYS[2], ARGV[1])
+end
+return 0
+`)
+
+// redisNextPriorityScript removes and returns the entry with the highest priority. Ranks of keys
+// that have expired or were scheduled are dropped on the way.
+//
+// KEYS: priority set, rank hash, order set. ARGV: key prefix.
+var redisNextPriorityScript = redis.NewScript(`
+while true do
+	local top = redis.call('ZPOPMAX', KEYS[1])
+	if #top == 0 then
+		return false
+	end
+	local member = string.sub(top[1], 16)
+	redis.call('HDEL', KEYS[2], member)
+	redis.call('ZREM', KEYS[3], member)
+	local value = redis.call('GET', ARGV[1] .. member)
+	if value then
+		redis.call('DEL', ARGV[1] .. member)
+		return {member, value}
+	end
+end
+`)
+
+// priorityKey returns the sorted set of the ranks of the keys with a priority, scored by priority.
+func (c *mightyMapRedisStorage[K]) priorityKey() string {
+	return redisMetaPrefix + c.opts.prefix + ":priority"
+}
+
+// rankKey returns the hash mapping the keys with a priority to their rank.
+func (c *mightyMapRedisStorage[K]) rankKey() string {
+	return redisMetaPrefix + c.opts.prefix + ":rank"
+}
+
+// StoreWithPriority stores a value and its priority atomically in a single script.
+// Returns ErrNotSupported without WithRedisPriorities.
+func (c *mightyMapRedisStorage[K]) StoreWithPriority(ctx context.Context, key K, value []byte, priority int) error {
+	if !c.opts.priorities {
+		return ErrNotSupported
+	}
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	member := string(keyBytes)
+	keys := []string{
+		c.opts.prefix + member, c.priorityKey(), c.rankKey(), c.seqKey(), c.notifyKey(),
+		c.orderKey(), c.dueKey(), c.scheduledKey(),
+	}
+	return redisStorePriorityScript.Run(ctx, c.redisClient, keys, value, member,
+		c.opts.expire.Milliseconds(), c.orderedFlag(), c.notifyBacklog(), priority).Err()
+}
+
+// SetPriority changes the priority of a key with ZADD, leaving its value alone.
+// Returns false if the key does not exist or is scheduled, and ErrNotSupported without
+// WithRedisPriorities.
+func (c *mightyMapRedisStorage[K]) SetPriority(ctx context.Context, key K, priority int) (bool, error) {
+	if !c.opts.priorities {
+		return false, ErrNotSupported
+	}
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return false, err
+	}
+	c.promoteDue(ctx)
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	member := string(keyBytes)
+	keys := []string{c.opts.prefix + member, c.priorityKey(), c.rankKey(), c.seqKey()}
+	set, err := redisSetPriorityScript.Run(ctx, c.redisClient, keys, member, priority).Int()
+	return set == 1, err
+}
+
+// nextPrioritized removes and returns the entry with the highest priority, in a single script so
+// concurrent callers never receive the same entry.
+func (c *mightyMapRedisStorage[K]) nextPrioritized(ctx context.Context) (key K, value []byte, ok bool) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	keys := []string{c.priorityKey(), c.rankKey(), c.orderKey()}
+	res, err := redisNextPriorityScript.Run(ctx, c.redisClient, keys, c.opts.prefix).Slice()
+	if err == redis.Nil {
+		return key, nil, false
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	member, _ := res[0].(string)
+	v, _ := res[1].(string)
+	if err := msgpack.Unmarshal([]byte(member), &key); err != nil {
+		panic(err)
+	}
+	return key, []byte(v), true
+}
+
+// unprioritize queues dropping the priority of member on pipe.
+func (c *mightyMapRedisStorage[K]) unprioritize(ctx context.Context, pipe redis.Pipeliner, member string) {
+	// EVAL instead of EVALSHA, a pipeline can not fall back when the script is not cached
+	redisUnprioritizeScript.Eval(ctx, pipe, []string{c.priorityKey(), c.rankKey()}, member)
+}
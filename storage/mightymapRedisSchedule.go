@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// Scheduled entries are kept out of the keyspace until they are due, so Load, Range, Keys, Len
+// and Next ignore them without extra work: the values wait in a hash and their due times in a
+// sorted set. Promotion moves the entries that have become due into the keyspace, and a cursor
+// records the due time up to which that has happened. The sorted set keeps promoted entries until
+// they are consumed, so NextDue can return entries in due-time order whether they have been
+// promoted or not.
+
+// redisStoreAtScript schedules a value and drops the priority of the key. An entry that is
+// already due, because its due time does not lie after the cursor, is written to the keyspace at
+// once like redisPromoteScript does.
+//
+// KEYS: data key, due set, scheduled hash, cursor, order set, sequence counter, notification list,
+// priority set, rank hash.
+// ARGV: value, member, due time in milliseconds, expiration in milliseconds, ordered flag,
+// notification backlog.
+var redisStoreAtScript = redis.NewScript(`
+local rank = redis.call('HGET', KEYS[9], ARGV[2])
+if rank then
+	redis.call('ZREM', KEYS[8], rank)
+	redis.call('HDEL', KEYS[9], ARGV[2])
+end
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[2])
+local cursor = tonumber(redis.call('GET', KEYS[4]) or '-1')
+if tonumber(ARGV[3]) > cursor then
+	redis.call('HSET', KEYS[3], ARGV[2], ARGV[1])
+	return redis.call('DEL', KEYS[1])
+end
+redis.call('HDEL', KEYS[3], ARGV[2])
+if ARGV[5] == '1' and redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('ZADD', KEYS[5], redis.call('INCR', KEYS[6]), ARGV[2])
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[4])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+if tonumber(ARGV[6]) > 0 then
+	redis.call('RPUSH', KEYS[7], 1)
+	redis.call('LTRIM', KEYS[7], -tonumber(ARGV[6]), -1)
+end
+return 0
+`)
+
+// redisPromoteScript moves the scheduled values that are due into the keyspace, advances the
+// cursor and returns the due time of the next scheduled entry, or -1 if there is none.
+//
+// KEYS: due set, scheduled hash, cursor, order set, sequence counter, notification list.
+// ARGV: current time in milliseconds, key prefix, expiration in milliseconds, ordered flag,
+// notification backlog.
+var redisPromoteScript = redis.NewScript(`
+local cursor = redis.call('GET', KEYS[3])
+if cursor and tonumber(cursor) >= tonumber(ARGV[1]) then
+	cursor = ARGV[1]
+else
+	local from = '-inf'
+	if cursor then
+		from = '(' .. cursor
+	end
+	for _, member in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], from, ARGV[1])) do
+		local value = redis.call('HGET', KEYS[2], member)
+		if value then
+			local key = ARGV[2] .. member
+			if ARGV[4] == '1' and redis.call('EXISTS', key) == 0 then
+				redis.call('ZADD', KEYS[4], redis.call('INCR', KEYS[5]), member)
+			end
+			if tonumber(ARGV[3]) > 0 then
+				redis.call('SET', key, value, 'PX', ARGV[3])
+			else
+				redis.call('SET', key, value)
+			end
+			redis.call('HDEL', KEYS[2], member)
+			if tonumber(ARGV[5]) > 0 then
+				redis.call('RPUSH', KEYS[6], 1)
+			end
+		end
+	end
+	if tonumber(ARGV[5]) > 0 then
+		redis.call('LTRIM', KEYS[6], -tonumber(ARGV[5]), -1)
+	end
+	redis.call('SET', KEYS[3], ARGV[1])
+	cursor = ARGV[1]
+end
+local next = redis.call('ZRANGEBYSCORE', KEYS[1], '(' .. cursor, '+inf', 'WITHSCORES', 'LIMIT', 0, 1)
+if #next == 0 then
+	return -1
+end
+return tonumber(next[2])
+`)
+
+// redisNextDueScript removes and returns the scheduled entry with the earliest due time that is
+// not after the current time, from the hash or, once promoted, from the keyspace. Members whose
+// entry has been deleted, consumed by Next or has expired are dropped on the way.
+//
+// KEYS: due set, scheduled hash. ARGV: current time in milliseconds, key prefix.
+var redisNextDueScript = redis.NewScript(`
+while true do
+	local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1)
+	if #due == 0 then
+		return false
+	end
+	local member = due[1]
+	redis.call('ZREM', KEYS[1], member)
+	local value = redis.call('HGET', KEYS[2], member)
+	if value then
+		redis.call('HDEL', KEYS[2], member)
+		return {member, value}
+	end
+	value = redis.call('GET', ARGV[2] .. member)
+	if value then
+		redis.call('DEL', ARGV[2] .. member)
+		return {member, value}
+	end
+end
+`)
+
+// dueKey returns the sorted set of the scheduled entries scored by due time in milliseconds.
+func (c *mightyMapRedisStorage[K]) dueKey() string {
+	return redisMetaPrefix + c.opts.prefix + ":due"
+}
+
+// scheduledKey returns the hash holding the values of the scheduled entries that are not due.
+func (c *mightyMapRedisStorage[K]) scheduledKey() string {
+	return redisMetaPrefix + c.opts.prefix + ":scheduled"
+}
+
+// cursorKey returns the due time up to which scheduled entries have been promoted.
+func (c *mightyMapRedisStorage[K]) cursorKey() string {
+	return redisMetaPrefix + c.opts.prefix + ":promoted"
+}
+
+// orderedFlag returns the ordered flag argument of the scripts.
+func (c *mightyMapRedisStorage[K]) orderedFlag() string {
+	if c.opts.ordering == FIFO {
+		return "1"
+	}
+	return "0"
+}
+
+// StoreAt schedules a value that becomes visible at visibleAt; its expiration starts when it is
+// promoted into the keyspace. A value already visible under the key is hidden until then.
+// Returns ErrNotSupported without WithRedisScheduling.
+func (c *mightyMapRedisStorage[K]) StoreAt(ctx context.Context, key K, value []byte, visibleAt time.Time) error {
+	if !c.opts.scheduling {
+		return ErrNotSupported
+	}
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	member := string(keyBytes)
+	keys := []string{
+		c.opts.prefix + member, c.dueKey(), c.scheduledKey(), c.cursorKey(),
+		c.orderKey(), c.seqKey(), c.notifyKey(), c.priorityKey(), c.rankKey(),
+	}
+	err = redisStoreAtScript.Run(ctx, c.redisClient, keys, value, member, visibleAt.UnixMilli(),
+		c.opts.expire.Milliseconds(), c.orderedFlag(), c.notifyBacklog()).Err()
+	if err != nil {
+		return err
+	}
+	// promote it on time
+	for {
+		next := c.nextPromotion.Load()
+		if visibleAt.UnixMilli() >= next || c.nextPromotion.CompareAndSwap(next, visibleAt.UnixMilli()) {
+			return nil
+		}
+	}
+}
+
+// NextDue removes and returns the scheduled entry with the earliest due time, if it has passed.
+// Without WithRedisScheduling there are no scheduled entries.
+func (c *mightyMapRedisStorage[K]) NextDue(ctx context.Context) (key K, value []byte, ok bool) {
+	if !c.opts.scheduling {
+		return key, nil, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	keys := []string{c.dueKey(), c.scheduledKey()}
+	res, err := redisNextDueScript.Run(ctx, c.redisClient, keys, time.Now().UnixMilli(), c.opts.prefix).Slice()
+	if err == redis.Nil {
+		return key, nil, false
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	member, _ := res[0].(string)
+	v, _ := res[1].(string)
+	if err := msgpack.Unmarshal([]byte(member), &key); err != nil {
+		panic(err)
+	}
+	return key, []byte(v), true
+}
+
+// promoteDue moves scheduled entries that have become due into the keyspace before a read. It
+// only calls Redis once the earliest due time this instance knows of has passed, and at least
+// every WithRedisNextWaitPollInterval to pick up entries scheduled by other clients.
+// Without WithRedisScheduling it does nothing.
+func (c *mightyMapRedisStorage[K]) promoteDue(ctx context.Context) {
+	if !c.opts.scheduling {
+		return
+	}
+	now := time.Now()
+	if now.UnixMilli() < c.nextPromotion.Load() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	keys := []string{c.dueKey(), c.scheduledKey(), c.cursorKey(), c.orderKey(), c.seqKey(), c.notifyKey()}
+	next, err := redisPromoteScript.Run(ctx, c.redisClient, keys, now.UnixMilli(), c.opts.prefix,
+		c.opts.expire.Milliseconds(), c.orderedFlag(), c.notifyBacklog()).Int64()
+	if err != nil {
+		panic(err)
+	}
+	poll := now.Add(c.opts.pollInterval).UnixMilli()
+	if next < 0 || next > poll {
+		next = poll
+	}
+	c.nextPromotion.Store(next)
+}
+
+// unschedule queues the removal of the scheduled entries of members on pipe, so a Store or
+// Delete is not undone by a later promotion.
+func (c *mightyMapRedisStorage[K]) unschedule(ctx context.Context, pipe redis.Pipeliner, members ...string) {
+	args := make([]any, len(members))
+	for i, member := range members {
+		args[i] = member
+	}
+	pipe.ZRem(ctx, c.dueKey(), args...)
+	pipe.HDel(ctx, c.scheduledKey(), members...)
+}
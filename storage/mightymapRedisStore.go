@@ -4,7 +4,9 @@ import (
 	"context"
 	"crypto/tls"
 	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
@@ -26,11 +28,18 @@ const (
 	redisScanSingleKey = 1
 	// defaultRedisAddr is the default Redis server address
 	defaultRedisAddr = "localhost:6379"
+	// redisNotifyBacklog is the number of store notifications kept for NextWait
+	redisNotifyBacklog = 64
+	// redisMaxScanPartitions bounds the concurrent SCANs of ParallelRange, as every one of them
+	// walks the whole keyspace on the server
+	redisMaxScanPartitions = 16
 )
 
 type mightyMapRedisStorage[K comparable] struct {
 	redisClient *redis.Client
 	opts        *redisOpts
+	// nextPromotion is the time in unix milliseconds at which promoteDue looks for due entries again
+	nextPromotion atomic.Int64
 }
 
 func NewMightyMapRedisStorage[K comparable, V any](optfuncs ...OptionFuncRedis) IMightyMapStorage[K, V] {
@@ -66,7 +75,11 @@ func NewMightyMapRedisStorage[K comparable, V any](optfuncs ...OptionFuncRedis)
 		redisClient: redis.NewClient(clientOpts),
 		opts:        opts,
 	}
-	return newMsgpackAdapter[K, V](storage)
+	adapter := newMsgpackAdapter[K, V](storage)
+	if opts.nearCacheSize > 0 {
+		return newRedisNearCache(adapter, storage.redisClient, opts)
+	}
+	return adapter
 }
 
 func getDefaultRedisOptions() *redisOpts {
@@ -82,6 +95,12 @@ func getDefaultRedisOptions() *redisOpts {
 		prefix:     "mightymap_",
 		timeout:    defaultRedisTimeout,
 		expire:     0,
+
+		slidingExpiration: false,
+		nearCacheSize:     0,
+		nearCacheTTL:      0,
+		ordering:          Unordered,
+		pollInterval:      defaultNextWaitPollInterval,
 	}
 
 	return opts
@@ -95,7 +114,37 @@ func (c *mightyMapRedisStorage[K]) Store(ctx context.Context, key K, value []byt
 	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
 	defer cancel()
 
-	if err := c.redisClient.Set(ctx, c.opts.prefix+string(keyBytes), value, c.opts.expire).Err(); err != nil {
+	if c.opts.ordering == FIFO {
+		if c.opts.scheduling {
+			// drop a pending schedule first, so its promotion cannot overwrite the value
+			_, err = c.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				c.unschedule(ctx, pipe, string(keyBytes))
+				return nil
+			})
+			if err != nil {
+				panic(err)
+			}
+		}
+		if err := c.storeOrdered(ctx, string(keyBytes), value); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if !c.opts.scheduling && !c.opts.notifications {
+		if err := c.redisClient.Set(ctx, c.opts.prefix+string(keyBytes), value, c.opts.expire).Err(); err != nil {
+			panic(err)
+		}
+		return
+	}
+	_, err = c.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if c.opts.scheduling {
+			c.unschedule(ctx, pipe, string(keyBytes))
+		}
+		pipe.Set(ctx, c.opts.prefix+string(keyBytes), value, c.opts.expire)
+		c.notifyStored(ctx, pipe)
+		return nil
+	})
+	if err != nil {
 		panic(err)
 	}
 }
@@ -105,10 +154,16 @@ func (c *mightyMapRedisStorage[K]) Load(ctx context.Context, key K) (value []byt
 	if err != nil {
 		panic(err)
 	}
+	c.promoteDue(ctx)
 	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
 	defer cancel()
 
-	v, err := c.redisClient.Get(ctx, c.opts.prefix+string(keyBytes)).Bytes()
+	var v []byte
+	if c.opts.slidingExpiration && c.opts.expire > 0 {
+		v, err = c.redisClient.GetEx(ctx, c.opts.prefix+string(keyBytes), c.opts.expire).Bytes()
+	} else {
+		v, err = c.redisClient.Get(ctx, c.opts.prefix+string(keyBytes)).Bytes()
+	}
 	if err == redis.Nil {
 		return nil, false
 	}
@@ -127,12 +182,46 @@ func (c *mightyMapRedisStorage[K]) Delete(ctx context.Context, keys ...K) {
 		}
 		ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
 		defer cancel()
-		if err := c.redisClient.Del(ctx, c.opts.prefix+string(keyBytes)).Err(); err != nil {
+		_, err = c.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, c.opts.prefix+string(keyBytes))
+			if c.opts.scheduling {
+				c.unschedule(ctx, pipe, string(keyBytes))
+			}
+			if c.opts.priorities {
+				c.unprioritize(ctx, pipe, string(keyBytes))
+			}
+			if c.opts.ordering == FIFO {
+				pipe.ZRem(ctx, c.orderKey(), string(keyBytes))
+			}
+			return nil
+		})
+		if err != nil {
 			panic(err)
 		}
 	}
 }
 
+// Touch restarts the expiration of the given keys without reading their values.
+// Missing keys are ignored. Without WithRedisExpire this is a no-op.
+func (c *mightyMapRedisStorage[K]) Touch(ctx context.Context, keys ...K) error {
+	if c.opts.expire <= 0 || len(keys) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+	defer cancel()
+
+	pipe := c.redisClient.Pipeline()
+	for _, key := range keys {
+		keyBytes, err := msgpack.Marshal(key)
+		if err != nil {
+			return err
+		}
+		pipe.Expire(ctx, c.opts.prefix+string(keyBytes), c.opts.expire)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
 func (c *mightyMapRedisStorage[K]) Clear(ctx context.Context) {
 	keys, err := c.scan(ctx, c.opts.prefix+"*")
 	if err != nil {
@@ -156,6 +245,16 @@ func (c *mightyMapRedisStorage[K]) Clear(ctx context.Context) {
 	if len(kkeys) > 0 {
 		c.Delete(ctx, kkeys...)
 	}
+	if c.opts.ordering == FIFO {
+		// drop members of keys that expired
+		if err := c.redisClient.Del(ctx, c.orderKey()).Err(); err != nil {
+			panic(err)
+		}
+	}
+	if err := c.redisClient.Del(ctx, c.dueKey(), c.scheduledKey(), c.cursorKey(), c.priorityKey(), c.rankKey()).Err(); err != nil {
+		panic(err)
+	}
+	c.nextPromotion.Store(0)
 }
 
 func (c *mightyMapRedisStorage[K]) Close(_ context.Context) error {
@@ -163,6 +262,7 @@ func (c *mightyMapRedisStorage[K]) Close(_ context.Context) error {
 }
 
 func (c *mightyMapRedisStorage[K]) Len(ctx context.Context) int {
+	c.promoteDue(ctx)
 	keys, err := c.scan(ctx, c.opts.prefix+"*")
 	if err != nil {
 		panic(err)
@@ -170,41 +270,122 @@ func (c *mightyMapRedisStorage[K]) Len(ctx context.Context) int {
 	return len(keys)
 }
 
+// Next removes and returns an entry: with WithRedisPriorities the one with the highest priority
+// if any entry has one,
+// otherwise the first one found by SCAN, or the oldest one with FIFO ordering.
+// The value is read and deleted with GETDEL, so concurrent callers never receive the same entry;
+// a key taken by another caller in between is skipped.
 func (c *mightyMapRedisStorage[K]) Next(ctx context.Context) (key K, value []byte, ok bool) {
+	c.promoteDue(ctx)
+	if c.opts.priorities {
+		if key, value, ok = c.nextPrioritized(ctx); ok {
+			return key, value, ok
+		}
+	}
+	if c.opts.ordering == FIFO {
+		return c.nextOrdered(ctx)
+	}
+
 	var zeroK K
 
 	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
 	defer cancel()
 
-	keys, err := c.scan(ctx, c.opts.prefix+"*", redisScanSingleKey)
-	if err != nil {
-		panic(err)
-	}
-	if len(keys) == 0 {
-		return zeroK, nil, false
-	}
+	for {
+		keys, err := c.scan(ctx, c.opts.prefix+"*", redisScanSingleKey)
+		if err != nil {
+			panic(err)
+		}
+		if len(keys) == 0 {
+			return zeroK, nil, false
+		}
+
+		splitKey := strings.SplitN(keys[0], c.opts.prefix, 2)
+		if len(splitKey) != redisPrefixSplitExpectedParts {
+			return zeroK, nil, false
+		}
 
-	splitKey := strings.SplitN(keys[0], c.opts.prefix, 2)
-	if len(splitKey) != redisPrefixSplitExpectedParts {
-		return zeroK, nil, false
+		var k K
+		err = msgpack.Unmarshal([]byte(splitKey[1]), &k)
+		if err != nil {
+			panic(err)
+		}
+		v, err := c.redisClient.GetDel(ctx, keys[0]).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		return k, v, true
 	}
+}
 
-	var k K
-	err = msgpack.Unmarshal([]byte(splitKey[1]), &k)
-	if err != nil {
-		panic(err)
+// NextWait removes and returns an entry like Next, waiting until one is stored while the storage
+// is empty. With WithRedisStoreNotifications every Store pushes a notification onto a list that
+// NextWait waits on with BLPOP, so waiters in all processes sharing the prefix wake up; other
+// entries are noticed within WithRedisNextWaitPollInterval. Concurrent callers each receive a different entry.
+// Returns the context error if ctx is cancelled first.
+func (c *mightyMapRedisStorage[K]) NextWait(ctx context.Context) (key K, value []byte, err error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return key, nil, err
+		}
+		if key, value, ok := c.Next(ctx); ok {
+			return key, value, nil
+		}
+		err := c.redisClient.BLPop(ctx, c.opts.pollInterval, c.notifyKey()).Err()
+		if err != nil && err != redis.Nil && ctx.Err() == nil {
+			panic(err)
+		}
 	}
-	v, err := c.redisClient.Get(ctx, keys[0]).Bytes()
-	if err != nil {
-		panic(err)
+}
+
+// notifyKey returns the list Store pushes a notification onto for NextWait.
+func (c *mightyMapRedisStorage[K]) notifyKey() string {
+	return redisMetaPrefix + c.opts.prefix + ":stored"
+}
+
+// notifyStored queues a notification for NextWait on pipe with WithRedisStoreNotifications,
+// keeping at most redisNotifyBacklog of them so the list stays small while nobody waits.
+func (c *mightyMapRedisStorage[K]) notifyStored(ctx context.Context, pipe redis.Pipeliner) {
+	if !c.opts.notifications {
+		return
 	}
+	pipe.RPush(ctx, c.notifyKey(), 1)
+	pipe.LTrim(ctx, c.notifyKey(), -redisNotifyBacklog, -1)
+}
 
-	c.Delete(ctx, k)
+// notifyBacklog returns the notification backlog argument of the scripts, 0 without
+// WithRedisStoreNotifications so they push no notification.
+func (c *mightyMapRedisStorage[K]) notifyBacklog() int {
+	if !c.opts.notifications {
+		return 0
+	}
+	return redisNotifyBacklog
+}
 
-	return k, v, true
+// Supports reports whether the scheduling and priority methods are enabled by their options;
+// the other capabilities the storage implements are always available.
+func (c *mightyMapRedisStorage[K]) Supports(capability Capability) bool {
+	switch capability {
+	case CapabilitySchedule:
+		return c.opts.scheduling
+	case CapabilityPriority:
+		return c.opts.priorities
+	}
+	return true
 }
 
+// Range visits the entries in SCAN order, or in insertion order with FIFO ordering.
 func (c *mightyMapRedisStorage[K]) Range(ctx context.Context, f func(key K, value []byte) bool) {
+	c.promoteDue(ctx)
+	if c.opts.ordering == FIFO {
+		c.rangeOrdered(ctx, f)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, c.opts.timeout)
 	defer cancel()
 
@@ -235,7 +416,136 @@ func (c *mightyMapRedisStorage[K]) Range(ctx context.Context, f func(key K, valu
 	}
 }
 
+// ParallelRange splits the keys of the prefix into disjoint partitions by their last byte, see
+// redisScanPatterns, and runs one SCAN per partition concurrently, up to workers of them. Every
+// page of keys is handed to up to workers goroutines, which fetch the values with MGET and call f.
+//
+// SCAN guarantees that keys present during the whole scan are returned, but it may return a
+// key more than once if the keyspace is rehashed meanwhile, so f can see duplicates. Keys added
+// or removed during the scan may or may not be visited. No ordering is guaranteed.
+func (c *mightyMapRedisStorage[K]) ParallelRange(ctx context.Context, workers int, f func(key K, value []byte) bool) error {
+	c.promoteDue(ctx)
+	produce := func(ctx context.Context, emit func([]string) bool) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		patterns := redisScanPatterns(c.opts.prefix, min(max(workers, 1), redisMaxScanPartitions))
+		errs := make(chan error, len(patterns))
+		for _, pattern := range patterns {
+			go func() {
+				errs <- c.scanPartition(ctx, pattern, emit)
+			}()
+		}
+		var err error
+		for range patterns {
+			if e := <-errs; e != nil && err == nil {
+				// stop the other partitions
+				err = e
+				cancel()
+			}
+		}
+		return err
+	}
+
+	consume := func(ctx context.Context, keys []string) (bool, error) {
+		mgetCtx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+		values, err := c.redisClient.MGet(mgetCtx, keys...).Result()
+		cancel()
+		if err != nil {
+			return false, err
+		}
+		for i, v := range values {
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			s, ok := v.(string)
+			if !ok {
+				// deleted or expired since the scan
+				continue
+			}
+			splitKey := strings.SplitN(keys[i], c.opts.prefix, 2)
+			if len(splitKey) != redisPrefixSplitExpectedParts {
+				continue
+			}
+			var k K
+			if err := msgpack.Unmarshal([]byte(splitKey[1]), &k); err != nil {
+				return false, err
+			}
+			if !f(k, []byte(s)) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	return parallelDispatch(ctx, workers, produce, consume)
+}
+
+// scanPartition runs SCAN over the keys matching pattern and hands every page to emit.
+func (c *mightyMapRedisStorage[K]) scanPartition(ctx context.Context, pattern string, emit func([]string) bool) error {
+	var cursor uint64
+	for {
+		scanCtx, cancel := context.WithTimeout(ctx, c.opts.timeout)
+		keys, next, err := c.redisClient.Scan(scanCtx, cursor, pattern, defaultRedisCursorSize).Result()
+		cancel()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 && !emit(keys) {
+			return ctx.Err()
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// redisScanPatterns returns n SCAN patterns that split the keys starting with prefix into
+// disjoint partitions by their last byte: the ASCII bytes are dealt out round robin, and the
+// last partition also takes every other byte through a negated class.
+func redisScanPatterns(prefix string, n int) []string {
+	if n <= 1 {
+		return []string{prefix + "*"}
+	}
+	classes := make([][]byte, n)
+	var others []byte
+	for b := 0; b < utf8.RuneSelf; b++ {
+		i := b % n
+		classes[i] = appendGlobClassByte(classes[i], byte(b))
+		if i != n-1 {
+			others = appendGlobClassByte(others, byte(b))
+		}
+	}
+	patterns := make([]string, n)
+	for i := range n - 1 {
+		patterns[i] = prefix + "*[" + string(classes[i]) + "]"
+	}
+	patterns[n-1] = prefix + "*[^" + string(others) + "]"
+	return patterns
+}
+
+// appendGlobClassByte appends b to a glob character class, escaping the bytes that have a
+// meaning inside one.
+func appendGlobClassByte(class []byte, b byte) []byte {
+	switch b {
+	case '\\', ']', '[', '-', '^':
+		class = append(class, '\\')
+	}
+	return append(class, b)
+}
+
+// Keys returns the keys in SCAN order, or in insertion order with FIFO ordering.
 func (c *mightyMapRedisStorage[K]) Keys(ctx context.Context) []K {
+	c.promoteDue(ctx)
+	if c.opts.ordering == FIFO {
+		var kkeys []K
+		c.rangeOrdered(ctx, func(key K, _ []byte) bool {
+			kkeys = append(kkeys, key)
+			return true
+		})
+		return kkeys
+	}
+
 	keys, err := c.scan(ctx, c.opts.prefix+"*")
 	if err != nil {
 		panic(err)
@@ -5,6 +5,9 @@ import (
 	"crypto/tls"
 	"testing"
 	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 )
 
 func TestMightyMapRedisStorage(t *testing.T) {
@@ -260,3 +263,65 @@ func TestMightyMapRedisStorageEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestMightyMapRedisStorageFeaturesDisabledByDefault(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	store := NewMightyMapRedisStorage[string, int](WithRedisAddr(mr.Addr()), WithRedisPrefix("plain:"))
+	defer store.Close(ctx)
+
+	store.Store(ctx, "a", 1)
+	store.Store(ctx, "b", 2)
+	store.Delete(ctx, "b")
+	// Store and Delete only touch the keys themselves
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "plain:"+mustMarshalKey(t, "a") {
+		t.Errorf("Redis keys = %q; want only the key of a", keys)
+	}
+
+	for _, c := range []Capability{CapabilitySchedule, CapabilityPriority} {
+		if Supports(store, c) {
+			t.Errorf("Supports(%d) = true; want false without its option", c)
+		}
+	}
+	if err := store.(IMightyMapScheduleStorage[string, int]).StoreAt(ctx, "c", 3, time.Now()); err != ErrNotSupported {
+		t.Errorf("StoreAt() error = %v; want ErrNotSupported", err)
+	}
+	if err := store.(IMightyMapPriorityStorage[string, int]).StoreWithPriority(ctx, "c", 3, 1); err != ErrNotSupported {
+		t.Errorf("StoreWithPriority() error = %v; want ErrNotSupported", err)
+	}
+	if !Supports(store, CapabilityNextWait) {
+		t.Error("Supports(CapabilityNextWait) = false; want true, NextWait polls without notifications")
+	}
+}
+
+func TestRedisScanPatterns(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	for b := 0; b < 256; b++ {
+		mr.Set("p:k"+string([]byte{byte(b)}), "v")
+	}
+	mr.Set("other", "v")
+
+	for _, n := range []int{1, 2, 5, 16} {
+		seen := map[string]int{}
+		for _, pattern := range redisScanPatterns("p:", n) {
+			keys, err := client.Keys(ctx, pattern).Result()
+			if err != nil {
+				t.Fatalf("KEYS %q error: %v", pattern, err)
+			}
+			for _, k := range keys {
+				seen[k]++
+			}
+		}
+		if len(seen) != 256 {
+			t.Errorf("%d partitions matched %d keys; want 256", n, len(seen))
+		}
+		for k, c := range seen {
+			if c != 1 {
+				t.Errorf("%d partitions matched %q %d times; want once", n, k, c)
+			}
+		}
+	}
+}
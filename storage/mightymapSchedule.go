@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"container/heap"
+	"time"
+)
+
+// dueIndex keeps the due times of the scheduled entries of the in-memory storages in a min-heap,
+// so NextDue finds the earliest one without scanning. Entries stored with Store are not in the
+// index and are always visible. All methods must be called with the storage write lock held,
+// except visible, empty and pending which only need the read lock.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+type dueIndex[K comparable] struct {
+	items map[K]*dueItem[K]
+	heap  dueHeap[K]
+}
+
+type dueItem[K comparable] struct {
+	key K
+	// at is the due time in unix nanoseconds
+	at    int64
+	index int
+}
+
+// dueHeap implements heap.Interface ordered by due time.
+type dueHeap[K comparable] []*dueItem[K]
+
+func (h dueHeap[K]) Len() int           { return len(h) }
+func (h dueHeap[K]) Less(i, j int) bool { return h[i].at < h[j].at }
+func (h dueHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *dueHeap[K]) Push(x any) {
+	item := x.(*dueItem[K])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *dueHeap[K]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// newDueIndex returns an empty index; the map is only allocated once an entry is scheduled.
+func newDueIndex[K comparable]() *dueIndex[K] {
+	return &dueIndex[K]{}
+}
+
+// set schedules key at visibleAt, or unschedules it if visibleAt is zero.
+func (d *dueIndex[K]) set(key K, visibleAt time.Time) {
+	if visibleAt.IsZero() {
+		d.remove(key)
+		return
+	}
+	at := visibleAt.UnixNano()
+	if item, ok := d.items[key]; ok {
+		item.at = at
+		heap.Fix(&d.heap, item.index)
+		return
+	}
+	if d.items == nil {
+		d.items = make(map[K]*dueItem[K])
+	}
+	item := &dueItem[K]{key: key, at: at}
+	heap.Push(&d.heap, item)
+	d.items[key] = item
+}
+
+// remove unschedules key.
+func (d *dueIndex[K]) remove(key K) {
+	if item, ok := d.items[key]; ok {
+		heap.Remove(&d.heap, item.index)
+		delete(d.items, key)
+	}
+}
+
+// reset unschedules all keys.
+func (d *dueIndex[K]) reset() {
+	d.items = nil
+	d.heap = nil
+}
+
+// empty reports whether no key is scheduled.
+func (d *dueIndex[K]) empty() bool {
+	return len(d.items) == 0
+}
+
+// visible reports whether key is not scheduled after now (unix nanoseconds).
+func (d *dueIndex[K]) visible(key K, now int64) bool {
+	item, ok := d.items[key]
+	return !ok || item.at <= now
+}
+
+// pending returns the number of keys scheduled after now.
+func (d *dueIndex[K]) pending(now int64) int {
+	count := 0
+	for _, item := range d.items {
+		if item.at > now {
+			count++
+		}
+	}
+	return count
+}
+
+// popDue unschedules and returns the key with the earliest due time if it is not after now.
+func (d *dueIndex[K]) popDue(now int64) (key K, ok bool) {
+	if len(d.heap) == 0 || d.heap[0].at > now {
+		return key, false
+	}
+	item := heap.Pop(&d.heap).(*dueItem[K])
+	delete(d.items, item.key)
+	return item.key, true
+}
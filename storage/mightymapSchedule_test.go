@@ -0,0 +1,89 @@
+package storage_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thisisdevelopment/mightymap/internal/storagetest"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+func TestScheduledEntries(t *testing.T) {
+	ctx := context.Background()
+
+	for name, newStore := range storagetest.Storages[string, int](t, storagetest.All(), storage.CapabilitySchedule) {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close(ctx)
+			s := store.(storage.IMightyMapScheduleStorage[string, int])
+
+			store.Store(ctx, "now", 1)
+			start := time.Now()
+			if err := s.StoreAt(ctx, "later", 3, start.Add(300*time.Millisecond)); err != nil {
+				t.Fatalf("StoreAt() error: %v", err)
+			}
+			if err := s.StoreAt(ctx, "soon", 2, start.Add(150*time.Millisecond)); err != nil {
+				t.Fatalf("StoreAt() error: %v", err)
+			}
+			// a plain Store cancels the schedule
+			if err := s.StoreAt(ctx, "cancelled", 4, start.Add(150*time.Millisecond)); err != nil {
+				t.Fatalf("StoreAt() error: %v", err)
+			}
+			store.Store(ctx, "cancelled", 5)
+
+			if _, ok := store.Load(ctx, "soon"); ok {
+				t.Error("Load() returned an entry before it is due")
+			}
+			if n := store.Len(ctx); n != 2 {
+				t.Errorf("Len() = %d before the entries are due; want 2", n)
+			}
+			if key, _, ok := s.NextDue(ctx); ok {
+				t.Errorf("NextDue() = %q before any entry is due", key)
+			}
+
+			time.Sleep(time.Until(start.Add(200 * time.Millisecond)))
+			if v, ok := store.Load(ctx, "soon"); !ok || v != 2 {
+				t.Errorf("Load() = %d, %v once due; want 2, true", v, ok)
+			}
+			if _, ok := store.Load(ctx, "later"); ok {
+				t.Error("Load() returned an entry before it is due")
+			}
+			keys := store.Keys(ctx)
+			if len(keys) != 3 {
+				t.Errorf("Keys() = %v; want now, soon and cancelled", keys)
+			}
+
+			time.Sleep(time.Until(start.Add(350 * time.Millisecond)))
+			var due []string
+			for {
+				key, _, ok := s.NextDue(ctx)
+				if !ok {
+					break
+				}
+				due = append(due, key)
+			}
+			if want := []string{"soon", "later"}; !reflect.DeepEqual(due, want) {
+				t.Errorf("NextDue() returned %v; want %v", due, want)
+			}
+			if n := store.Len(ctx); n != 2 {
+				t.Errorf("Len() = %d after NextDue; want 2", n)
+			}
+		})
+	}
+}
+
+func TestScheduledEntriesNotSupported(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMightyMapBadgerStorage[string, int](storage.WithMemoryStorage(true))
+	defer store.Close(ctx)
+
+	s := store.(storage.IMightyMapScheduleStorage[string, int])
+	if err := s.StoreAt(ctx, "a", 1, time.Now()); err != storage.ErrNotSupported {
+		t.Errorf("StoreAt() error = %v; want ErrNotSupported", err)
+	}
+	if _, _, ok := s.NextDue(ctx); ok {
+		t.Error("NextDue() = true; want false")
+	}
+}
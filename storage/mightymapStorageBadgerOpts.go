@@ -17,10 +17,10 @@ const (
 	badgerDefaultBlockSize      = 16 * 1024 // 16 KB
 
 	// BadgerDB tuning constants
-	badgerDefaultNumCompactors    = 4
-	badgerDefaultGCInterval       = 10 * time.Second
-	badgerDefaultGCPercentage     = 0.5
-	badgerDefaultKeyRotationDays  = 10
+	badgerDefaultNumCompactors     = 4
+	badgerDefaultGCInterval        = 10 * time.Second
+	badgerDefaultGCPercentage      = 0.5
+	badgerDefaultKeyRotationDays   = 10
 	badgerDefaultNumVersionsToKeep = 1
 
 	// Encryption key valid lengths
@@ -48,6 +48,13 @@ type badgerOpts struct {
 	encryptionKey         string
 	encryptionKeyRotation time.Duration
 	syncWrites            bool
+	expire                time.Duration
+	slidingExpiration     bool
+	exactLen              bool
+	gcCallback            func(BadgerGCResult)
+	readOnly              bool
+	ordering              Ordering
+	pollInterval          time.Duration
 }
 
 func getDefaultBadgerOptions() *badgerOpts {
@@ -70,6 +77,13 @@ func getDefaultBadgerOptions() *badgerOpts {
 		encryptionKey:         "",
 		encryptionKeyRotation: badgerDefaultKeyRotationDays * 24 * time.Hour, // 10 days default
 		syncWrites:            false,
+		expire:                0,
+		slidingExpiration:     false,
+		exactLen:              false,
+		gcCallback:            nil,
+		readOnly:              false,
+		ordering:              Unordered,
+		pollInterval:          defaultNextWaitPollInterval,
 	}
 }
 
@@ -107,7 +121,9 @@ func WithNumCompactors(numCompactors int) OptionFuncBadger {
 }
 
 // WithNumVersionsToKeep specifies the number of versions to keep per key.
-// **Default value**: `2`
+// Values above 1 can not be combined with WithSlidingExpiration, which would add a version on
+// every Load.
+// **Default value**: `1`
 func WithNumVersionsToKeep(numVersionsToKeep int) OptionFuncBadger {
 	return func(o *badgerOpts) {
 		o.numVersionsToKeep = numVersionsToKeep
@@ -160,6 +176,8 @@ func WithMetricsEnabled(metricsEnabled bool) OptionFuncBadger {
 }
 
 // WithDetectConflicts enables or disables conflict detection in Badger.
+// With detection, a Next that races with a concurrent Touch or sliding Load of the same key
+// is retried instead of returning a value that was rewritten meanwhile.
 // **Default value**: `true`
 func WithDetectConflicts(detectConflicts bool) OptionFuncBadger {
 	return func(o *badgerOpts) {
@@ -225,3 +243,90 @@ func WithSyncWrites(syncWrites bool) OptionFuncBadger {
 		o.syncWrites = syncWrites
 	}
 }
+
+// WithExpire sets the duration after which entries expire, using Badger's native TTL support.
+// Expired entries are invisible to all operations and reclaimed by compaction.
+// **Default value**: `0` (entries never expire)
+func WithExpire(expire time.Duration) OptionFuncBadger {
+	return func(o *badgerOpts) {
+		o.expire = expire
+	}
+}
+
+// WithExactLen makes Len count the live keys with a key-only scan on every call when entries
+// expire through WithExpire. Expiring entries disappear without a write, so the key counter
+// still includes them; by default Len returns the counter and recounts it with a scan at most
+// once per WithGcInterval. Without WithExpire the counter is always exact and this has no effect.
+// **Default value**: `false`
+func WithExactLen(exact bool) OptionFuncBadger {
+	return func(o *badgerOpts) {
+		o.exactLen = exact
+	}
+}
+
+// WithSlidingExpiration makes Load restart the expiration of the entry it reads by re-setting
+// its TTL, so entries expire after their last access instead of their last write.
+// Note that every Load then becomes a write transaction, retried a few times when a concurrent
+// write of the key conflicts with it. Badger can only restart a TTL by writing the value again,
+// which adds a version, so NewMightyMapBadgerStorage panics if this is combined with
+// WithNumVersionsToKeep above 1; Touch does add a version per call.
+// Only effective together with WithExpire.
+// **Default value**: `false`
+func WithSlidingExpiration(sliding bool) OptionFuncBadger {
+	return func(o *badgerOpts) {
+		o.slidingExpiration = sliding
+	}
+}
+
+// BadgerGCResult describes one value log garbage collection run of the maintenance loop.
+type BadgerGCResult struct {
+	// Rewritten reports whether a value log file was rewritten and its space reclaimed.
+	Rewritten bool
+	// Err is set when the run failed; finding nothing to rewrite is not an error.
+	Err error
+	// Duration is the time the run took.
+	Duration time.Duration
+}
+
+// WithGcCallback sets a function called after every value log garbage collection run of the
+// background maintenance loop, e.g. to export metrics. It is called from the maintenance goroutine.
+// The loop does not run for in-memory databases, which have no value log.
+// **Default value**: `nil`
+func WithGcCallback(callback func(BadgerGCResult)) OptionFuncBadger {
+	return func(o *badgerOpts) {
+		o.gcCallback = callback
+	}
+}
+
+// WithReadOnly opens an existing on-disk database in read-only mode, e.g. for analytics jobs.
+// Store, Delete, Clear and Next panic with ErrReadOnly, methods returning an error return it,
+// sliding expiration does not restart TTLs and no garbage collection runs.
+// Badger takes a shared lock on the directory, so several read-only instances can be open at
+// once, but not while a writer holds it; read a backup or a copy to analyse a live database.
+// The database must have been closed cleanly, otherwise opening fails.
+// **Default value**: `false`
+func WithReadOnly(readOnly bool) OptionFuncBadger {
+	return func(o *badgerOpts) {
+		o.readOnly = readOnly
+	}
+}
+
+// WithOrdering sets the order of Next, Range and Keys. FIFO keeps a secondary index of the keys
+// under their insertion sequence number, written in the same transaction as the entry, so every
+// new key costs two extra index entries. Keys of an existing database are indexed in key order
+// when it is first opened with FIFO; a read-only database must have been indexed before.
+// **Default value**: `Unordered`
+func WithOrdering(ordering Ordering) OptionFuncBadger {
+	return func(o *badgerOpts) {
+		o.ordering = ordering
+	}
+}
+
+// WithNextWaitPollInterval sets how often NextWait looks for entries while it waits. Stores
+// through the storage wake it up at once; the poll picks up everything else, such as restores.
+// **Default value**: `1s`
+func WithNextWaitPollInterval(interval time.Duration) OptionFuncBadger {
+	return func(o *badgerOpts) {
+		o.pollInterval = interval
+	}
+}
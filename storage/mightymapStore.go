@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"sync"
+	"time"
 )
 
 // IMightyMapStorage defines the interface for all storage implementations used by MightyMap.
@@ -26,15 +27,21 @@ type IMightyMapStorage[K comparable, V any] interface {
 	Delete(ctx context.Context, keys ...K)
 
 	// Range iterates over all key-value pairs in storage in an unspecified order,
+	// or in insertion order if the storage is configured with FIFO ordering,
 	// calling the provided function for each pair.
 	// If the function returns false, iteration stops early.
+	// Implementations may hold a lock while calling the function, in which case writing to the
+	// same storage from it deadlocks; see the snapshot range options of the default and Swiss
+	// storages.
 	Range(ctx context.Context, f func(key K, value V) bool)
 
-	// Keys returns all keys in storage in an unspecified order.
+	// Keys returns all keys in storage in an unspecified order, or in insertion order
+	// with FIFO ordering.
 	Keys(ctx context.Context) []K
 
 	// Next returns and removes the next key-value pair from storage.
-	// The iteration order is not specified and may vary between implementations.
+	// The iteration order is not specified and may vary between implementations,
+	// unless the storage is configured with FIFO ordering, which returns the oldest entry.
 	// Returns zero values and false when storage is empty.
 	// This operation is atomic - the key-value pair is removed as part of retrieval.
 	Next(ctx context.Context) (key K, value V, ok bool)
@@ -95,8 +102,16 @@ type byteStorage[K comparable] interface {
 //   - K: the key type, must be comparable
 //   - V: the value type, can be any type
 type mightyMapDirectStorage[K comparable, V any] struct {
-	data  map[K]V
-	mutex *sync.RWMutex
+	data     map[K]V
+	mutex    *sync.RWMutex
+	expiry   *expiryTracker[K]
+	order    *orderIndex[K]
+	due      *dueIndex[K]
+	priority *priorityIndex[K]
+	stored   *storeNotifier
+	ranging  *rangeGuard
+	// snapshotRange makes Range call its callback without holding the lock
+	snapshotRange bool
 }
 
 // mightyMapDefaultStorage provides byte-based storage for implementations that require serialization.
@@ -110,6 +125,60 @@ type mightyMapDefaultStorage[K comparable] struct {
 	mutex *sync.RWMutex
 }
 
+type defaultOpts struct {
+	expire            time.Duration
+	slidingExpiration bool
+	ordering          Ordering
+	snapshotRange     bool
+}
+
+// OptionFuncDefault is a function type that modifies defaultOpts configuration.
+// It allows customizing the behavior of the default in-memory storage implementation
+// through functional options pattern.
+type OptionFuncDefault func(*defaultOpts)
+
+// WithDefaultStorageExpire sets the duration after which entries expire.
+// Expired entries are invisible to all operations and are purged lazily.
+// **Default value**: `0` (entries never expire)
+func WithDefaultStorageExpire(expire time.Duration) OptionFuncDefault {
+	return func(o *defaultOpts) {
+		o.expire = expire
+	}
+}
+
+// WithDefaultStorageSlidingExpiration makes Load restart the expiration of the entry it reads,
+// so entries expire after their last access instead of their last write.
+// Only effective together with WithDefaultStorageExpire.
+// **Default value**: `false`
+func WithDefaultStorageSlidingExpiration(sliding bool) OptionFuncDefault {
+	return func(o *defaultOpts) {
+		o.slidingExpiration = sliding
+	}
+}
+
+// WithDefaultStorageOrdering sets the order of Next, Range and Keys. With FIFO the insertion
+// order is kept in a linked list next to the map, which costs one list element per entry.
+// **Default value**: `Unordered`
+func WithDefaultStorageOrdering(ordering Ordering) OptionFuncDefault {
+	return func(o *defaultOpts) {
+		o.ordering = ordering
+	}
+}
+
+// WithDefaultStorageSnapshotRange makes Range iterate over a copy of the keys taken when it
+// starts, calling its callback without holding the lock, so the callback may read and write the
+// storage. Each key is looked up again when its turn comes: keys deleted meanwhile are skipped,
+// changed values are seen as changed, and keys stored meanwhile are not visited. Copying the
+// keys costs O(n) memory per Range.
+// Disabled, Range holds the read lock during the whole iteration instead, which saves the copy,
+// and writes from the callback panic with ErrReentrantWrite.
+// **Default value**: `true`
+func WithDefaultStorageSnapshotRange(snapshot bool) OptionFuncDefault {
+	return func(o *defaultOpts) {
+		o.snapshotRange = snapshot
+	}
+}
+
 // NewMightyMapDefaultStorage creates a new default storage implementation with the specified key and value types.
 // This function returns a direct in-memory storage without encoding for optimal performance.
 // The storage uses a standard Go map protected by a read-write mutex for thread safety.
@@ -121,11 +190,27 @@ type mightyMapDefaultStorage[K comparable] struct {
 //   - K: the key type, must be comparable
 //   - V: the value type, can be any type
 //
+// Parameters:
+//   - optfuncs: Optional configuration functions that modify defaultOpts settings
+//
 // Returns a new IMightyMapStorage instance ready for use.
-func NewMightyMapDefaultStorage[K comparable, V any]() IMightyMapStorage[K, V] {
+func NewMightyMapDefaultStorage[K comparable, V any](optfuncs ...OptionFuncDefault) IMightyMapStorage[K, V] {
+	opts := &defaultOpts{snapshotRange: true}
+	for _, optfunc := range optfuncs {
+		optfunc(opts)
+	}
+
 	return &mightyMapDirectStorage[K, V]{
-		data:  make(map[K]V),
-		mutex: &sync.RWMutex{},
+		data:     make(map[K]V),
+		mutex:    &sync.RWMutex{},
+		expiry:   newExpiryTracker[K](opts.expire, opts.slidingExpiration),
+		order:    newOrderIndex[K](opts.ordering),
+		due:      newDueIndex[K](),
+		priority: newPriorityIndex[K](),
+		stored:   newStoreNotifier(),
+		ranging:  newRangeGuard(),
+
+		snapshotRange: opts.snapshotRange,
 	}
 }
 
@@ -143,6 +228,13 @@ func (c *mightyMapDirectStorage[K, V]) Load(_ context.Context, key K) (value V,
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 	value, ok = c.data[key]
+	if !ok {
+		return
+	}
+	if !c.visible(key, c.clock()) {
+		return *new(V), false
+	}
+	c.expiry.slide(key)
 	return
 }
 
@@ -154,9 +246,72 @@ func (c *mightyMapDirectStorage[K, V]) Load(_ context.Context, key K) (value V,
 //   - key: the key to store
 //   - value: the value to associate with the key
 func (c *mightyMapDirectStorage[K, V]) Store(_ context.Context, key K, value V) {
-	c.mutex.Lock()
+	c.store(key, value, time.Time{})
+}
+
+// StoreAt stores a key-value pair that Load, Range, Keys, Len and Next ignore until visibleAt.
+// Its expiration starts at visibleAt. A timer wakes up NextWait when the entry becomes due.
+func (c *mightyMapDirectStorage[K, V]) StoreAt(_ context.Context, key K, value V, visibleAt time.Time) error {
+	c.store(key, value, visibleAt)
+	if d := time.Until(visibleAt); d > 0 {
+		time.AfterFunc(d, c.stored.notify)
+	}
+	return nil
+}
+
+// StoreWithPriority stores a key-value pair that Next returns before the entries with a lower
+// priority or without one, after the entries with the same priority that were stored earlier.
+func (c *mightyMapDirectStorage[K, V]) StoreWithPriority(_ context.Context, key K, value V, priority int) error {
+	c.lock()
 	defer c.mutex.Unlock()
+	c.storeLocked(key, value, time.Time{})
+	c.priority.set(key, priority, true)
+	return nil
+}
+
+// SetPriority changes the priority of an entry, or gives it one, without rewriting its value.
+// The entry keeps its place among the entries with the same priority.
+// Returns false if the key is not present.
+func (c *mightyMapDirectStorage[K, V]) SetPriority(_ context.Context, key K, priority int) (bool, error) {
+	c.lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.data[key]; !ok || !c.visible(key, c.clock()) {
+		return false, nil
+	}
+	c.priority.set(key, priority, false)
+	return true, nil
+}
+
+// store writes key, scheduled at visibleAt unless it is zero.
+func (c *mightyMapDirectStorage[K, V]) store(key K, value V, visibleAt time.Time) {
+	c.lock()
+	defer c.mutex.Unlock()
+	c.storeLocked(key, value, visibleAt)
+}
+
+// storeLocked is store with the write lock held. Scheduling an entry drops its priority.
+func (c *mightyMapDirectStorage[K, V]) storeLocked(key K, value V, visibleAt time.Time) {
+	if _, ok := c.data[key]; ok && !c.expiry.alive(key, c.expiry.now()) {
+		// an expired entry that was not purged yet is stored as a new one
+		c.order.remove(key)
+		c.priority.remove(key)
+	}
 	c.data[key] = value
+	c.expiry.setFrom(key, visibleAt)
+	c.due.set(key, visibleAt)
+	if !visibleAt.IsZero() {
+		c.priority.remove(key)
+	}
+	c.order.add(key)
+	if c.expiry.purgeDue() {
+		for _, k := range c.expiry.expired() {
+			delete(c.data, k)
+			c.order.remove(k)
+			c.due.remove(k)
+			c.priority.remove(k)
+		}
+	}
+	c.stored.notify()
 }
 
 // Delete removes one or more keys and their associated values from the direct storage.
@@ -166,44 +321,95 @@ func (c *mightyMapDirectStorage[K, V]) Store(_ context.Context, key K, value V)
 //   - ctx: context for the operation (currently unused but maintained for interface compatibility)
 //   - keys: one or more keys to remove from storage
 func (c *mightyMapDirectStorage[K, V]) Delete(_ context.Context, keys ...K) {
-	c.mutex.Lock()
+	c.lock()
 	defer c.mutex.Unlock()
 	for _, key := range keys {
 		delete(c.data, key)
+		c.expiry.remove(key)
+		c.order.remove(key)
+		c.due.remove(key)
+		c.priority.remove(key)
 	}
 }
 
-// Range iterates over all key-value pairs in the direct storage in an unspecified order.
-// The iteration uses a read lock to ensure data consistency during traversal.
+// Range iterates over all key-value pairs in the direct storage in an unspecified order,
+// or in insertion order with FIFO ordering.
+// It iterates over a copy of the keys, so f may write to the storage; see
+// WithDefaultStorageSnapshotRange for the semantics and for holding the read lock instead.
 // If the provided function returns false, iteration stops early.
 //
 // Parameters:
-//   - ctx: context for the operation (currently unused but maintained for interface compatibility)
+//   - ctx: context for the operation, passed to Keys in snapshot mode
 //   - f: function called for each key-value pair; return false to stop iteration
-func (c *mightyMapDirectStorage[K, V]) Range(_ context.Context, f func(key K, value V) bool) {
+func (c *mightyMapDirectStorage[K, V]) Range(ctx context.Context, f func(key K, value V) bool) {
+	if c.snapshotRange {
+		for _, k := range c.Keys(ctx) {
+			if v, ok := c.peek(k); ok && !f(k, v) {
+				return
+			}
+		}
+		return
+	}
+
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	defer c.ranging.leave(c.ranging.enter())
+	now := c.clock()
+	if c.order != nil {
+		c.order.each(func(k K) bool {
+			return !c.visible(k, now) || f(k, c.data[k])
+		})
+		return
+	}
 	for k, v := range c.data {
+		if !c.visible(k, now) {
+			continue
+		}
 		if !f(k, v) {
 			break
 		}
 	}
 }
 
-// Keys returns all keys in the direct storage in an unspecified order.
+// peek returns the value of a visible key without restarting its expiration.
+func (c *mightyMapDirectStorage[K, V]) peek(key K) (value V, ok bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	value, ok = c.data[key]
+	if !ok || !c.visible(key, c.clock()) {
+		return *new(V), false
+	}
+	return value, true
+}
+
+// Keys returns all keys in the direct storage in an unspecified order,
+// or in insertion order with FIFO ordering.
 // This operation uses a read lock to ensure data consistency during traversal.
 func (c *mightyMapDirectStorage[K, V]) Keys(_ context.Context) []K {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	now := c.clock()
 	keys := []K{}
+	if c.order != nil {
+		c.order.each(func(k K) bool {
+			if c.visible(k, now) {
+				keys = append(keys, k)
+			}
+			return true
+		})
+		return keys
+	}
 	for k := range c.data {
-		keys = append(keys, k)
+		if c.visible(k, now) {
+			keys = append(keys, k)
+		}
 	}
 	return keys
 }
 
 // Len returns the current number of key-value pairs in the direct storage.
 // This operation uses a read lock to ensure an accurate count.
+// When expiration is enabled the entries have to be visited to skip expired ones.
 //
 // Parameters:
 //   - ctx: context for the operation (currently unused but maintained for interface compatibility)
@@ -212,7 +418,17 @@ func (c *mightyMapDirectStorage[K, V]) Keys(_ context.Context) []K {
 func (c *mightyMapDirectStorage[K, V]) Len(_ context.Context) int {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	return len(c.data)
+	now := c.clock()
+	if c.expiry == nil {
+		return len(c.data) - c.due.pending(now)
+	}
+	count := 0
+	for k := range c.data {
+		if c.visible(k, now) {
+			count++
+		}
+	}
+	return count
 }
 
 // Clear removes all key-value pairs from the direct storage.
@@ -221,39 +437,173 @@ func (c *mightyMapDirectStorage[K, V]) Len(_ context.Context) int {
 // Parameters:
 //   - ctx: context for the operation (currently unused but maintained for interface compatibility)
 func (c *mightyMapDirectStorage[K, V]) Clear(_ context.Context) {
-	c.mutex.Lock()
+	c.lock()
 	defer c.mutex.Unlock()
 	c.data = make(map[K]V)
+	c.expiry.reset()
+	c.order.reset()
+	c.due.reset()
+	c.priority.reset()
 }
 
 // Next returns and removes the next key-value pair from the direct storage.
-// The iteration order is not specified and depends on Go's map iteration behavior.
-// This operation is atomic - the key-value pair is removed as part of retrieval.
-//
-// Note: This method has a known limitation with zero-value keys. If a key equals
-// the zero value of type K, the method may not handle it correctly due to the
-// zero-value detection mechanism used.
+// Entries stored with a priority come first, the highest priority first.
+// The order of the other entries is not specified and depends on Go's map iteration behavior.
+// With FIFO ordering the oldest entry is returned instead.
+// This operation is atomic - the key-value pair is found and removed under a single write lock,
+// so concurrent callers each receive a different entry.
 //
 // Parameters:
-//   - ctx: context for the operation, passed to Range and Delete methods
+//   - ctx: context for the operation (currently unused but maintained for interface compatibility)
 //
 // Returns:
 //   - key: the key of the retrieved pair, zero value if storage is empty
 //   - value: the value of the retrieved pair, zero value if storage is empty
 //   - ok: true if a pair was found and removed, false if storage is empty
-func (c *mightyMapDirectStorage[K, V]) Next(ctx context.Context) (key K, value V, ok bool) {
-	c.Range(ctx, func(k K, v V) bool {
-		value = v
-		key = k
-		return false
+func (c *mightyMapDirectStorage[K, V]) Next(_ context.Context) (key K, value V, ok bool) {
+	return c.takeNext()
+}
+
+// nextOrdered removes and returns the oldest entry under a single write lock. Expired entries
+// found at the front are dropped on the way.
+func (c *mightyMapDirectStorage[K, V]) nextOrdered() (key K, value V, ok bool) {
+	c.lock()
+	defer c.mutex.Unlock()
+	now := c.clock()
+	for e := c.order.keys.Front(); e != nil; {
+		k, next := e.Value.(K), e.Next()
+		if !c.due.visible(k, now) {
+			// scheduled entries keep their place until they are due
+			e = next
+			continue
+		}
+		v, alive := c.data[k], c.expiry.alive(k, now)
+		delete(c.data, k)
+		c.expiry.remove(k)
+		c.order.remove(k)
+		c.due.remove(k)
+		c.priority.remove(k)
+		if alive {
+			return k, v, true
+		}
+		e = next
+	}
+	return key, value, false
+}
+
+// nextPrioritized removes and returns the entry with the highest priority under a single write
+// lock. Expired entries are dropped on the way.
+func (c *mightyMapDirectStorage[K, V]) nextPrioritized() (key K, value V, ok bool) {
+	c.lock()
+	defer c.mutex.Unlock()
+	now := c.clock()
+	for {
+		k, found := c.priority.pop()
+		if !found {
+			return key, value, false
+		}
+		v, alive := c.data[k], c.expiry.alive(k, now)
+		delete(c.data, k)
+		c.expiry.remove(k)
+		c.order.remove(k)
+		c.due.remove(k)
+		if alive {
+			return k, v, true
+		}
+	}
+}
+
+// NextWait removes and returns an entry like Next, waiting until one is stored while the storage
+// is empty. The entry is taken under a single write lock, so concurrent callers each receive a
+// different entry. Returns the context error if ctx is cancelled first.
+func (c *mightyMapDirectStorage[K, V]) NextWait(ctx context.Context) (key K, value V, err error) {
+	return waitNext(ctx, c.stored, 0, func(context.Context) (K, V, bool) {
+		return c.takeNext()
 	})
+}
 
-	if key != *new(K) {
-		ok = true
-		c.Delete(ctx, key)
+// takeNext removes and returns an entry under a single write lock, the one with the highest
+// priority or, with FIFO ordering, the oldest one.
+func (c *mightyMapDirectStorage[K, V]) takeNext() (key K, value V, ok bool) {
+	if key, value, ok = c.nextPrioritized(); ok {
+		return
+	}
+	if c.order != nil {
+		return c.nextOrdered()
 	}
+	c.lock()
+	defer c.mutex.Unlock()
+	now := c.clock()
+	for k, v := range c.data {
+		if c.visible(k, now) {
+			delete(c.data, k)
+			c.expiry.remove(k)
+			c.due.remove(k)
+			c.priority.remove(k)
+			return k, v, true
+		}
+	}
+	return key, value, false
+}
 
-	return
+// NextDue removes and returns the scheduled entry with the earliest due time, if that time has
+// passed. Entries stored with Store are never returned. Expired entries are dropped on the way.
+func (c *mightyMapDirectStorage[K, V]) NextDue(_ context.Context) (key K, value V, ok bool) {
+	c.lock()
+	defer c.mutex.Unlock()
+	now := time.Now().UnixNano()
+	for {
+		k, due := c.due.popDue(now)
+		if !due {
+			return key, value, false
+		}
+		v, alive := c.data[k], c.expiry.alive(k, now)
+		delete(c.data, k)
+		c.expiry.remove(k)
+		c.order.remove(k)
+		c.priority.remove(k)
+		if alive {
+			return k, v, true
+		}
+	}
+}
+
+// lock takes the write lock, panicking with ErrReentrantWrite if the calling goroutine holds the
+// read lock in a Range callback.
+func (c *mightyMapDirectStorage[K, V]) lock() {
+	c.ranging.lock(c.mutex)
+}
+
+// clock returns the current time in unix nanoseconds, or 0 when neither expiration nor
+// scheduled entries need it so callers can skip the clock read.
+func (c *mightyMapDirectStorage[K, V]) clock() int64 {
+	if c.expiry == nil && c.due.empty() {
+		return 0
+	}
+	return time.Now().UnixNano()
+}
+
+// visible reports whether key has neither expired nor is scheduled after now.
+func (c *mightyMapDirectStorage[K, V]) visible(key K, now int64) bool {
+	return c.expiry.alive(key, now) && c.due.visible(key, now)
+}
+
+// Touch restarts the expiration of the given keys without reading their values.
+// Missing and already expired keys are ignored. Without an expiration configured this is a no-op.
+// Only a read lock is taken, deadlines are updated atomically.
+//
+// Parameters:
+//   - ctx: context for the operation (currently unused but maintained for interface compatibility)
+//   - keys: one or more keys whose expiration should be extended
+//
+// Returns nil as no errors can occur.
+func (c *mightyMapDirectStorage[K, V]) Touch(_ context.Context, keys ...K) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, key := range keys {
+		c.expiry.touch(key)
+	}
+	return nil
 }
 
 // Close releases any resources held by the direct storage.
@@ -375,32 +725,23 @@ func (c *mightyMapDefaultStorage[K]) Clear(_ context.Context) {
 
 // Next returns and removes the next key-byte value pair from the byte storage.
 // The iteration order is not specified and depends on Go's map iteration behavior.
-// This operation is atomic - the key-value pair is removed as part of retrieval.
-//
-// Note: This method has a known limitation with zero-value keys. If a key equals
-// the zero value of type K, the method may not handle it correctly due to the
-// zero-value detection mechanism used.
+// This operation is atomic - the key-value pair is found and removed under a single write lock.
 //
 // Parameters:
-//   - ctx: context for the operation, passed to Range and Delete methods
+//   - ctx: context for the operation (currently unused but maintained for interface compatibility)
 //
 // Returns:
 //   - key: the key of the retrieved pair, zero value if storage is empty
 //   - value: the byte slice of the retrieved pair, nil if storage is empty
 //   - ok: true if a pair was found and removed, false if storage is empty
-func (c *mightyMapDefaultStorage[K]) Next(ctx context.Context) (key K, value []byte, ok bool) {
-	c.Range(ctx, func(k K, v []byte) bool {
-		value = v
-		key = k
-		return false
-	})
-
-	if key != *new(K) {
-		ok = true
-		c.Delete(ctx, key)
+func (c *mightyMapDefaultStorage[K]) Next(_ context.Context) (key K, value []byte, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for k, v := range c.data {
+		delete(c.data, k)
+		return k, v, true
 	}
-
-	return
+	return key, nil, false
 }
 
 // Close releases any resources held by the byte storage.
@@ -0,0 +1,509 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/maphash"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// defaultArenaSlabSize is the default size of the byte slabs holding the entries
+	defaultArenaSlabSize = 1 << 20
+	// defaultArenaCompactRatio is the default share of dead bytes that triggers a compaction
+	defaultArenaCompactRatio = 0.5
+	// arenaRecordHeader is the size of the header of a record: key length and value length,
+	// both 4 bytes little-endian
+	arenaRecordHeader = 8
+	// arenaMinSlots is the smallest index table of a segment
+	arenaMinSlots = 16
+)
+
+// Hashes 0 and 1 mark empty and deleted index slots; hashes of keys are moved above them.
+const (
+	arenaSlotEmpty = iota
+	arenaSlotDeleted
+	arenaSlotMinHash
+)
+
+// mightyMapArenaStorage is an in-memory byte storage for very large numbers of entries that keeps
+// the garbage collector out of its way: nothing it allocates per entry contains a pointer.
+//
+// Keys are split over segments, each with its own lock. A segment appends every entry it stores
+// as a record, the msgpack encoded key followed by the value, to the last of its byte slabs, and
+// indexes the records in an open-addressing table of hashes and slab locations. Overwriting or
+// deleting an entry leaves its old record behind as dead bytes; once they exceed the compaction
+// ratio the live records are copied into fresh slabs and the old ones are left to the garbage
+// collector. Records are never modified in place, so the values handed out stay valid.
+//
+// Keys are hashed with maphash.Comparable, consistent with ==. Their encodings are compared
+// directly only for key types whose encoding is unique, see arenaExactKeys; other keys, such as
+// floats where -0 == +0, are decoded and compared with ==.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+type mightyMapArenaStorage[K comparable] struct {
+	segments     []arenaSegment
+	mask         uint64
+	seed         maphash.Seed
+	slabSize     int
+	compactRatio float64
+	nextCursor   atomic.Uint64
+	// exact is set if equal keys have equal encodings and vice versa
+	exact bool
+}
+
+// arenaSegment holds the records and the index of one part of the keys.
+type arenaSegment struct {
+	mutex sync.RWMutex
+	slots []arenaSlot
+	// count is the number of entries, used the number of slots that are not empty
+	count int
+	used  int
+	slabs [][]byte
+	// next is the slot Next continues scanning at, so draining a segment is linear
+	next int
+	// live and dead are the bytes of the current and the overwritten or deleted records
+	live int64
+	dead int64
+}
+
+// arenaSlot is an index entry: the hash of the key and the location of its record, the slab
+// number in the upper and the offset in the lower 32 bits.
+type arenaSlot struct {
+	hash uint64
+	loc  uint64
+}
+
+type arenaOpts struct {
+	slabSize     int
+	segments     int
+	compactRatio float64
+}
+
+// OptionFuncArena is a function type that modifies arenaOpts configuration.
+// It allows customizing the arena storage through functional options pattern.
+type OptionFuncArena func(*arenaOpts)
+
+// WithArenaSlabSize sets the size in bytes of the slabs the entries are written to. Larger slabs
+// mean fewer allocations but more memory held by a segment with few entries. Entries larger
+// than a slab get a slab of their own.
+// **Default value**: `1 MiB`
+func WithArenaSlabSize(size int) OptionFuncArena {
+	return func(o *arenaOpts) {
+		o.slabSize = size
+	}
+}
+
+// WithArenaSegments sets the number of segments, rounded up to a power of two. Each segment has
+// its own lock, slabs and index, so writers to different segments do not contend.
+// **Default value**: `4 * GOMAXPROCS` rounded up to a power of two
+func WithArenaSegments(segments int) OptionFuncArena {
+	return func(o *arenaOpts) {
+		o.segments = segments
+	}
+}
+
+// WithArenaCompactRatio sets the share of dead bytes, left by overwritten and deleted entries,
+// at which a segment copies its live entries into fresh slabs. Lower values use less memory but
+// compact more often. 0 disables automatic compaction; Compact still works.
+// **Default value**: `0.5`
+func WithArenaCompactRatio(ratio float64) OptionFuncArena {
+	return func(o *arenaOpts) {
+		o.compactRatio = ratio
+	}
+}
+
+// NewMightyMapArenaStorage creates an in-memory storage that keeps keys and values msgpack
+// encoded in large byte slabs, indexed by a table without pointers, so the garbage collector
+// neither scans nor tracks individual entries. Use it for tens of millions of small entries,
+// where the default storage spends much of its time in garbage collection.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+//
+// Parameters:
+//   - optfuncs: Optional configuration functions that modify arenaOpts settings
+//
+// Returns a new IMightyMapStorage instance ready for use.
+func NewMightyMapArenaStorage[K comparable, V any](optfuncs ...OptionFuncArena) IMightyMapStorage[K, V] {
+	opts := &arenaOpts{
+		slabSize:     defaultArenaSlabSize,
+		segments:     shardedShardsPerProc * runtime.GOMAXPROCS(0),
+		compactRatio: defaultArenaCompactRatio,
+	}
+	for _, optfunc := range optfuncs {
+		optfunc(opts)
+	}
+
+	n := shardCount(opts.segments)
+	storage := &mightyMapArenaStorage[K]{
+		segments:     make([]arenaSegment, n),
+		mask:         uint64(n - 1),
+		seed:         maphash.MakeSeed(),
+		slabSize:     max(opts.slabSize, arenaRecordHeader),
+		compactRatio: opts.compactRatio,
+		exact:        arenaExactKeys[K](),
+	}
+	for i := range storage.segments {
+		storage.segments[i].slots = make([]arenaSlot, arenaMinSlots)
+	}
+	return newMsgpackAdapter[K, V](storage)
+}
+
+// arenaExactKeys reports whether two keys of type K are equal exactly when their msgpack
+// encodings are: booleans, integers and strings without custom encoders.
+func arenaExactKeys[K comparable]() bool {
+	t := reflect.TypeFor[K]()
+	if t.Implements(reflect.TypeFor[msgpack.CustomEncoder]()) || t.Implements(reflect.TypeFor[msgpack.Marshaler]()) ||
+		reflect.PointerTo(t).Implements(reflect.TypeFor[msgpack.CustomEncoder]()) ||
+		reflect.PointerTo(t).Implements(reflect.TypeFor[msgpack.Marshaler]()) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// locate encodes key and returns it with its hash and segment.
+func (c *mightyMapArenaStorage[K]) locate(key K) ([]byte, uint64, *arenaSegment) {
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		panic(err)
+	}
+	h := hashKey(c.seed, key)
+	if h < arenaSlotMinHash {
+		h += arenaSlotMinHash
+	}
+	// the index uses the low bits, segments the high ones
+	return keyBytes, h, &c.segments[(h>>32)&c.mask]
+}
+
+func (c *mightyMapArenaStorage[K]) Load(_ context.Context, key K) (value []byte, ok bool) {
+	keyBytes, h, s := c.locate(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	i, found := c.find(s, key, keyBytes, h)
+	if !found {
+		return nil, false
+	}
+	_, value = s.record(s.slots[i].loc)
+	return value, true
+}
+
+func (c *mightyMapArenaStorage[K]) Store(_ context.Context, key K, value []byte) {
+	keyBytes, h, s := c.locate(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	loc := s.append(keyBytes, value, c.slabSize)
+	i, found := c.find(s, key, keyBytes, h)
+	if found {
+		s.release(s.slots[i].loc)
+		s.slots[i].loc = loc
+		c.maybeCompact(s)
+		return
+	}
+	if s.slots[i].hash == arenaSlotEmpty {
+		s.used++
+	}
+	s.slots[i] = arenaSlot{hash: h, loc: loc}
+	s.count++
+	if s.used*4 > len(s.slots)*3 {
+		s.resize()
+	}
+}
+
+func (c *mightyMapArenaStorage[K]) Delete(_ context.Context, keys ...K) {
+	for _, key := range keys {
+		keyBytes, h, s := c.locate(key)
+		s.mutex.Lock()
+		if i, found := c.find(s, key, keyBytes, h); found {
+			s.remove(i)
+			c.maybeCompact(s)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Range visits the segments one after another, each under its read lock, so every entry that
+// exists during the whole call is visited exactly once. Entries whose key can not be decoded are
+// skipped. If f returns false, iteration stops early.
+func (c *mightyMapArenaStorage[K]) Range(_ context.Context, f func(key K, value []byte) bool) {
+	for i := range c.segments {
+		if !c.each(&c.segments[i], f) {
+			return
+		}
+	}
+}
+
+// each calls f for every entry of s under its read lock, reporting whether f asked to continue.
+func (c *mightyMapArenaStorage[K]) each(s *arenaSegment, f func(key K, value []byte) bool) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, slot := range s.slots {
+		if slot.hash < arenaSlotMinHash {
+			continue
+		}
+		keyBytes, value := s.record(slot.loc)
+		var key K
+		if err := msgpack.Unmarshal(keyBytes, &key); err != nil {
+			continue
+		}
+		if !f(key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *mightyMapArenaStorage[K]) Keys(ctx context.Context) []K {
+	keys := []K{}
+	c.Range(ctx, func(key K, _ []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Next removes and returns an entry, starting at a different segment for each call so
+// concurrent callers rarely contend. Within a segment it continues after the slot of the
+// previous entry and wraps around, so the slots emptied before are not scanned again.
+func (c *mightyMapArenaStorage[K]) Next(_ context.Context) (key K, value []byte, ok bool) {
+	start := c.nextCursor.Add(1)
+	for n := range uint64(len(c.segments)) {
+		s := &c.segments[(start+n)&c.mask]
+		s.mutex.Lock()
+		for j := range s.slots {
+			i := (s.next + j) & (len(s.slots) - 1)
+			slot := s.slots[i]
+			if slot.hash < arenaSlotMinHash {
+				continue
+			}
+			keyBytes, v := s.record(slot.loc)
+			if err := msgpack.Unmarshal(keyBytes, &key); err != nil {
+				continue
+			}
+			s.remove(i)
+			s.next = i + 1
+			c.maybeCompact(s)
+			s.mutex.Unlock()
+			return key, v, true
+		}
+		s.mutex.Unlock()
+	}
+	return key, nil, false
+}
+
+// Len counts the entries holding the read locks of all segments at once.
+func (c *mightyMapArenaStorage[K]) Len(_ context.Context) int {
+	for i := range c.segments {
+		c.segments[i].mutex.RLock()
+	}
+	count := 0
+	for i := range c.segments {
+		count += c.segments[i].count
+		c.segments[i].mutex.RUnlock()
+	}
+	return count
+}
+
+// Clear drops the slabs and indexes of all segments, holding all their write locks at once.
+func (c *mightyMapArenaStorage[K]) Clear(_ context.Context) {
+	for i := range c.segments {
+		c.segments[i].mutex.Lock()
+	}
+	for i := range c.segments {
+		s := &c.segments[i]
+		s.slots = make([]arenaSlot, arenaMinSlots)
+		s.count, s.used, s.next = 0, 0, 0
+		s.slabs, s.live, s.dead = nil, 0, 0
+		s.mutex.Unlock()
+	}
+}
+
+// Compact copies the live entries of every segment with dead bytes into fresh slabs, one
+// segment at a time, and shrinks indexes that are mostly empty.
+func (c *mightyMapArenaStorage[K]) Compact(ctx context.Context) error {
+	for i := range c.segments {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s := &c.segments[i]
+		s.mutex.Lock()
+		s.compact(c.slabSize)
+		s.mutex.Unlock()
+	}
+	return nil
+}
+
+// MemoryUsage returns the bytes held by the indexes and slabs of all segments.
+func (c *mightyMapArenaStorage[K]) MemoryUsage(_ context.Context) (MemoryUsage, error) {
+	var usage MemoryUsage
+	for i := range c.segments {
+		s := &c.segments[i]
+		s.mutex.RLock()
+		usage.Index += int64(len(s.slots)) * int64(unsafe.Sizeof(arenaSlot{}))
+		for _, slab := range s.slabs {
+			usage.Allocated += int64(cap(slab))
+		}
+		usage.Live += s.live
+		usage.Dead += s.dead
+		s.mutex.RUnlock()
+	}
+	return usage, nil
+}
+
+func (c *mightyMapArenaStorage[K]) Close(_ context.Context) error {
+	// nothing to do
+	return nil
+}
+
+// maybeCompact compacts s when its dead bytes exceed the compaction ratio and a slab.
+// The caller must hold the write lock of s.
+func (c *mightyMapArenaStorage[K]) maybeCompact(s *arenaSegment) {
+	if c.compactRatio > 0 && s.dead > int64(c.slabSize) && float64(s.dead) > c.compactRatio*float64(s.live+s.dead) {
+		s.compact(c.slabSize)
+	}
+}
+
+// find returns the slot of key in s, or the slot to insert it at and false. The caller must hold
+// a lock.
+func (c *mightyMapArenaStorage[K]) find(s *arenaSegment, key K, keyBytes []byte, h uint64) (int, bool) {
+	mask := uint64(len(s.slots) - 1)
+	insert := -1
+	for i := h & mask; ; i = (i + 1) & mask {
+		slot := s.slots[i]
+		switch {
+		case slot.hash == arenaSlotEmpty:
+			if insert < 0 {
+				insert = int(i)
+			}
+			return insert, false
+		case slot.hash == arenaSlotDeleted:
+			if insert < 0 {
+				insert = int(i)
+			}
+		case slot.hash == h:
+			if k, _ := s.record(slot.loc); c.equal(key, keyBytes, k) {
+				return int(i), true
+			}
+		}
+	}
+}
+
+// equal reports whether the encoded record key stored equals key, whose encoding is keyBytes.
+func (c *mightyMapArenaStorage[K]) equal(key K, keyBytes, stored []byte) bool {
+	if c.exact {
+		return bytes.Equal(stored, keyBytes)
+	}
+	var k K
+	return msgpack.Unmarshal(stored, &k) == nil && k == key
+}
+
+// record returns the key and value of the record at loc. The value is capped, so appending to
+// it can not overwrite the next record.
+func (s *arenaSegment) record(loc uint64) (key, value []byte) {
+	return arenaRecord(s.slabs, loc)
+}
+
+// arenaRecord returns the key and value of the record at loc in slabs.
+func arenaRecord(slabs [][]byte, loc uint64) (key, value []byte) {
+	slab := slabs[loc>>32]
+	off := uint32(loc)
+	keyLen := binary.LittleEndian.Uint32(slab[off:])
+	valueLen := binary.LittleEndian.Uint32(slab[off+4:])
+	start := off + arenaRecordHeader
+	end := start + keyLen + valueLen
+	return slab[start : start+keyLen : start+keyLen], slab[start+keyLen : end : end]
+}
+
+// append writes a record to the last slab, starting a new one when it is full, and returns its
+// location. The caller must hold the write lock.
+func (s *arenaSegment) append(key, value []byte, slabSize int) uint64 {
+	size := arenaRecordHeader + len(key) + len(value)
+	last := len(s.slabs) - 1
+	if last < 0 || len(s.slabs[last])+size > cap(s.slabs[last]) {
+		s.slabs = append(s.slabs, make([]byte, 0, max(slabSize, size)))
+		last++
+	}
+	slab := s.slabs[last]
+	off := len(slab)
+	slab = binary.LittleEndian.AppendUint32(slab, uint32(len(key)))
+	slab = binary.LittleEndian.AppendUint32(slab, uint32(len(value)))
+	slab = append(slab, key...)
+	s.slabs[last] = append(slab, value...)
+	s.live += int64(size)
+	return uint64(last)<<32 | uint64(off)
+}
+
+// release accounts the record at loc as dead.
+func (s *arenaSegment) release(loc uint64) {
+	key, value := s.record(loc)
+	size := int64(arenaRecordHeader + len(key) + len(value))
+	s.live -= size
+	s.dead += size
+}
+
+// remove deletes the entry in slot i. The caller must hold the write lock.
+func (s *arenaSegment) remove(i int) {
+	s.release(s.slots[i].loc)
+	s.slots[i] = arenaSlot{hash: arenaSlotDeleted}
+	s.count--
+}
+
+// resize rebuilds the index with room for twice the entries, dropping deleted slots. Only the
+// stored hashes are needed, the records are not read. The caller must hold the write lock.
+func (s *arenaSegment) resize() {
+	n := arenaMinSlots
+	for n < s.count*4 {
+		n <<= 1
+	}
+	slots := make([]arenaSlot, n)
+	mask := uint64(n - 1)
+	for _, slot := range s.slots {
+		if slot.hash < arenaSlotMinHash {
+			continue
+		}
+		i := slot.hash & mask
+		for slots[i].hash != arenaSlotEmpty {
+			i = (i + 1) & mask
+		}
+		slots[i] = slot
+	}
+	s.slots = slots
+	s.used = s.count
+	s.next = 0
+}
+
+// compact copies the live records into fresh slabs, leaving the old ones to the garbage
+// collector, and rebuilds the index if it is mostly empty or deleted slots. The caller must hold
+// the write lock.
+func (s *arenaSegment) compact(slabSize int) {
+	if s.dead > 0 {
+		old := s.slabs
+		s.slabs, s.live, s.dead = nil, 0, 0
+		for i, slot := range s.slots {
+			if slot.hash < arenaSlotMinHash {
+				continue
+			}
+			key, value := arenaRecord(old, slot.loc)
+			s.slots[i].loc = s.append(key, value, slabSize)
+		}
+	}
+	if len(s.slots) > arenaMinSlots && (s.count*8 < len(s.slots) || s.used > s.count*2) {
+		s.resize()
+	}
+}
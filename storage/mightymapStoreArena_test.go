@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestArenaStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapArenaStorage[int, string](WithArenaSegments(3), WithArenaSlabSize(256))
+	defer store.Close(ctx)
+	if n := len(store.(*msgpackAdapter[int, string]).storage.(*mightyMapArenaStorage[int]).segments); n != 4 {
+		t.Errorf("segments = %d; want 4", n)
+	}
+
+	for i := 0; i < 1000; i++ {
+		store.Store(ctx, i, fmt.Sprintf("value-%d", i))
+	}
+	// overwrite with a value larger than a slab
+	large := strings.Repeat("x", 1000)
+	store.Store(ctx, 5, large)
+	store.Delete(ctx, 10, 20, 5000)
+	if n := store.Len(ctx); n != 998 {
+		t.Errorf("Len() = %d; want 998", n)
+	}
+	if _, ok := store.Load(ctx, 10); ok {
+		t.Error("Load() found a deleted key")
+	}
+	if v, ok := store.Load(ctx, 999); !ok || v != "value-999" {
+		t.Errorf("Load(999) = %q, %v; want value-999, true", v, ok)
+	}
+	if v, ok := store.Load(ctx, 5); !ok || v != large {
+		t.Errorf("Load(5) returned %d bytes, %v; want %d, true", len(v), ok, len(large))
+	}
+
+	keys := store.Keys(ctx)
+	sort.Ints(keys)
+	if len(keys) != 998 || keys[0] != 0 || keys[997] != 999 {
+		t.Errorf("Keys() returned %d keys from %v to %v; want 998 from 0 to 999", len(keys), keys[0], keys[len(keys)-1])
+	}
+	visited := 0
+	store.Range(ctx, func(int, string) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Errorf("Range() visited %d entries after stopping at 10", visited)
+	}
+
+	seen := map[int]bool{}
+	for {
+		key, _, ok := store.Next(ctx)
+		if !ok {
+			break
+		}
+		if seen[key] {
+			t.Fatalf("Next() returned %d twice", key)
+		}
+		seen[key] = true
+	}
+	if len(seen) != 998 || store.Len(ctx) != 0 {
+		t.Errorf("Next() returned %d keys, %d left; want 998, 0", len(seen), store.Len(ctx))
+	}
+
+	store.Store(ctx, 1, "one")
+	store.Clear(ctx)
+	if n := store.Len(ctx); n != 0 {
+		t.Errorf("Len() after Clear() = %d; want 0", n)
+	}
+}
+
+func TestArenaStorageCompaction(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapArenaStorage[string, []byte](WithArenaSegments(1), WithArenaSlabSize(4096))
+	usage := func() MemoryUsage {
+		t.Helper()
+		u, err := store.(IMightyMapMemoryStorage).MemoryUsage(ctx)
+		if err != nil {
+			t.Fatalf("MemoryUsage() error: %v", err)
+		}
+		return u
+	}
+
+	value := make([]byte, 100)
+	for i := 0; i < 1000; i++ {
+		store.Store(ctx, fmt.Sprintf("key-%d", i), value)
+	}
+	full := usage()
+	if full.Live == 0 || full.Dead != 0 || full.Allocated < full.Live || full.Index == 0 {
+		t.Errorf("MemoryUsage() = %+v after inserts; want only live bytes", full)
+	}
+
+	// deleting most entries compacts automatically, keeping dead bytes under half
+	for i := 0; i < 900; i++ {
+		store.Delete(ctx, fmt.Sprintf("key-%d", i))
+	}
+	u := usage()
+	if u.Dead > u.Live+u.Dead/2 || u.Allocated >= full.Allocated/2 {
+		t.Errorf("MemoryUsage() = %+v after deletes; want compacted slabs, was %+v", u, full)
+	}
+	if v, ok := store.Load(ctx, "key-950"); !ok || len(v) != 100 {
+		t.Errorf("Load() after compaction = %d bytes, %v; want 100, true", len(v), ok)
+	}
+
+	// an explicit compaction drops all dead bytes and shrinks the index
+	for i := 900; i < 990; i++ {
+		store.Delete(ctx, fmt.Sprintf("key-%d", i))
+	}
+	if err := store.(IMightyMapCompactStorage).Compact(ctx); err != nil {
+		t.Fatalf("Compact() error: %v", err)
+	}
+	u = usage()
+	if u.Dead != 0 || u.Index >= full.Index {
+		t.Errorf("MemoryUsage() = %+v after Compact(); want no dead bytes and a smaller index than %+v", u, full)
+	}
+	if n := store.Len(ctx); n != 10 {
+		t.Errorf("Len() = %d; want 10", n)
+	}
+	for i := 990; i < 1000; i++ {
+		if _, ok := store.Load(ctx, fmt.Sprintf("key-%d", i)); !ok {
+			t.Errorf("Load(key-%d) failed after Compact()", i)
+		}
+	}
+}
+
+func TestArenaStorageConcurrent(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapArenaStorage[int, int](WithArenaSlabSize(512))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := g*1000 + i%500
+				store.Store(ctx, key, i)
+				if i%3 == 0 {
+					store.Delete(ctx, key)
+				}
+				store.Load(ctx, key)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g := 0; g < 8; g++ {
+		for i := 1500; i < 2000; i++ {
+			v, ok := store.Load(ctx, g*1000+i%500)
+			if i%3 == 0 && ok || i%3 != 0 && (!ok || v != i) {
+				t.Fatalf("Load(%d) = %d, %v; want the last write %d", g*1000+i%500, v, ok, i)
+			}
+		}
+	}
+}
+
+func TestArenaStorageSignedZeroKeys(t *testing.T) {
+	ctx := context.Background()
+	type point struct{ X, Y float64 }
+	floats := NewMightyMapArenaStorage[float64, int]()
+	points := NewMightyMapArenaStorage[point, int]()
+	defer floats.Close(ctx)
+	defer points.Close(ctx)
+
+	// -0 == +0, so both must be the same key although their encodings differ
+	negZero := math.Copysign(0, -1)
+	floats.Store(ctx, negZero, 1)
+	floats.Store(ctx, 0, 2)
+	points.Store(ctx, point{negZero, 1}, 1)
+	points.Store(ctx, point{0, 1}, 2)
+	for name, n := range map[string]int{"float64": floats.Len(ctx), "point": points.Len(ctx)} {
+		if n != 1 {
+			t.Errorf("%s: Len() = %d; want 1", name, n)
+		}
+	}
+	if v, ok := floats.Load(ctx, negZero); !ok || v != 2 {
+		t.Errorf("Load(-0) = %d, %v; want 2, true", v, ok)
+	}
+	points.Delete(ctx, point{negZero, 1})
+	if n := points.Len(ctx); n != 0 {
+		t.Errorf("Len() after Delete() = %d; want 0", n)
+	}
+}
+
+func TestArenaStorageNextWrapsAround(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapArenaStorage[int, int](WithArenaSegments(1))
+	defer store.Close(ctx)
+
+	for i := 0; i < 10; i++ {
+		store.Store(ctx, i, i)
+	}
+	for i := 0; i < 5; i++ {
+		if _, _, ok := store.Next(ctx); !ok {
+			t.Fatal("Next() returned no entry")
+		}
+	}
+	// keys stored after the cursor moved may land in slots before it
+	for i := 100; i < 110; i++ {
+		store.Store(ctx, i, i)
+	}
+	count := 0
+	for {
+		if _, _, ok := store.Next(ctx); !ok {
+			break
+		}
+		count++
+	}
+	if count != 15 || store.Len(ctx) != 0 {
+		t.Errorf("Next() returned %d entries, %d left; want 15, 0", count, store.Len(ctx))
+	}
+}
@@ -1,20 +1,84 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/dgraph-io/badger/v4/options"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/v2/z"
 	msgpack "github.com/vmihailenco/msgpack/v5"
 )
 
+// Reserved keys used for bookkeeping. MessagePack never emits 0xc1 as the first byte of an
+// encoded value, so keys with this prefix can not collide with encoded user keys.
+var (
+	badgerMetaPrefix = []byte{0xc1}
+	badgerLenKey     = []byte{0xc1, 'l', 'e', 'n'}
+)
+
+// badgerParallelRangeBatchSize is the number of entries handed to a ParallelRange worker at once.
+const badgerParallelRangeBatchSize = 256
+
+// badgerLoadMaxPendingWrites bounds the number of pending writes while restoring a backup.
+const badgerLoadMaxPendingWrites = 256
+
+// badgerDeleteBatchSize bounds the number of deletes per transaction to stay below
+// Badger's transaction size limits.
+const badgerDeleteBatchSize = 1000
+
 type mightyMapBadgerStorage[K comparable] struct {
-	db          *badger.DB
-	len         atomic.Int64
-	initLenCall atomic.Bool
+	db *badger.DB
+	// len mirrors the counter persisted under badgerLenKey. Writes that change the number of
+	// keys update the counter within their own transaction and retry when a concurrent write
+	// updated it first. They share writeMu, which Clear, Restore and BulkLoad take exclusively.
+	// Without conflict detection concurrent updates of the counter would be lost, so writes
+	// take writeMu exclusively as well, see lockWrites.
+	len             atomic.Int64
+	writeMu         sync.RWMutex
+	detectConflicts bool
+	// recountMu keeps concurrent Len calls from recounting at the same time
+	recountMu sync.Mutex
+	// nextHint is the last key popped by Next
+	nextHint atomic.Pointer[[]byte]
+	expire   time.Duration
+	sliding  bool
+	// exactLen makes Len scan the keys with expiration; otherwise the counter is recounted at
+	// most once per recountInterval, countedAt holds the time of the last recount in UnixNano
+	exactLen        bool
+	recountInterval time.Duration
+	countedAt       atomic.Int64
+	// timestamps enables the write time envelope of values, see encodeValue
+	timestamps bool
+	readOnly   bool
+	// ordered enables FIFO ordering; nextSeq is the last sequence number handed out
+	ordered bool
+	nextSeq atomic.Uint64
+	// prioritySeq is the last sequence number of a priority entry
+	prioritySeq atomic.Uint64
+	// stored wakes up NextWait, which also polls every pollInterval
+	stored       *storeNotifier
+	pollInterval time.Duration
+
+	numCompactors int
+	gcPercentage  float64
+	gcCallback    func(BadgerGCResult)
+	gcMu          sync.Mutex
+	// stop ends the maintenance goroutine, which closes done when it returns
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // OptionFuncBadger is a function type that modifies badgerOpts configuration.
@@ -33,7 +97,8 @@ type OptionFuncBadger func(*badgerOpts)
 //  1. Starts with default options and applies any provided option functions
 //  2. Configures BadgerDB options including compression, logging level, and performance settings
 //  3. Opens a BadgerDB instance with the configured options
-//  4. Starts a background goroutine for value log garbage collection
+//  4. Starts a background goroutine for value log garbage collection, stopped by Close,
+//     unless the database is in-memory or read-only
 //
 // Returns:
 //   - IMightyMapStorage[K, V]: A new BadgerDB-backed storage implementation
@@ -81,7 +146,7 @@ func NewMightyMapBadgerStorage[K comparable, V any](optfuncs ...OptionFuncBadger
 	badgerOpts = badgerOpts.
 		WithNumCompactors(opts.numCompactors).
 		WithMetricsEnabled(opts.metricsEnabled).
-		WithDetectConflicts(false).
+		WithDetectConflicts(opts.detectConflicts).
 		WithLoggingLevel(loggingLevel).
 		WithBlockSize(opts.blockSize).
 		WithNumVersionsToKeep(opts.numVersionsToKeep).
@@ -90,7 +155,8 @@ func NewMightyMapBadgerStorage[K comparable, V any](optfuncs ...OptionFuncBadger
 		WithMemTableSize(opts.memTableSize).
 		WithBlockCacheSize(opts.blockCacheSize).
 		WithValueThreshold(opts.valueThreshold).
-		WithSyncWrites(opts.syncWrites)
+		WithSyncWrites(opts.syncWrites).
+		WithReadOnly(opts.readOnly)
 
 	if opts.encryptionKey != "" {
 		badgerOpts = badgerOpts.
@@ -98,29 +164,234 @@ func NewMightyMapBadgerStorage[K comparable, V any](optfuncs ...OptionFuncBadger
 			WithEncryptionKeyRotationDuration(opts.encryptionKeyRotation)
 	}
 
+	if opts.readOnly && opts.memoryStorage {
+		panic("read-only mode requires an on-disk database, see WithMemoryStorage")
+	}
+	if opts.slidingExpiration && opts.expire > 0 && opts.numVersionsToKeep > 1 {
+		panic("sliding expiration can not be combined with version history, see WithSlidingExpiration")
+	}
+
 	db, err := badger.Open(badgerOpts)
 	if err != nil {
 		panic(err)
 	}
 
-	// start a goroutine to run value log GC, sensible defaults according to the docs
-	go func() {
-		ticker := time.NewTicker(opts.gcInterval)
-		defer ticker.Stop()
-		for range ticker.C {
-			_ = db.RunValueLogGC(opts.gcPercentage)
-		}
-	}()
-
 	storage := &mightyMapBadgerStorage[K]{
-		db:          db,
-		len:         atomic.Int64{},
-		initLenCall: atomic.Bool{},
+		db:              db,
+		len:             atomic.Int64{},
+		detectConflicts: opts.detectConflicts,
+		expire:          opts.expire,
+		sliding:         opts.slidingExpiration,
+		exactLen:        opts.exactLen,
+		recountInterval: opts.gcInterval,
+		timestamps:      opts.numVersionsToKeep > 1,
+		readOnly:        opts.readOnly,
+		ordered:         opts.ordering == FIFO,
+		stored:          newStoreNotifier(),
+		pollInterval:    opts.pollInterval,
+		numCompactors:   opts.numCompactors,
+		gcPercentage:    opts.gcPercentage,
+		gcCallback:      opts.gcCallback,
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	if err := storage.initLen(); err != nil {
+		db.Close()
+		panic(err)
+	}
+	if err := storage.initOrder(); err != nil {
+		db.Close()
+		panic(err)
+	}
+
+	// in-memory databases have no value log to collect, read-only ones must not change it
+	if opts.memoryStorage || opts.readOnly {
+		close(storage.done)
+	} else {
+		go storage.maintain(opts.gcInterval)
 	}
 	return newMsgpackAdapter[K, V](storage)
 }
 
-// Store adds a key-value pair to the Badger storage.
+// maintain runs value log garbage collection every interval until Close is called.
+// Following the Badger docs, each tick collects repeatedly until nothing is left to rewrite.
+func (c *mightyMapBadgerStorage[K]) maintain(interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			rewritten, err := c.runValueLogGC()
+			if !rewritten || err != nil {
+				break
+			}
+			select {
+			case <-c.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// runValueLogGC runs a single value log garbage collection and reports it to the callback.
+// Runs are serialized so Compact and the maintenance loop don't reject each other.
+func (c *mightyMapBadgerStorage[K]) runValueLogGC() (rewritten bool, err error) {
+	c.gcMu.Lock()
+	start := time.Now()
+	err = c.db.RunValueLogGC(c.gcPercentage)
+	c.gcMu.Unlock()
+
+	rewritten = err == nil
+	if errors.Is(err, badger.ErrNoRewrite) {
+		err = nil
+	}
+	if c.gcCallback != nil {
+		c.gcCallback(BadgerGCResult{Rewritten: rewritten, Err: err, Duration: time.Since(start)})
+	}
+	return rewritten, err
+}
+
+// isBadgerMetaKey reports whether a raw Badger key is a reserved bookkeeping key.
+func isBadgerMetaKey(key []byte) bool {
+	return bytes.HasPrefix(key, badgerMetaPrefix)
+}
+
+// initLen loads the persisted key counter. Databases written before the counter existed
+// are counted once with a key-only scan and the result is persisted, unless read-only.
+func (c *mightyMapBadgerStorage[K]) initLen() error {
+	var (
+		n     int64
+		found bool
+	)
+	err := c.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(badgerLenKey)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			n, found = decodeBadgerLen(val), true
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		n, err = c.countKeys()
+		if err != nil {
+			return err
+		}
+		if c.readOnly {
+			c.len.Store(n)
+			return nil
+		}
+		err = c.db.Update(func(txn *badger.Txn) error {
+			return c.setLen(txn, n)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.len.Store(n)
+	return nil
+}
+
+// countKeys counts the live user keys without fetching values.
+func (c *mightyMapBadgerStorage[K]) countKeys() (int64, error) {
+	var cnt int64
+	err := c.db.View(func(txn *badger.Txn) error {
+		cnt = countKeysIn(txn)
+		return nil
+	})
+	return cnt, err
+}
+
+// countKeysIn counts the live user keys visible to txn without fetching values.
+func countKeysIn(txn *badger.Txn) int64 {
+	opts := badger.IteratorOptions{
+		PrefetchValues: false,
+		Reverse:        false,
+		AllVersions:    false,
+	}
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	var cnt int64
+	for it.Rewind(); it.Valid(); it.Next() {
+		if isBadgerMetaKey(it.Item().Key()) {
+			continue
+		}
+		cnt++
+	}
+	return cnt
+}
+
+// addLen adds delta to the key counter persisted as part of txn. The counter is read within
+// txn, so two transactions that change it concurrently conflict and one of them is retried.
+func (c *mightyMapBadgerStorage[K]) addLen(txn *badger.Txn, delta int64) error {
+	var n int64
+	item, err := txn.Get(badgerLenKey)
+	switch {
+	case err == nil:
+		if err := item.Value(func(val []byte) error {
+			n = decodeBadgerLen(val)
+			return nil
+		}); err != nil {
+			return err
+		}
+	case err != badger.ErrKeyNotFound:
+		return err
+	}
+	return c.setLen(txn, n+delta)
+}
+
+// lockWrites locks writeMu for a write that may change the number of keys and returns the
+// function that unlocks it. Such writes run concurrently when conflicts are detected.
+func (c *mightyMapBadgerStorage[K]) lockWrites() (unlock func()) {
+	if !c.detectConflicts {
+		c.writeMu.Lock()
+		return c.writeMu.Unlock
+	}
+	c.writeMu.RLock()
+	return c.writeMu.RUnlock
+}
+
+// setLen persists the key counter as part of txn.
+func (c *mightyMapBadgerStorage[K]) setLen(txn *badger.Txn, n int64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(n))
+	return txn.Set(badgerLenKey, buf)
+}
+
+func decodeBadgerLen(val []byte) int64 {
+	if len(val) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(val))
+}
+
+// keyExists reports whether keyBytes is present within txn.
+func keyExists(txn *badger.Txn, keyBytes []byte) (bool, error) {
+	_, err := txn.Get(keyBytes)
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Store adds a key-value pair to the Badger storage. An existing key keeps its priority.
 func (c *mightyMapBadgerStorage[K]) Store(_ context.Context, key K, value []byte) {
 	// Serialize the key with MessagePack
 	keyBytes, err := msgpack.Marshal(key)
@@ -128,16 +399,110 @@ func (c *mightyMapBadgerStorage[K]) Store(_ context.Context, key K, value []byte
 		log.Printf("Error marshalling key: %v", err)
 		panic(err)
 	}
+	c.store(keyBytes, value, nil)
+}
+
+// store writes a key-value pair and, if extra is not nil, whatever extra writes in the same
+// transaction.
+func (c *mightyMapBadgerStorage[K]) store(keyBytes, value []byte, extra func(txn *badger.Txn) error) {
+	if c.readOnly {
+		panic(ErrReadOnly)
+	}
+	defer c.lockWrites()()
 
-	// Store in BadgerDB with proper error handling
-	err = c.db.Update(func(txn *badger.Txn) error {
-		return txn.Set(keyBytes, value)
+	// Store in BadgerDB with proper error handling; only new keys change the counter
+	// and, with FIFO ordering, are appended to the order
+	var added bool
+	err := c.updateRetrying(0, func(txn *badger.Txn) error {
+		added = false
+		exists, err := keyExists(txn, keyBytes)
+		if err != nil {
+			return err
+		}
+		if err := txn.SetEntry(c.newEntry(keyBytes, c.encodeValue(value))); err != nil {
+			return err
+		}
+		if extra != nil {
+			if err := extra(txn); err != nil {
+				return err
+			}
+		}
+		if exists {
+			return nil
+		}
+		if c.ordered {
+			if err := c.appendOrder(txn, keyBytes); err != nil {
+				return err
+			}
+		}
+		added = true
+		return c.addLen(txn, 1)
 	})
 	if err != nil {
 		log.Printf("Error storing value: %v", err)
 		panic(err)
 	}
-	c.len.Add(1)
+	if added {
+		c.len.Add(1)
+	}
+	c.stored.notify()
+}
+
+// newEntry creates a Badger entry for the key and value, carrying the configured TTL.
+func (c *mightyMapBadgerStorage[K]) newEntry(keyBytes, value []byte) *badger.Entry {
+	e := badger.NewEntry(keyBytes, value)
+	if c.expire > 0 {
+		e = e.WithTTL(c.expire)
+	}
+	return e
+}
+
+// badgerLoadConflictRetries is how often a sliding Load tries to restart the TTL of a key that
+// concurrent writes keep conflicting with before it reads the key without restarting it.
+const badgerLoadConflictRetries = 3
+
+// updateRetrying runs fn in an update transaction, retrying it when it conflicts with a
+// concurrent transaction, at most attempts times if attempts is positive. Writes that change the
+// number of keys conflict with each other on the key counter, so they retry until they succeed.
+// fn must be safe to run more than once.
+func (c *mightyMapBadgerStorage[K]) updateRetrying(attempts int, fn func(txn *badger.Txn) error) error {
+	for i := 1; ; i++ {
+		err := c.db.Update(fn)
+		if !errors.Is(err, badger.ErrConflict) || (attempts > 0 && i >= attempts) {
+			return err
+		}
+	}
+}
+
+// badgerTimestampMarker starts values that carry their write time, followed by the time in unix
+// nanoseconds as 8 big-endian bytes. Values are MessagePack encoded by the adapter and
+// MessagePack never emits 0xc1, so marked and unmarked values can not be confused.
+const (
+	badgerTimestampMarker     = 0xc1
+	badgerTimestampHeaderSize = 9
+)
+
+// encodeValue prefixes value with the current time when version history is kept, so
+// LoadVersions can report when each version was written.
+func (c *mightyMapBadgerStorage[K]) encodeValue(value []byte) []byte {
+	if !c.timestamps {
+		return value
+	}
+	buf := make([]byte, badgerTimestampHeaderSize+len(value))
+	buf[0] = badgerTimestampMarker
+	binary.BigEndian.PutUint64(buf[1:badgerTimestampHeaderSize], uint64(time.Now().UnixNano()))
+	copy(buf[badgerTimestampHeaderSize:], value)
+	return buf
+}
+
+// decodeBadgerValue strips the write time written by encodeValue. Values written without
+// version history have a zero timestamp.
+func decodeBadgerValue(raw []byte) (value []byte, written time.Time) {
+	if len(raw) < badgerTimestampHeaderSize || raw[0] != badgerTimestampMarker {
+		return raw, time.Time{}
+	}
+	nanos := int64(binary.BigEndian.Uint64(raw[1:badgerTimestampHeaderSize]))
+	return raw[badgerTimestampHeaderSize:], time.Unix(0, nanos)
 }
 
 func (c *mightyMapBadgerStorage[K]) Load(_ context.Context, key K) (value []byte, ok bool) {
@@ -149,8 +514,7 @@ func (c *mightyMapBadgerStorage[K]) Load(_ context.Context, key K) (value []byte
 	}
 	var valCopy []byte
 
-	// Read from BadgerDB
-	err = c.db.View(func(txn *badger.Txn) error {
+	read := func(txn *badger.Txn) error {
 		item, err := txn.Get(keyBytes)
 		if err != nil {
 			return err
@@ -162,38 +526,91 @@ func (c *mightyMapBadgerStorage[K]) Load(_ context.Context, key K) (value []byte
 		}
 
 		return nil
-	})
+	}
+
+	if c.sliding && c.expire > 0 && !c.readOnly {
+		// re-set the entry within the same transaction to restart its TTL
+		err = c.updateRetrying(badgerLoadConflictRetries, func(txn *badger.Txn) error {
+			if err := read(txn); err != nil {
+				return err
+			}
+			return txn.SetEntry(c.newEntry(keyBytes, valCopy))
+		})
+		if errors.Is(err, badger.ErrConflict) {
+			// the key is written so often that its TTL is restarted anyway
+			err = c.db.View(read)
+		}
+	} else {
+		// Read from BadgerDB
+		err = c.db.View(read)
+	}
 	if err != nil {
-		// Not found or other error
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			log.Printf("Error loading key: %v", err)
+		}
 		return nil, false
 	}
 
-	return valCopy, true
+	value, _ = decodeBadgerValue(valCopy)
+	return value, true
 }
 
-func (c *mightyMapBadgerStorage[K]) Delete(ctx context.Context, keys ...K) {
-	for _, key := range keys {
-		if _, ok := c.Load(ctx, key); !ok {
-			continue
-		}
+func (c *mightyMapBadgerStorage[K]) Delete(_ context.Context, keys ...K) {
+	if c.readOnly {
+		panic(ErrReadOnly)
+	}
+	defer c.lockWrites()()
 
-		keyBytes, err := msgpack.Marshal(key)
-		if err != nil {
-			panic(err)
-		}
+	for start := 0; start < len(keys); start += badgerDeleteBatchSize {
+		end := min(start+badgerDeleteBatchSize, len(keys))
 
-		err = c.db.Update(func(txn *badger.Txn) error {
-			return txn.Delete(keyBytes)
+		var removed int64
+		err := c.updateRetrying(0, func(txn *badger.Txn) error {
+			removed = 0
+			for _, key := range keys[start:end] {
+				keyBytes, err := msgpack.Marshal(key)
+				if err != nil {
+					return err
+				}
+				if c.ordered {
+					if err := c.removeOrder(txn, keyBytes); err != nil {
+						return err
+					}
+				}
+				if err := removeBadgerPriority(txn, keyBytes); err != nil {
+					return err
+				}
+				exists, err := keyExists(txn, keyBytes)
+				if err != nil {
+					return err
+				}
+				if !exists {
+					continue
+				}
+				if err := txn.Delete(keyBytes); err != nil {
+					return err
+				}
+				removed++
+			}
+			if removed == 0 {
+				return nil
+			}
+			return c.addLen(txn, -removed)
 		})
 		if err != nil {
 			panic(err)
 		}
-
-		c.len.Add(-1)
+		c.len.Add(-removed)
 	}
 }
 
+// Range visits the entries in key order, or in insertion order with FIFO ordering.
 func (c *mightyMapBadgerStorage[K]) Range(_ context.Context, f func(key K, value []byte) bool) {
+	if c.ordered {
+		c.rangeOrdered(f)
+		return
+	}
+
 	err := c.db.View(func(txn *badger.Txn) error {
 		opts := badger.IteratorOptions{
 			PrefetchValues: true,
@@ -207,6 +624,9 @@ func (c *mightyMapBadgerStorage[K]) Range(_ context.Context, f func(key K, value
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
 			kBytes := item.Key()
+			if isBadgerMetaKey(kBytes) {
+				continue
+			}
 			var k K
 			err := msgpack.Unmarshal(kBytes, &k)
 			if err != nil {
@@ -218,6 +638,7 @@ func (c *mightyMapBadgerStorage[K]) Range(_ context.Context, f func(key K, value
 			if err != nil {
 				return err
 			}
+			vBytes, _ = decodeBadgerValue(vBytes)
 
 			if !f(k, vBytes) {
 				return nil
@@ -230,7 +651,12 @@ func (c *mightyMapBadgerStorage[K]) Range(_ context.Context, f func(key K, value
 	}
 }
 
+// Keys returns the keys in key order, or in insertion order with FIFO ordering.
 func (c *mightyMapBadgerStorage[K]) Keys(_ context.Context) []K {
+	if c.ordered {
+		return c.keysOrdered()
+	}
+
 	keys := []K{}
 	err := c.db.View(func(txn *badger.Txn) error {
 		opts := badger.IteratorOptions{
@@ -245,6 +671,9 @@ func (c *mightyMapBadgerStorage[K]) Keys(_ context.Context) []K {
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
 			kBytes := item.Key()
+			if isBadgerMetaKey(kBytes) {
+				continue
+			}
 			var k K
 			err := msgpack.Unmarshal(kBytes, &k)
 			if err != nil {
@@ -262,79 +691,484 @@ func (c *mightyMapBadgerStorage[K]) Keys(_ context.Context) []K {
 	return keys
 }
 
+// Len returns the number of keys in O(1) from the transactionally maintained counter.
+// Entries that expire through WithExpire disappear without a write, so with expiry the value is
+// approximate: it may include expired keys until the counter is recounted with a key-only scan,
+// at most once per gc interval. With WithExactLen the live keys are counted on every call
+// instead. A failed scan is logged and the counter returned.
 func (c *mightyMapBadgerStorage[K]) Len(_ context.Context) int {
-	if !c.initLenCall.Load() {
-		c.initLenCall.Store(true)
-		cnt := 0
-		err := c.db.View(func(txn *badger.Txn) error {
+	if c.expire <= 0 {
+		return int(c.len.Load())
+	}
+	if c.exactLen {
+		cnt, err := c.countKeys()
+		if err == nil {
+			return int(cnt)
+		}
+		log.Printf("Error counting keys: %v", err)
+	} else if time.Since(time.Unix(0, c.countedAt.Load())) >= c.recountInterval {
+		c.recount()
+	}
+	return int(c.len.Load())
+}
+
+// recount replaces the counter by the number of live keys, unless another Len is recounting
+// or recounted it meanwhile. The keys are counted in the transaction that persists the
+// counter, so a write that commits during the count makes the recount conflict; it is then
+// left to the next Len.
+func (c *mightyMapBadgerStorage[K]) recount() {
+	if !c.recountMu.TryLock() {
+		return
+	}
+	defer c.recountMu.Unlock()
+	if time.Since(time.Unix(0, c.countedAt.Load())) < c.recountInterval {
+		return
+	}
+	if c.readOnly {
+		cnt, err := c.countKeys()
+		if err != nil {
+			log.Printf("Error counting keys: %v", err)
+			return
+		}
+		c.len.Store(cnt)
+		c.countedAt.Store(time.Now().UnixNano())
+		return
+	}
+	defer c.lockWrites()()
+
+	var cnt int64
+	err := c.db.Update(func(txn *badger.Txn) error {
+		cnt = countKeysIn(txn)
+		return c.setLen(txn, cnt)
+	})
+	if err != nil {
+		if !errors.Is(err, badger.ErrConflict) {
+			log.Printf("Error counting keys: %v", err)
+		}
+		return
+	}
+	c.len.Store(cnt)
+	c.countedAt.Store(time.Now().UnixNano())
+}
+
+func (c *mightyMapBadgerStorage[K]) Clear(_ context.Context) {
+	if c.readOnly {
+		panic(ErrReadOnly)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	err := c.db.DropAll()
+	if err != nil {
+		panic(err)
+	}
+	err = c.db.Update(func(txn *badger.Txn) error {
+		if c.ordered {
+			if err := txn.Set(badgerOrderReadyKey, nil); err != nil {
+				return err
+			}
+		}
+		return c.setLen(txn, 0)
+	})
+	if err != nil {
+		panic(err)
+	}
+	c.len.Store(0)
+	c.nextSeq.Store(0)
+}
+
+// Next removes and returns the key with the highest priority if any key has one, otherwise the
+// next key in key order, continuing after the previously popped key and wrapping around at the
+// end, or the oldest key with FIFO ordering. The read, the delete and the counter
+// update happen in a single read-write transaction, so concurrent callers never receive the
+// same entry and the storage can be used as a multi-consumer queue. A transaction that
+// conflicts with a concurrent write (see WithDetectConflicts) is retried until ctx is done.
+func (c *mightyMapBadgerStorage[K]) Next(ctx context.Context) (key K, value []byte, ok bool) {
+	if c.readOnly {
+		panic(ErrReadOnly)
+	}
+	defer c.lockWrites()()
+	if key, value, ok = c.nextPrioritized(ctx); ok {
+		return key, value, ok
+	}
+	if c.ordered {
+		return c.nextOrdered(ctx)
+	}
+
+	for {
+		var (
+			zeroK  K
+			kBytes []byte
+		)
+		key, value, ok = zeroK, nil, false
+
+		err := c.db.Update(func(txn *badger.Txn) error {
 			opts := badger.IteratorOptions{
 				PrefetchValues: true,
+				PrefetchSize:   1,
 				Reverse:        false,
 				AllVersions:    false,
 			}
+
 			it := txn.NewIterator(opts)
 			defer it.Close()
-			for it.Rewind(); it.Valid(); it.Next() {
-				cnt++
+
+			// continue after the last popped key so deleted keys don't have to be skipped
+			// again, and wrap around to catch keys inserted before it
+			seek := func(key []byte) {
+				for it.Seek(key); it.Valid() && isBadgerMetaKey(it.Item().Key()); it.Next() {
+				}
+			}
+			var hint []byte
+			if p := c.nextHint.Load(); p != nil {
+				hint = *p
+			}
+			seek(hint)
+			if !it.Valid() && hint != nil {
+				seek(nil)
+			}
+			if !it.Valid() {
+				return nil
 			}
+
+			item := it.Item()
+			kBytes = item.KeyCopy(nil)
+			vBytes, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := msgpack.Unmarshal(kBytes, &key); err != nil {
+				return err
+			}
+
+			if err := txn.Delete(kBytes); err != nil {
+				return err
+			}
+			if err := c.addLen(txn, -1); err != nil {
+				return err
+			}
+			value, _ = decodeBadgerValue(vBytes)
+			ok = true
 			return nil
 		})
+		if errors.Is(err, badger.ErrConflict) {
+			if ctx.Err() != nil {
+				return zeroK, nil, false
+			}
+			continue
+		}
 		if err != nil {
 			panic(err)
 		}
-		c.len.Store(int64(cnt))
+		if ok {
+			c.len.Add(-1)
+			c.nextHint.Store(&kBytes)
+		}
+		return key, value, ok
 	}
-	return int(c.len.Load())
 }
 
-func (c *mightyMapBadgerStorage[K]) Clear(_ context.Context) {
-	err := c.db.DropAll()
-	if err != nil {
-		panic(err)
+// NextWait removes and returns an entry like Next, waiting until one is stored while the
+// database is empty. Stores wake it up at once; everything else, such as a Restore, is noticed
+// within WithNextWaitPollInterval. Concurrent callers each receive a different entry.
+// Returns the context error if ctx is cancelled first.
+func (c *mightyMapBadgerStorage[K]) NextWait(ctx context.Context) (key K, value []byte, err error) {
+	return waitNext(ctx, c.stored, c.pollInterval, c.Next)
+}
+
+// ParallelRange visits all entries using the badger.Stream framework. The stream splits the key
+// space into ranges that are iterated concurrently, and its single Send goroutine hands batches of
+// entries to worker goroutines which decode the keys and call f.
+//
+// All entries are read from one snapshot taken when the scan starts, but they are visited in no
+// particular order: neither the ranges nor the entries within a batch are delivered sorted.
+func (c *mightyMapBadgerStorage[K]) ParallelRange(ctx context.Context, workers int, f func(key K, value []byte) bool) error {
+	produce := func(ctx context.Context, emit func([]*pb.KV) bool) error {
+		stream := c.db.NewStream()
+		stream.NumGo = max(workers, 1)
+		stream.LogPrefix = "mightymap.ParallelRange"
+		stream.ChooseKey = func(item *badger.Item) bool {
+			return !isBadgerMetaKey(item.Key())
+		}
+		// only the latest version of each key, regardless of WithNumVersionsToKeep
+		stream.KeyToList = func(key []byte, itr *badger.Iterator) (*pb.KVList, error) {
+			item := itr.Item()
+			if item.IsDeletedOrExpired() {
+				return &pb.KVList{}, nil
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return nil, err
+			}
+			value, _ = decodeBadgerValue(value)
+			return &pb.KVList{Kv: []*pb.KV{{Key: item.KeyCopy(nil), Value: value}}}, nil
+		}
+		stream.Send = func(buf *z.Buffer) error {
+			list, err := badger.BufferToKVList(buf)
+			if err != nil {
+				return err
+			}
+			for kvs := list.Kv; len(kvs) > 0; {
+				n := min(len(kvs), badgerParallelRangeBatchSize)
+				if !emit(kvs[:n]) {
+					return ctx.Err()
+				}
+				kvs = kvs[n:]
+			}
+			return nil
+		}
+		return stream.Orchestrate(ctx)
 	}
-	c.len.Store(0)
+
+	consume := func(ctx context.Context, kvs []*pb.KV) (bool, error) {
+		for _, kv := range kvs {
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			var k K
+			if err := msgpack.Unmarshal(kv.Key, &k); err != nil {
+				log.Printf("error: unmarshalling key: '%v' err: %v", string(kv.Key), err)
+				continue
+			}
+			if !f(k, kv.Value) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	return parallelDispatch(ctx, workers, produce, consume)
 }
 
-func (c *mightyMapBadgerStorage[K]) Next(ctx context.Context) (key K, value []byte, ok bool) {
-	err := c.db.View(func(txn *badger.Txn) error {
-		opts := badger.IteratorOptions{
-			PrefetchValues: true,
-			PrefetchSize:   1,
-			Reverse:        false,
-			AllVersions:    false,
+// Touch restarts the TTL of the given keys. Badger cannot change the TTL of an entry without
+// rewriting it, so the current values are re-set within a single transaction.
+// Missing keys are ignored. Without WithExpire this is a no-op.
+func (c *mightyMapBadgerStorage[K]) Touch(_ context.Context, keys ...K) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if c.expire <= 0 || len(keys) == 0 {
+		return nil
+	}
+	return c.updateRetrying(0, func(txn *badger.Txn) error {
+		for _, key := range keys {
+			keyBytes, err := msgpack.Marshal(key)
+			if err != nil {
+				return err
+			}
+			item, err := txn.Get(keyBytes)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := txn.SetEntry(c.newEntry(keyBytes, value)); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+}
 
-		it := txn.NewIterator(opts)
-		defer it.Close()
+// Backup writes all entries with a version of at least since to w using db.Backup, including
+// deletions, so a full backup followed by incremental ones reproduces the database.
+// The returned version is one after the newest version written, to be passed as since to the
+// next call, or since itself if nothing was written.
+func (c *mightyMapBadgerStorage[K]) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	// db.Backup documents since as inclusive, but its stream only reads versions after it
+	after := since
+	if after > 0 {
+		after--
+	}
+	last, err := c.db.Backup(ctxWriter{ctx: ctx, w: w}, after)
+	if err != nil {
+		return 0, err
+	}
+	// versions start at 1, so 0 means nothing was written
+	if last == 0 {
+		return since, nil
+	}
+	return last + 1, nil
+}
+
+// Restore loads a backup written by Backup using db.Load and recounts the keys afterwards,
+// since the persisted counter in the backup does not account for entries that were already
+// present. Writes made while a restore is running are blocked.
+func (c *mightyMapBadgerStorage[K]) Restore(ctx context.Context, r io.Reader) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.db.Load(ctxReader{ctx: ctx, r: r}, badgerLoadMaxPendingWrites); err != nil {
+		return err
+	}
+
+	n, err := c.countKeys()
+	if err != nil {
+		return err
+	}
+	err = c.db.Update(func(txn *badger.Txn) error {
+		return c.setLen(txn, n)
+	})
+	if err != nil {
+		return err
+	}
+	c.len.Store(n)
+	if c.ordered {
+		// the backup may carry the order of other keys; index the ones it lacks
+		return c.initOrder()
+	}
+	return nil
+}
+
+// ctxWriter aborts a write stream once its context is done.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// ctxReader aborts a read stream once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
 
-		it.Rewind()
-		if !it.Valid() {
+// Compact reclaims disk space on demand: it flattens the LSM tree into a single level, which
+// drops deleted and overwritten versions, and then runs value log garbage collection until
+// there is nothing left to rewrite. It may take a long time on large databases; ctx is checked
+// between the garbage collection runs.
+func (c *mightyMapBadgerStorage[K]) Compact(ctx context.Context) error {
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if err := c.db.Flatten(max(c.numCompactors, 1)); err != nil {
+		return err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rewritten, err := c.runValueLogGC()
+		if errors.Is(err, badger.ErrGCInMemoryMode) {
 			return nil
 		}
-
-		item := it.Item()
-		kBytes := item.Key()
-		vBytes, err := item.ValueCopy(nil)
-		if err != nil {
+		if err != nil || !rewritten {
 			return err
 		}
+	}
+}
 
-		err = msgpack.Unmarshal(kBytes, &key)
+// Size returns the current size of the LSM tree and of the value log files in bytes.
+// db.Size only reports values refreshed once a minute through the metrics, so the files
+// are measured directly. In-memory databases report zero.
+func (c *mightyMapBadgerStorage[K]) Size(ctx context.Context) (lsm, vlog int64, err error) {
+	opts := c.db.Opts()
+	if opts.InMemory {
+		return 0, 0, nil
+	}
+
+	dirs := []string{opts.Dir}
+	if opts.ValueDir != opts.Dir {
+		dirs = append(dirs, opts.ValueDir)
+	}
+	for _, dir := range dirs {
+		err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			ext := filepath.Ext(path)
+			if d.IsDir() || (ext != ".sst" && ext != ".vlog") {
+				return nil
+			}
+			info, err := d.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				// removed by a concurrent compaction
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if ext == ".sst" {
+				lsm += info.Size()
+			} else {
+				vlog += info.Size()
+			}
+			return nil
+		})
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
+	}
+	return lsm, vlog, nil
+}
 
-		value = vBytes
-		ok = true
-		c.Delete(ctx, key)
-		return nil
-	})
+// BackupFile writes a full backup, as written by Backup with since 0, to destPath. It is
+// written to a temporary file first, so destPath never holds a partial backup.
+func (c *mightyMapBadgerStorage[K]) BackupFile(ctx context.Context, destPath string) error {
+	f, err := os.CreateTemp(filepath.Dir(destPath), filepath.Base(destPath)+".tmp*")
 	if err != nil {
-		panic(err)
+		return err
 	}
-	return key, value, ok
+	defer os.Remove(f.Name())
+
+	if _, err := c.Backup(ctx, f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), destPath)
+}
+
+// Vacuum is the same as Compact.
+func (c *mightyMapBadgerStorage[K]) Vacuum(ctx context.Context) error {
+	return c.Compact(ctx)
 }
 
+// Checkpoint syncs the value log, which holds the writes that are not yet in the LSM tree,
+// to disk. Badger flushes its memtables itself, so mode is ignored. In-memory and read-only
+// databases have nothing to sync.
+func (c *mightyMapBadgerStorage[K]) Checkpoint(_ context.Context, _ CheckpointMode) error {
+	if c.readOnly || c.db.Opts().InMemory {
+		return nil
+	}
+	return c.db.Sync()
+}
+
+// Close stops the maintenance goroutine and closes the database.
 func (c *mightyMapBadgerStorage[K]) Close(_ context.Context) error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
 	return c.db.Close()
 }
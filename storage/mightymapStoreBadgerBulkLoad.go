@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/v2/z"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// badgerBulkLoadBufferSize is the amount of encoded entries collected before they are handed
+// to the stream writer.
+const badgerBulkLoadBufferSize = 4 << 20
+
+var errBulkLoadFinished = errors.New("mightymap: bulk load already finished")
+
+// BulkLoader starts a bulk load using badger.StreamWriter, which builds the SST tables directly
+// instead of going through transactions, the memtable and compaction. All entries are written as
+// a single sorted stream, so keys must be added in ascending order of their MessagePack encoding.
+//
+// The stream writer needs the database for itself: the storage must be empty and all other
+// count-changing writes (Store, Delete, Clear, Next, Restore) wait until the load is finished or
+// cancelled. Touch and sliding Load fail during the load. The key counter is set by Finish.
+func (c *mightyMapBadgerStorage[K]) BulkLoader(ctx context.Context) (IMightyMapBulkLoader[K, []byte], error) {
+	if c.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	c.writeMu.Lock()
+	empty, err := c.isEmpty()
+	if err == nil && !empty {
+		err = ErrNotEmpty
+	}
+	if err != nil {
+		c.writeMu.Unlock()
+		return nil, err
+	}
+
+	version, _ := c.CurrentVersion(ctx)
+	sw := c.db.NewStreamWriter()
+	if err := sw.Prepare(); err != nil {
+		sw.Cancel()
+		c.writeMu.Unlock()
+		return nil, err
+	}
+	return &badgerBulkLoader[K]{
+		storage: c,
+		ctx:     ctx,
+		sw:      sw,
+		buf:     z.NewBuffer(badgerBulkLoadBufferSize, "mightymap.BulkLoader"),
+		version: version + 1,
+	}, nil
+}
+
+// isEmpty reports whether the database holds no user keys.
+func (c *mightyMapBadgerStorage[K]) isEmpty() (bool, error) {
+	empty := true
+	err := c.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if !isBadgerMetaKey(it.Item().Key()) {
+				empty = false
+				return nil
+			}
+		}
+		return nil
+	})
+	return empty, err
+}
+
+// badgerBulkLoader feeds a single stream of a badger.StreamWriter while holding writeMu.
+type badgerBulkLoader[K comparable] struct {
+	storage *mightyMapBadgerStorage[K]
+	ctx     context.Context
+	sw      *badger.StreamWriter
+	buf     *z.Buffer
+	version uint64
+	lastKey []byte
+	n       int64
+	done    bool
+}
+
+func (l *badgerBulkLoader[K]) Add(key K, value []byte) error {
+	if l.done {
+		return errBulkLoadFinished
+	}
+	if err := l.ctx.Err(); err != nil {
+		return err
+	}
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if l.lastKey != nil && bytes.Compare(keyBytes, l.lastKey) <= 0 {
+		return ErrUnsortedKeys
+	}
+
+	kv := &pb.KV{
+		Key:     keyBytes,
+		Value:   l.storage.encodeValue(value),
+		Version: l.version,
+	}
+	if l.storage.expire > 0 {
+		kv.ExpiresAt = uint64(time.Now().Add(l.storage.expire).Unix())
+	}
+	badger.KVToBuffer(kv, l.buf)
+	l.lastKey = keyBytes
+	l.n++
+
+	if l.buf.LenNoPadding() >= badgerBulkLoadBufferSize {
+		return l.flushBuffer()
+	}
+	return nil
+}
+
+// flushBuffer hands the collected entries to the stream writer.
+func (l *badgerBulkLoader[K]) flushBuffer() error {
+	err := l.sw.Write(l.buf)
+	l.buf.Reset()
+	return err
+}
+
+// Finish writes the remaining entries, flushes the stream writer and persists the key counter.
+func (l *badgerBulkLoader[K]) Finish() error {
+	if l.done {
+		return errBulkLoadFinished
+	}
+	l.done = true
+	defer l.storage.writeMu.Unlock()
+	defer l.buf.Release()
+
+	err := l.ctx.Err()
+	if err == nil {
+		err = l.flushBuffer()
+	}
+	if err != nil {
+		l.sw.Cancel()
+		return l.recount(err)
+	}
+	if err := l.sw.Flush(); err != nil {
+		return l.recount(err)
+	}
+
+	c := l.storage
+	if err := c.db.Update(func(txn *badger.Txn) error {
+		return c.setLen(txn, l.n)
+	}); err != nil {
+		return err
+	}
+	c.len.Store(l.n)
+	c.nextHint.Store(nil)
+	if c.ordered {
+		// the keys were added in key order, which becomes their insertion order
+		return c.initOrder()
+	}
+	return nil
+}
+
+// Cancel stops the stream writer. Tables it already wrote stay in the database, so the keys
+// are recounted.
+func (l *badgerBulkLoader[K]) Cancel() {
+	if l.done {
+		return
+	}
+	l.done = true
+	defer l.storage.writeMu.Unlock()
+	defer l.buf.Release()
+
+	l.sw.Cancel()
+	_ = l.recount(nil)
+}
+
+// recount restores the key counter after a failed or cancelled load and returns err.
+func (l *badgerBulkLoader[K]) recount(err error) error {
+	c := l.storage
+	n, countErr := c.countKeys()
+	if countErr == nil {
+		countErr = c.db.Update(func(txn *badger.Txn) error {
+			return c.setLen(txn, n)
+		})
+	}
+	if countErr != nil {
+		return errors.Join(err, countErr)
+	}
+	c.len.Store(n)
+	c.nextHint.Store(nil)
+	if c.ordered {
+		if orderErr := c.initOrder(); orderErr != nil {
+			return errors.Join(err, orderErr)
+		}
+	}
+	return err
+}
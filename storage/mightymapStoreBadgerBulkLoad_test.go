@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestBadgerBulkLoad(t *testing.T) {
+	for name, inMemory := range map[string]bool{"InMemory": true, "OnDisk": false} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			store := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(inMemory), WithTempDir(dir))
+
+			loader, err := store.(IMightyMapBulkLoadStorage[string, int]).BulkLoader(ctx)
+			if err != nil {
+				t.Fatalf("BulkLoader() error: %v", err)
+			}
+			// fixed width keys sort the same as their MessagePack encoding
+			const n = 10000
+			for i := 0; i < n; i++ {
+				if err := loader.Add(fmt.Sprintf("key-%05d", i), i); err != nil {
+					t.Fatalf("Add(%d) error: %v", i, err)
+				}
+			}
+			if err := loader.Finish(); err != nil {
+				t.Fatalf("Finish() error: %v", err)
+			}
+
+			if got := store.Len(ctx); got != n {
+				t.Errorf("Len() = %d; want %d", got, n)
+			}
+			if v, ok := store.Load(ctx, "key-04242"); !ok || v != 4242 {
+				t.Errorf("Load() = %d, %v; want 4242, true", v, ok)
+			}
+
+			// the storage accepts regular writes afterwards
+			store.Store(ctx, "key-99999", 1)
+			store.Delete(ctx, "key-00000")
+			if got := store.Len(ctx); got != n {
+				t.Errorf("Len() after writes = %d; want %d", got, n)
+			}
+			store.Close(ctx)
+			if inMemory {
+				return
+			}
+
+			store = NewMightyMapBadgerStorage[string, int](WithMemoryStorage(false), WithTempDir(dir))
+			defer store.Close(ctx)
+			if got := store.Len(ctx); got != n {
+				t.Errorf("Len() after reopening = %d; want %d", got, n)
+			}
+			if v, ok := store.Load(ctx, "key-00001"); !ok || v != 1 {
+				t.Errorf("Load() after reopening = %d, %v; want 1, true", v, ok)
+			}
+		})
+	}
+}
+
+func TestBadgerBulkLoadUnsorted(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(true))
+	defer store.Close(ctx)
+
+	loader, err := store.(IMightyMapBulkLoadStorage[string, int]).BulkLoader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Add("b", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Add("a", 2); err != ErrUnsortedKeys {
+		t.Errorf("Add() out of order error = %v; want ErrUnsortedKeys", err)
+	}
+	if err := loader.Add("b", 3); err != ErrUnsortedKeys {
+		t.Errorf("Add() of a duplicate key error = %v; want ErrUnsortedKeys", err)
+	}
+	loader.Cancel()
+
+	// writes are released by Cancel
+	store.Store(ctx, "c", 3)
+	if v, ok := store.Load(ctx, "c"); !ok || v != 3 {
+		t.Errorf("Load() after Cancel = %d, %v; want 3, true", v, ok)
+	}
+}
+
+func TestBadgerBulkLoadNotEmpty(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(true))
+	defer store.Close(ctx)
+	store.Store(ctx, "a", 1)
+
+	if _, err := store.(IMightyMapBulkLoadStorage[string, int]).BulkLoader(ctx); err != ErrNotEmpty {
+		t.Errorf("BulkLoader() error = %v; want ErrNotEmpty", err)
+	}
+	if v, ok := store.Load(ctx, "a"); !ok || v != 1 {
+		t.Error("a refused bulk load changed the storage")
+	}
+}
+
+func TestBulkLoadNotSupported(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapSQLiteStorage[string, int]()
+	defer store.Close(ctx)
+
+	if _, err := store.(IMightyMapBulkLoadStorage[string, int]).BulkLoader(ctx); err != ErrNotSupported {
+		t.Errorf("BulkLoader() error = %v; want ErrNotSupported", err)
+	}
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"log"
+
+	"github.com/dgraph-io/badger/v4"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// Reserved keys of FIFO ordering. Every user key has an order entry, the order prefix followed
+// by its sequence number, holding the user key, and a position entry, the position prefix
+// followed by the user key, holding the sequence number. Iterating the order prefix yields the
+// keys in insertion order. The marker tells that every user key has both entries.
+var (
+	badgerOrderPrefix    = []byte{0xc1, 'q'}
+	badgerPositionPrefix = []byte{0xc1, 'p'}
+	badgerOrderReadyKey  = []byte{0xc1, 'o', 'r', 'd'}
+)
+
+// badgerOrderKey returns the order entry key of seq.
+func badgerOrderKey(seq uint64) []byte {
+	key := make([]byte, len(badgerOrderPrefix)+8)
+	copy(key, badgerOrderPrefix)
+	binary.BigEndian.PutUint64(key[len(badgerOrderPrefix):], seq)
+	return key
+}
+
+// badgerPositionKey returns the position entry key of the user key keyBytes.
+func badgerPositionKey(keyBytes []byte) []byte {
+	return append(append([]byte{}, badgerPositionPrefix...), keyBytes...)
+}
+
+// initOrder prepares the order index when the database is opened. Without FIFO ordering the
+// marker is removed, since writes made now do not maintain the index. With FIFO ordering the
+// next sequence number is taken from the newest order entry, and if the marker is missing the
+// keys without entries are appended in key order.
+func (c *mightyMapBadgerStorage[K]) initOrder() error {
+	if !c.ordered {
+		if c.readOnly {
+			return nil
+		}
+		return c.db.Update(func(txn *badger.Txn) error {
+			if exists, err := keyExists(txn, badgerOrderReadyKey); err != nil || !exists {
+				return err
+			}
+			return txn.Delete(badgerOrderReadyKey)
+		})
+	}
+
+	var ready bool
+	err := c.db.View(func(txn *badger.Txn) error {
+		var err error
+		if ready, err = keyExists(txn, badgerOrderReadyKey); err != nil {
+			return err
+		}
+		it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false, Reverse: true})
+		defer it.Close()
+		// the largest key with the prefix sorts before the prefix followed by 0xff bytes
+		it.Seek(append(append([]byte{}, badgerOrderPrefix...), bytes.Repeat([]byte{0xff}, 9)...))
+		if it.ValidForPrefix(badgerOrderPrefix) {
+			c.nextSeq.Store(binary.BigEndian.Uint64(it.Item().Key()[len(badgerOrderPrefix):]))
+		}
+		return nil
+	})
+	if err != nil || ready || c.readOnly {
+		return err
+	}
+	return c.backfillOrder()
+}
+
+// backfillOrder appends all user keys without an order entry in key order and sets the marker.
+func (c *mightyMapBadgerStorage[K]) backfillOrder() error {
+	wb := c.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := c.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			keyBytes := it.Item().Key()
+			if isBadgerMetaKey(keyBytes) {
+				continue
+			}
+			exists, err := keyExists(txn, badgerPositionKey(keyBytes))
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			if err := setBadgerOrder(wb.Set, it.Item().KeyCopy(nil), c.nextSeq.Add(1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := wb.Set(badgerOrderReadyKey, nil); err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// setBadgerOrder writes the order and position entries of keyBytes with set.
+func setBadgerOrder(set func(key, value []byte) error, keyBytes []byte, seq uint64) error {
+	orderKey := badgerOrderKey(seq)
+	if err := set(orderKey, keyBytes); err != nil {
+		return err
+	}
+	return set(badgerPositionKey(keyBytes), orderKey[len(badgerOrderPrefix):])
+}
+
+// appendOrder moves keyBytes to the end of the order as part of txn. Every call takes a new
+// sequence number, so a retried transaction leaves a gap in the order, which is harmless.
+func (c *mightyMapBadgerStorage[K]) appendOrder(txn *badger.Txn, keyBytes []byte) error {
+	if err := c.removeOrder(txn, keyBytes); err != nil {
+		return err
+	}
+	return setBadgerOrder(txn.Set, keyBytes, c.nextSeq.Add(1))
+}
+
+// removeOrder deletes the order and position entries of keyBytes as part of txn, if present.
+func (c *mightyMapBadgerStorage[K]) removeOrder(txn *badger.Txn, keyBytes []byte) error {
+	positionKey := badgerPositionKey(keyBytes)
+	item, err := txn.Get(positionKey)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	seq, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	if err := txn.Delete(append(append([]byte{}, badgerOrderPrefix...), seq...)); err != nil {
+		return err
+	}
+	return txn.Delete(positionKey)
+}
+
+// eachOrdered calls f for the live user keys in insertion order within txn, with the item of
+// the user key. Order entries of keys that have expired are skipped.
+func eachOrdered(txn *badger.Txn, f func(keyBytes []byte, item *badger.Item) (bool, error)) error {
+	it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: true, Prefix: badgerOrderPrefix})
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		keyBytes, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		item, err := txn.Get(keyBytes)
+		if err == badger.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if more, err := f(keyBytes, item); !more || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeOrdered is Range for FIFO ordering.
+func (c *mightyMapBadgerStorage[K]) rangeOrdered(f func(key K, value []byte) bool) {
+	err := c.db.View(func(txn *badger.Txn) error {
+		return eachOrdered(txn, func(keyBytes []byte, item *badger.Item) (bool, error) {
+			var k K
+			if err := msgpack.Unmarshal(keyBytes, &k); err != nil {
+				log.Printf("error: unmarshalling key: '%v' err: %v", string(keyBytes), err)
+				return true, nil
+			}
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return false, err
+			}
+			value, _ = decodeBadgerValue(value)
+			return f(k, value), nil
+		})
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// keysOrdered is Keys for FIFO ordering.
+func (c *mightyMapBadgerStorage[K]) keysOrdered() []K {
+	keys := []K{}
+	err := c.db.View(func(txn *badger.Txn) error {
+		return eachOrdered(txn, func(keyBytes []byte, _ *badger.Item) (bool, error) {
+			var k K
+			if err := msgpack.Unmarshal(keyBytes, &k); err != nil {
+				log.Printf("error: unmarshalling key: '%v' err: %v", string(keyBytes), err)
+				return true, nil
+			}
+			keys = append(keys, k)
+			return true, nil
+		})
+	})
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
+
+// nextOrdered is Next for FIFO ordering: the oldest entry, its order entries and the counter
+// update are removed in a single read-write transaction. Order entries of expired keys found on
+// the way are removed as well, at most badgerDeleteBatchSize per transaction to stay below
+// Badger's transaction size limits. The caller must hold writeMu through lockWrites.
+func (c *mightyMapBadgerStorage[K]) nextOrdered(ctx context.Context) (key K, value []byte, ok bool) {
+	for {
+		key, value, ok = *new(K), nil, false
+		more := false
+
+		err := c.db.Update(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: true, Prefix: badgerOrderPrefix})
+			defer it.Close()
+
+			stale := 0
+			for it.Rewind(); it.Valid(); it.Next() {
+				keyBytes, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if err := txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+					return err
+				}
+				if err := txn.Delete(badgerPositionKey(keyBytes)); err != nil {
+					return err
+				}
+
+				item, err := txn.Get(keyBytes)
+				if err == badger.ErrKeyNotFound {
+					// the key has expired
+					if stale++; stale >= badgerDeleteBatchSize {
+						more = true
+						return nil
+					}
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				vBytes, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if err := msgpack.Unmarshal(keyBytes, &key); err != nil {
+					return err
+				}
+				if err := txn.Delete(keyBytes); err != nil {
+					return err
+				}
+				if err := c.addLen(txn, -1); err != nil {
+					return err
+				}
+				value, _ = decodeBadgerValue(vBytes)
+				ok = true
+				return nil
+			}
+			return nil
+		})
+		if errors.Is(err, badger.ErrConflict) {
+			if ctx.Err() != nil {
+				return *new(K), nil, false
+			}
+			continue
+		}
+		if err != nil {
+			panic(err)
+		}
+		if more {
+			continue
+		}
+		if ok {
+			c.len.Add(-1)
+		}
+		return key, value, ok
+	}
+}
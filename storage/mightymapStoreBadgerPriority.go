@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// Reserved keys of priorities. Every key with a priority has a priority entry, the priority
+// prefix followed by its rank, holding the user key, and a rank entry, the rank prefix followed
+// by the user key, holding the rank. A rank is the inverted priority followed by a sequence
+// number, both 8 bytes big-endian, so iterating the priority prefix yields the keys with the
+// highest priority first and, among equal priorities, the key that got its priority first.
+var (
+	badgerPriorityPrefix = []byte{0xc1, 'h'}
+	badgerRankPrefix     = []byte{0xc1, 'r'}
+)
+
+// badgerRankSize is the size of a rank, see badgerRank.
+const badgerRankSize = 16
+
+// badgerRank returns the rank of priority and seq. Flipping the sign bit orders the priorities
+// as unsigned integers, inverting all bits puts the highest first.
+func badgerRank(priority int, seq uint64) []byte {
+	rank := make([]byte, badgerRankSize)
+	binary.BigEndian.PutUint64(rank, ^(uint64(int64(priority)) ^ 1<<63))
+	binary.BigEndian.PutUint64(rank[8:], seq)
+	return rank
+}
+
+// badgerRankKey returns the rank entry key of the user key keyBytes.
+func badgerRankKey(keyBytes []byte) []byte {
+	return append(append([]byte{}, badgerRankPrefix...), keyBytes...)
+}
+
+// StoreWithPriority stores a key-value pair together with its priority entries in a single
+// transaction. The key moves behind the keys that already have the same priority.
+func (c *mightyMapBadgerStorage[K]) StoreWithPriority(_ context.Context, key K, value []byte, priority int) error {
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return err
+	}
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	c.store(keyBytes, value, func(txn *badger.Txn) error {
+		return c.setPriority(txn, keyBytes, priority, true)
+	})
+	return nil
+}
+
+// SetPriority rewrites the priority entries of a key, leaving its value alone. A key that already
+// has a priority keeps its sequence number. Returns false if the key does not exist.
+func (c *mightyMapBadgerStorage[K]) SetPriority(_ context.Context, key K, priority int) (bool, error) {
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return false, err
+	}
+	if c.readOnly {
+		return false, ErrReadOnly
+	}
+	defer c.lockWrites()()
+
+	var exists bool
+	err = c.updateRetrying(0, func(txn *badger.Txn) error {
+		var err error
+		if exists, err = keyExists(txn, keyBytes); err != nil || !exists {
+			return err
+		}
+		return c.setPriority(txn, keyBytes, priority, false)
+	})
+	return exists, err
+}
+
+// setPriority writes the priority entries of keyBytes as part of txn. A new sequence number is
+// taken for keys without a priority and, with requeue, for all keys. Sequence numbers start at
+// the current time, so they keep increasing across restarts.
+func (c *mightyMapBadgerStorage[K]) setPriority(txn *badger.Txn, keyBytes []byte, priority int, requeue bool) error {
+	rankKey := badgerRankKey(keyBytes)
+	var seq uint64
+	item, err := txn.Get(rankKey)
+	switch {
+	case err == nil:
+		old, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		if err := txn.Delete(append(append([]byte{}, badgerPriorityPrefix...), old...)); err != nil {
+			return err
+		}
+		seq = binary.BigEndian.Uint64(old[8:])
+	case err != badger.ErrKeyNotFound:
+		return err
+	}
+	if seq == 0 || requeue {
+		seq = c.nextPrioritySeq()
+	}
+
+	rank := badgerRank(priority, seq)
+	if err := txn.Set(append(append([]byte{}, badgerPriorityPrefix...), rank...), keyBytes); err != nil {
+		return err
+	}
+	return txn.Set(rankKey, rank)
+}
+
+// nextPrioritySeq takes the next priority sequence number, at least the current time in
+// UnixNano.
+func (c *mightyMapBadgerStorage[K]) nextPrioritySeq() uint64 {
+	for {
+		last := c.prioritySeq.Load()
+		seq := max(last+1, uint64(time.Now().UnixNano()))
+		if c.prioritySeq.CompareAndSwap(last, seq) {
+			return seq
+		}
+	}
+}
+
+// removeBadgerPriority deletes the priority entries of keyBytes as part of txn, if present.
+func removeBadgerPriority(txn *badger.Txn, keyBytes []byte) error {
+	rankKey := badgerRankKey(keyBytes)
+	item, err := txn.Get(rankKey)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rank, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	if err := txn.Delete(append(append([]byte{}, badgerPriorityPrefix...), rank...)); err != nil {
+		return err
+	}
+	return txn.Delete(rankKey)
+}
+
+// nextPrioritized removes and returns the key with the highest priority together with its
+// priority entries in a single read-write transaction, like nextOrdered. Priority entries of
+// expired keys found on the way are removed as well. The caller must hold writeMu through
+// lockWrites.
+func (c *mightyMapBadgerStorage[K]) nextPrioritized(ctx context.Context) (key K, value []byte, ok bool) {
+	for {
+		key, value, ok = *new(K), nil, false
+		more := false
+
+		err := c.db.Update(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: true, Prefix: badgerPriorityPrefix})
+			defer it.Close()
+
+			stale := 0
+			for it.Rewind(); it.Valid(); it.Next() {
+				keyBytes, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if err := txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+					return err
+				}
+				if err := txn.Delete(badgerRankKey(keyBytes)); err != nil {
+					return err
+				}
+
+				item, err := txn.Get(keyBytes)
+				if err == badger.ErrKeyNotFound {
+					// the key has expired
+					if stale++; stale >= badgerDeleteBatchSize {
+						more = true
+						return nil
+					}
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				vBytes, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if err := msgpack.Unmarshal(keyBytes, &key); err != nil {
+					return err
+				}
+				if err := txn.Delete(keyBytes); err != nil {
+					return err
+				}
+				if c.ordered {
+					if err := c.removeOrder(txn, keyBytes); err != nil {
+						return err
+					}
+				}
+				if err := c.addLen(txn, -1); err != nil {
+					return err
+				}
+				value, _ = decodeBadgerValue(vBytes)
+				ok = true
+				return nil
+			}
+			return nil
+		})
+		if errors.Is(err, badger.ErrConflict) {
+			if ctx.Err() != nil {
+				return *new(K), nil, false
+			}
+			continue
+		}
+		if err != nil {
+			panic(err)
+		}
+		if more {
+			continue
+		}
+		if ok {
+			c.len.Add(-1)
+		}
+		return key, value, ok
+	}
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"log"
+
+	"github.com/dgraph-io/badger/v4"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// Version history for the Badger storage. Badger keeps up to WithNumVersionsToKeep versions of
+// every key; older versions are discarded by compaction. Reads at a past version iterate over
+// all versions and pick the newest one at or below the requested version, so they do not need
+// Badger's managed transaction mode.
+
+// LoadVersions returns up to limit versions of key, newest first, including deletions.
+func (c *mightyMapBadgerStorage[K]) LoadVersions(_ context.Context, key K, limit int) ([]Versioned[[]byte], error) {
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Versioned[[]byte]
+	err = c.db.View(func(txn *badger.Txn) error {
+		it := txn.NewKeyIterator(keyBytes, badger.IteratorOptions{})
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			v, err := readBadgerVersion(it.Item())
+			if err != nil {
+				return err
+			}
+			versions = append(versions, v)
+			if limit > 0 && len(versions) == limit {
+				break
+			}
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// LoadAt returns the value key had at version.
+func (c *mightyMapBadgerStorage[K]) LoadAt(_ context.Context, key K, version uint64) (value []byte, ok bool, err error) {
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = c.db.View(func(txn *badger.Txn) error {
+		it := txn.NewKeyIterator(keyBytes, badger.IteratorOptions{})
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if item.Version() > version {
+				continue
+			}
+			if item.IsDeletedOrExpired() {
+				return nil
+			}
+			v, err := readBadgerVersion(item)
+			if err != nil {
+				return err
+			}
+			value, ok = v.Value, true
+			return nil
+		}
+		return nil
+	})
+	return value, ok, err
+}
+
+// CurrentVersion returns the read timestamp of a new transaction, which is the version of the
+// latest committed write.
+func (c *mightyMapBadgerStorage[K]) CurrentVersion(_ context.Context) (uint64, error) {
+	txn := c.db.NewTransaction(false)
+	defer txn.Discard()
+	return txn.ReadTs(), nil
+}
+
+// SnapshotAt returns a read-only view of the storage at version.
+func (c *mightyMapBadgerStorage[K]) SnapshotAt(ctx context.Context, version uint64) (IMightyMapSnapshot[K, []byte], error) {
+	current, err := c.CurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version > current {
+		return nil, ErrFutureVersion
+	}
+	return &badgerSnapshot[K]{storage: c, version: version}, nil
+}
+
+// readBadgerVersion converts a single version of an entry.
+func readBadgerVersion(item *badger.Item) (Versioned[[]byte], error) {
+	v := Versioned[[]byte]{
+		Version: item.Version(),
+		Deleted: item.IsDeletedOrExpired(),
+	}
+	if v.Deleted {
+		return v, nil
+	}
+	raw, err := item.ValueCopy(nil)
+	if err != nil {
+		return v, err
+	}
+	v.Value, v.Timestamp = decodeBadgerValue(raw)
+	return v, nil
+}
+
+// badgerSnapshot reads the Badger storage as it was at a fixed version.
+type badgerSnapshot[K comparable] struct {
+	storage *mightyMapBadgerStorage[K]
+	version uint64
+}
+
+func (s *badgerSnapshot[K]) Version() uint64 {
+	return s.version
+}
+
+func (s *badgerSnapshot[K]) Load(ctx context.Context, key K) (value []byte, ok bool) {
+	value, ok, err := s.storage.LoadAt(ctx, key, s.version)
+	if err != nil {
+		panic(err)
+	}
+	return value, ok
+}
+
+// scan calls f with the newest version at or below the snapshot version of every live key.
+func (s *badgerSnapshot[K]) scan(withValues bool, f func(key K, item *badger.Item) bool) {
+	err := s.storage.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{
+			PrefetchValues: withValues,
+			AllVersions:    true,
+		})
+		defer it.Close()
+
+		// decided is the key whose visible version has already been handled
+		var decided []byte
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			kBytes := item.Key()
+			if isBadgerMetaKey(kBytes) || bytes.Equal(kBytes, decided) || item.Version() > s.version {
+				continue
+			}
+			decided = item.KeyCopy(decided[:0])
+			if item.IsDeletedOrExpired() {
+				continue
+			}
+
+			var k K
+			if err := msgpack.Unmarshal(kBytes, &k); err != nil {
+				log.Printf("error: unmarshalling key: '%v' err: %v", string(kBytes), err)
+				continue
+			}
+			if !f(k, item) {
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (s *badgerSnapshot[K]) Range(_ context.Context, f func(key K, value []byte) bool) {
+	var err error
+	s.scan(true, func(key K, item *badger.Item) bool {
+		var raw []byte
+		if raw, err = item.ValueCopy(nil); err != nil {
+			return false
+		}
+		value, _ := decodeBadgerValue(raw)
+		return f(key, value)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (s *badgerSnapshot[K]) Keys(_ context.Context) []K {
+	keys := []K{}
+	s.scan(false, func(key K, _ *badger.Item) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func (s *badgerSnapshot[K]) Len(_ context.Context) int {
+	n := 0
+	s.scan(false, func(K, *badger.Item) bool {
+		n++
+		return true
+	})
+	return n
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newVersionedTestStore(t *testing.T, opts ...OptionFuncBadger) IMightyMapStorage[string, string] {
+	t.Helper()
+	opts = append([]OptionFuncBadger{WithMemoryStorage(true), WithNumVersionsToKeep(10)}, opts...)
+	return NewMightyMapBadgerStorage[string, string](opts...)
+}
+
+func TestBadgerLoadVersions(t *testing.T) {
+	ctx := context.Background()
+	store := newVersionedTestStore(t)
+	defer store.Close(ctx)
+	versioned := store.(IMightyMapVersionedStorage[string, string])
+
+	start := time.Now()
+	store.Store(ctx, "cfg", "v1")
+	store.Store(ctx, "cfg", "v2")
+	store.Store(ctx, "cfg", "v3")
+	store.Delete(ctx, "cfg")
+	store.Store(ctx, "cfg", "v4")
+	store.Store(ctx, "other", "x")
+
+	versions, err := versioned.LoadVersions(ctx, "cfg", 0)
+	if err != nil {
+		t.Fatalf("LoadVersions() error: %v", err)
+	}
+	want := []struct {
+		value   string
+		deleted bool
+	}{{"v4", false}, {"", true}, {"v3", false}, {"v2", false}, {"v1", false}}
+	if len(versions) != len(want) {
+		t.Fatalf("LoadVersions() returned %d versions; want %d: %+v", len(versions), len(want), versions)
+	}
+	for i, w := range want {
+		v := versions[i]
+		if v.Value != w.value || v.Deleted != w.deleted {
+			t.Errorf("version %d = %q (deleted %v); want %q (deleted %v)", i, v.Value, v.Deleted, w.value, w.deleted)
+		}
+		if i > 0 && v.Version >= versions[i-1].Version {
+			t.Errorf("versions not ordered newest first: %d after %d", v.Version, versions[i-1].Version)
+		}
+		if !w.deleted && (v.Timestamp.Before(start) || v.Timestamp.After(time.Now())) {
+			t.Errorf("version %d has timestamp %v outside of the test run", i, v.Timestamp)
+		}
+	}
+
+	limited, err := versioned.LoadVersions(ctx, "cfg", 2)
+	if err != nil {
+		t.Fatalf("LoadVersions() error: %v", err)
+	}
+	if len(limited) != 2 || limited[0].Value != "v4" {
+		t.Errorf("LoadVersions(limit 2) = %+v; want the 2 newest versions", limited)
+	}
+
+	// the timestamp envelope is invisible to regular reads
+	if v, ok := store.Load(ctx, "cfg"); !ok || v != "v4" {
+		t.Errorf("Load() = %q, %v; want v4, true", v, ok)
+	}
+	store.Range(ctx, func(key, value string) bool {
+		if (key == "cfg" && value != "v4") || (key == "other" && value != "x") {
+			t.Errorf("Range() visited %q = %q", key, value)
+		}
+		return true
+	})
+	if err := store.(IMightyMapParallelRangeStorage[string, string]).ParallelRange(ctx, 2, func(key, value string) bool {
+		if key == "other" && value != "x" {
+			t.Errorf("ParallelRange() visited %q = %q", key, value)
+		}
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if k, v, ok := store.Next(ctx); !ok || (k == "cfg" && v != "v4") || (k == "other" && v != "x") {
+		t.Errorf("Next() = %q, %q, %v", k, v, ok)
+	}
+}
+
+func TestBadgerLoadAt(t *testing.T) {
+	ctx := context.Background()
+	store := newVersionedTestStore(t)
+	defer store.Close(ctx)
+	versioned := store.(IMightyMapVersionedStorage[string, string])
+
+	before, _ := versioned.CurrentVersion(ctx)
+	store.Store(ctx, "cfg", "v1")
+	afterV1, _ := versioned.CurrentVersion(ctx)
+	store.Store(ctx, "cfg", "v2")
+	afterV2, _ := versioned.CurrentVersion(ctx)
+	store.Delete(ctx, "cfg")
+	afterDelete, _ := versioned.CurrentVersion(ctx)
+
+	tests := []struct {
+		version uint64
+		want    string
+		ok      bool
+	}{
+		{before, "", false},
+		{afterV1, "v1", true},
+		{afterV2, "v2", true},
+		{afterDelete, "", false},
+	}
+	for _, tt := range tests {
+		v, ok, err := versioned.LoadAt(ctx, "cfg", tt.version)
+		if err != nil {
+			t.Fatalf("LoadAt(%d) error: %v", tt.version, err)
+		}
+		if v != tt.want || ok != tt.ok {
+			t.Errorf("LoadAt(%d) = %q, %v; want %q, %v", tt.version, v, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBadgerSnapshotAt(t *testing.T) {
+	ctx := context.Background()
+	store := newVersionedTestStore(t)
+	defer store.Close(ctx)
+	versioned := store.(IMightyMapVersionedStorage[string, string])
+
+	store.Store(ctx, "a", "a1")
+	store.Store(ctx, "b", "b1")
+	version, err := versioned.CurrentVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := versioned.SnapshotAt(ctx, version)
+	if err != nil {
+		t.Fatalf("SnapshotAt() error: %v", err)
+	}
+
+	// writers continue after the snapshot was taken
+	store.Store(ctx, "a", "a2")
+	store.Delete(ctx, "b")
+	store.Store(ctx, "c", "c1")
+
+	if snapshot.Version() != version {
+		t.Errorf("Version() = %d; want %d", snapshot.Version(), version)
+	}
+	if v, ok := snapshot.Load(ctx, "a"); !ok || v != "a1" {
+		t.Errorf("snapshot Load(a) = %q, %v; want a1, true", v, ok)
+	}
+	if v, ok := snapshot.Load(ctx, "b"); !ok || v != "b1" {
+		t.Errorf("snapshot Load(b) = %q, %v; want b1, true", v, ok)
+	}
+	if _, ok := snapshot.Load(ctx, "c"); ok {
+		t.Error("snapshot sees a key written after it was taken")
+	}
+	if n := snapshot.Len(ctx); n != 2 {
+		t.Errorf("snapshot Len() = %d; want 2", n)
+	}
+	if keys := snapshot.Keys(ctx); len(keys) != 2 {
+		t.Errorf("snapshot Keys() = %v; want a and b", keys)
+	}
+	got := map[string]string{}
+	snapshot.Range(ctx, func(key, value string) bool {
+		got[key] = value
+		return true
+	})
+	if len(got) != 2 || got["a"] != "a1" || got["b"] != "b1" {
+		t.Errorf("snapshot Range() = %v; want a=a1 b=b1", got)
+	}
+
+	if _, err := versioned.SnapshotAt(ctx, version+1000); err != ErrFutureVersion {
+		t.Errorf("SnapshotAt(future) error = %v; want ErrFutureVersion", err)
+	}
+}
+
+func TestBadgerVersionsWithoutHistory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// values written with timestamps stay readable when the history is switched off
+	store := newVersionedTestStore(t, WithMemoryStorage(false), WithTempDir(dir))
+	store.Store(ctx, "a", "with timestamp")
+	store.Close(ctx)
+
+	store = NewMightyMapBadgerStorage[string, string](WithMemoryStorage(false), WithTempDir(dir))
+	defer store.Close(ctx)
+	if v, ok := store.Load(ctx, "a"); !ok || v != "with timestamp" {
+		t.Errorf("Load() = %q, %v; want the value written with history enabled", v, ok)
+	}
+
+	store.Store(ctx, "b", "plain")
+	versions, err := store.(IMightyMapVersionedStorage[string, string]).LoadVersions(ctx, "b", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Value != "plain" || !versions[0].Timestamp.IsZero() {
+		t.Errorf("LoadVersions() = %+v; want one version without timestamp", versions)
+	}
+}
+
+func TestVersionsNotSupported(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapSQLiteStorage[string, string]()
+	defer store.Close(ctx)
+
+	if _, err := store.(IMightyMapVersionedStorage[string, string]).LoadVersions(ctx, "a", 0); err != ErrNotSupported {
+		t.Errorf("LoadVersions() error = %v; want ErrNotSupported", err)
+	}
+}
@@ -1,8 +1,15 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
 )
 
 func TestMightyMapBadgerStorageDelete(t *testing.T) {
@@ -240,3 +247,480 @@ func TestMightyMapBadgerStorageKeys(t *testing.T) {
 		}
 	})
 }
+
+func TestMightyMapBadgerStorageExactLen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	open := func() IMightyMapStorage[string, int] {
+		return NewMightyMapBadgerStorage[string, int](
+			WithMemoryStorage(false),
+			WithTempDir(dir),
+		)
+	}
+
+	store := open()
+
+	t.Run("Overwrites do not change Len", func(t *testing.T) {
+		store.Store(ctx, "key1", 1)
+		store.Store(ctx, "key1", 2)
+		store.Store(ctx, "key2", 3)
+		if n := store.Len(ctx); n != 2 {
+			t.Errorf("Len() = %d; want 2", n)
+		}
+	})
+
+	t.Run("Deleting missing keys does not change Len", func(t *testing.T) {
+		store.Delete(ctx, "missing", "key2", "key2")
+		if n := store.Len(ctx); n != 1 {
+			t.Errorf("Len() = %d; want 1", n)
+		}
+	})
+
+	t.Run("Counter is not visible as a key", func(t *testing.T) {
+		keys := store.Keys(ctx)
+		if len(keys) != 1 || keys[0] != "key1" {
+			t.Errorf("Keys() = %v; want [key1]", keys)
+		}
+		count := 0
+		store.Range(ctx, func(string, int) bool {
+			count++
+			return true
+		})
+		if count != 1 {
+			t.Errorf("Range() visited %d items; want 1", count)
+		}
+	})
+
+	t.Run("Len survives reopening", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			store.Store(ctx, fmt.Sprintf("bulk%d", i), i)
+		}
+		if err := store.Close(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		store = open()
+		raw := store.(*msgpackAdapter[string, int]).storage.(*mightyMapBadgerStorage[string])
+		err := raw.db.View(func(txn *badger.Txn) error {
+			_, err := txn.Get(badgerLenKey)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("expected persisted counter: %v", err)
+		}
+		if n := store.Len(ctx); n != 101 {
+			t.Errorf("Len() after reopen = %d; want 101", n)
+		}
+	})
+
+	t.Run("Next and Clear keep the counter exact", func(t *testing.T) {
+		if _, _, ok := store.Next(ctx); !ok {
+			t.Fatal("Next() returned no item")
+		}
+		if n := store.Len(ctx); n != 100 {
+			t.Errorf("Len() after Next = %d; want 100", n)
+		}
+		store.Clear(ctx)
+		store.Store(ctx, "again", 1)
+		if n := store.Len(ctx); n != 1 {
+			t.Errorf("Len() after Clear = %d; want 1", n)
+		}
+	})
+
+	store.Close(ctx)
+}
+
+func TestMightyMapBadgerStorageLenWithoutCounter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(false), WithTempDir(dir))
+	store.Store(ctx, "key1", 1)
+	store.Store(ctx, "key2", 2)
+
+	// simulate a database written before the counter existed
+	raw := store.(*msgpackAdapter[string, int]).storage.(*mightyMapBadgerStorage[string])
+	err := raw.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(badgerLenKey)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close(ctx)
+
+	store = NewMightyMapBadgerStorage[string, int](WithMemoryStorage(false), WithTempDir(dir))
+	defer store.Close(ctx)
+	if n := store.Len(ctx); n != 2 {
+		t.Errorf("Len() = %d; want 2", n)
+	}
+}
+
+func TestMightyMapBadgerStorageConcurrentLen(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBadgerStorage[int, int](WithMemoryStorage(true))
+	defer store.Close(ctx)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				store.Store(ctx, i, i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := store.Len(ctx); n != 200 {
+		t.Errorf("Len() = %d; want 200", n)
+	}
+}
+
+func TestMightyMapBadgerStorageConcurrentStoreDelete(t *testing.T) {
+	for _, detect := range []bool{true, false} {
+		t.Run(fmt.Sprintf("detectConflicts=%v", detect), func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMightyMapBadgerStorage[int, int](WithMemoryStorage(true), WithDetectConflicts(detect))
+			defer store.Close(ctx)
+
+			var wg sync.WaitGroup
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < 100; i++ {
+						store.Store(ctx, w*100+i, i)
+					}
+					for i := 0; i < 50; i++ {
+						store.Delete(ctx, w*100+i)
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			if n := store.Len(ctx); n != 400 {
+				t.Errorf("Len() = %d; want 400", n)
+			}
+			if n := len(store.Keys(ctx)); n != 400 {
+				t.Errorf("len(Keys()) = %d; want 400", n)
+			}
+		})
+	}
+}
+
+func TestMightyMapBadgerStorageMaintenanceStopsOnClose(t *testing.T) {
+	ctx := context.Background()
+	var runs atomic.Int64
+	store := NewMightyMapBadgerStorage[string, int](
+		WithMemoryStorage(false),
+		WithTempDir(t.TempDir()),
+		WithGcInterval(5*time.Millisecond),
+		WithGcCallback(func(r BadgerGCResult) {
+			if r.Err != nil {
+				t.Errorf("unexpected GC error: %v", r.Err)
+			}
+			runs.Add(1)
+		}),
+	)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runs.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if runs.Load() == 0 {
+		t.Fatal("GC callback was never called")
+	}
+
+	if err := store.Close(ctx); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+	after := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	if runs.Load() != after {
+		t.Error("GC kept running after Close")
+	}
+}
+
+func TestMightyMapBadgerStorageCompact(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBadgerStorage[int, []byte](
+		WithMemoryStorage(false),
+		WithTempDir(t.TempDir()),
+		WithValueThreshold(1<<10),
+	)
+	defer store.Close(ctx)
+
+	value := bytes.Repeat([]byte{'x'}, 4<<10)
+	for i := 0; i < 500; i++ {
+		store.Store(ctx, i, value)
+	}
+	for i := 0; i < 400; i++ {
+		store.Delete(ctx, i)
+	}
+
+	if err := store.(IMightyMapCompactStorage).Compact(ctx); err != nil {
+		t.Fatalf("Compact() error: %v", err)
+	}
+	if n := store.Len(ctx); n != 100 {
+		t.Errorf("Len() after Compact = %d; want 100", n)
+	}
+	if v, ok := store.Load(ctx, 450); !ok || !bytes.Equal(v, value) {
+		t.Error("live entry lost by Compact")
+	}
+
+	_, vlog, err := store.(IMightyMapSizeStorage).Size(ctx)
+	if err != nil {
+		t.Fatalf("Size() error: %v", err)
+	}
+	if vlog <= 0 {
+		t.Errorf("Size() value log = %d; want a positive size", vlog)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := store.(IMightyMapCompactStorage).Compact(cancelled); err != context.Canceled {
+		t.Errorf("Compact() with cancelled context error = %v; want context.Canceled", err)
+	}
+}
+
+func TestMightyMapBadgerStorageCompactInMemory(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(true))
+	defer store.Close(ctx)
+	store.Store(ctx, "a", 1)
+
+	if err := store.(IMightyMapCompactStorage).Compact(ctx); err != nil {
+		t.Errorf("Compact() error: %v", err)
+	}
+}
+
+func TestMightyMapBadgerStorageConcurrentNext(t *testing.T) {
+	ctx := context.Background()
+	const (
+		items   = 5000
+		poppers = 32
+	)
+	store := NewMightyMapBadgerStorage[int, int](WithMemoryStorage(true))
+	defer store.Close(ctx)
+
+	for i := 0; i < items; i++ {
+		store.Store(ctx, i, i)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		delivered = make(map[int]int)
+	)
+	for p := 0; p < poppers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				key, value, ok := store.Next(ctx)
+				if !ok {
+					return
+				}
+				if key != value {
+					t.Errorf("Next() = %d, %d; want matching key and value", key, value)
+				}
+				mu.Lock()
+				delivered[key]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(delivered) != items {
+		t.Errorf("delivered %d distinct items; want %d", len(delivered), items)
+	}
+	for key, n := range delivered {
+		if n != 1 {
+			t.Errorf("item %d delivered %d times", key, n)
+		}
+	}
+	if n := store.Len(ctx); n != 0 {
+		t.Errorf("Len() after draining = %d; want 0", n)
+	}
+}
+
+func TestMightyMapBadgerStorageNextWithConcurrentTouch(t *testing.T) {
+	ctx := context.Background()
+	const items = 1000
+	store := NewMightyMapBadgerStorage[int, int](
+		WithMemoryStorage(true),
+		WithExpire(time.Hour),
+	)
+	defer store.Close(ctx)
+
+	for i := 0; i < items; i++ {
+		store.Store(ctx, i, i)
+	}
+
+	// Touch rewrites entries without the write lock, which makes Next conflict and retry
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < items; i++ {
+			_ = store.(IMightyMapTouchStorage[int]).Touch(ctx, i)
+		}
+	}()
+
+	seen := make(map[int]bool)
+	for {
+		key, _, ok := store.Next(ctx)
+		if !ok {
+			break
+		}
+		if seen[key] {
+			t.Fatalf("item %d delivered twice", key)
+		}
+		seen[key] = true
+	}
+	<-done
+
+	// a Touch that ran after the pop must not resurrect the entry
+	if n := len(seen) + store.Len(ctx); n != items {
+		t.Errorf("delivered %d items and %d remain; want %d in total", len(seen), store.Len(ctx), items)
+	}
+}
+
+func TestMightyMapBadgerStorageReadOnly(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	writer := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(false), WithTempDir(dir))
+	writer.Store(ctx, "a", 1)
+	writer.Store(ctx, "b", 2)
+	if err := writer.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// several read-only instances can share the directory
+	store := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(false), WithTempDir(dir), WithReadOnly(true))
+	defer store.Close(ctx)
+	other := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(false), WithTempDir(dir), WithReadOnly(true))
+	defer other.Close(ctx)
+
+	if v, ok := store.Load(ctx, "b"); !ok || v != 2 {
+		t.Errorf("Load() = %d, %v; want 2, true", v, ok)
+	}
+	if n := store.Len(ctx); n != 2 {
+		t.Errorf("Len() = %d; want 2", n)
+	}
+	if n := other.Len(ctx); n != 2 {
+		t.Errorf("Len() of second reader = %d; want 2", n)
+	}
+
+	writes := map[string]func(){
+		"Store":  func() { store.Store(ctx, "c", 3) },
+		"Delete": func() { store.Delete(ctx, "a") },
+		"Clear":  func() { store.Clear(ctx) },
+		"Next":   func() { store.Next(ctx) },
+	}
+	for name, write := range writes {
+		func() {
+			defer func() {
+				if r := recover(); r != ErrReadOnly {
+					t.Errorf("%s panicked with %v; want ErrReadOnly", name, r)
+				}
+			}()
+			write()
+		}()
+	}
+	if err := store.(IMightyMapTouchStorage[string]).Touch(ctx, "a"); err != ErrReadOnly {
+		t.Errorf("Touch() error = %v; want ErrReadOnly", err)
+	}
+	if err := store.(IMightyMapCompactStorage).Compact(ctx); err != ErrReadOnly {
+		t.Errorf("Compact() error = %v; want ErrReadOnly", err)
+	}
+	if n := store.Len(ctx); n != 2 {
+		t.Errorf("Len() after rejected writes = %d; want 2", n)
+	}
+}
+
+func TestMightyMapBadgerStorageReadOnlyInMemory(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("read-only in-memory storage did not panic")
+		}
+	}()
+	NewMightyMapBadgerStorage[string, int](WithMemoryStorage(true), WithReadOnly(true))
+}
+
+func TestMightyMapBadgerStorageSlidingWithVersions(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("sliding expiration with version history did not panic")
+		}
+	}()
+	NewMightyMapBadgerStorage[string, int](
+		WithMemoryStorage(true),
+		WithExpire(time.Minute),
+		WithSlidingExpiration(true),
+		WithNumVersionsToKeep(3),
+	)
+}
+
+func TestMightyMapBadgerStorageSlidingLoadWithConcurrentStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBadgerStorage[string, int](
+		WithMemoryStorage(true),
+		WithExpire(time.Minute),
+		WithSlidingExpiration(true),
+	)
+	defer store.Close(ctx)
+
+	store.Store(ctx, "key", 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 200 {
+			store.Store(ctx, "key", 2)
+		}
+	}()
+	for range 200 {
+		if _, ok := store.Load(ctx, "key"); !ok {
+			t.Fatal("sliding Load reported an existing key as missing")
+		}
+	}
+	<-done
+}
+
+func TestMightyMapBadgerStorageLenWithExpire(t *testing.T) {
+	ctx := context.Background()
+
+	for _, exact := range []bool{false, true} {
+		t.Run(fmt.Sprintf("exact=%v", exact), func(t *testing.T) {
+			t.Parallel()
+			store := NewMightyMapBadgerStorage[string, int](
+				WithMemoryStorage(true),
+				WithExpire(time.Second),
+				WithExactLen(exact),
+				WithGcInterval(time.Hour),
+			)
+			defer store.Close(ctx)
+
+			store.Store(ctx, "key1", 1)
+			store.Store(ctx, "key2", 2)
+			if n := store.Len(ctx); n != 2 {
+				t.Fatalf("Len() = %d; want 2", n)
+			}
+
+			// Badger TTLs have a granularity of one second
+			time.Sleep(2100 * time.Millisecond)
+			store.Store(ctx, "key3", 3)
+			want := 1
+			if !exact {
+				// the counter still includes the expired keys until the next recount
+				want = 3
+			}
+			if n := store.Len(ctx); n != want {
+				t.Errorf("Len() = %d; want %d", n, want)
+			}
+		})
+	}
+}
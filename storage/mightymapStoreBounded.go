@@ -0,0 +1,386 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// boundedReadStripes is the number of buffers Load records accesses in
+	boundedReadStripes = 16
+	// boundedReadBufferSize is the number of accesses a buffer holds before it is applied
+	boundedReadBufferSize = 64
+	// boundedDefaultCapacity sizes the TinyLFU sketch when no entry limit is set
+	boundedDefaultCapacity = 1024
+)
+
+// CacheStats holds the counters of a storage used as a cache.
+type CacheStats struct {
+	// Hits is the number of Load calls that found their key.
+	Hits uint64
+	// Misses is the number of Load calls that did not find their key.
+	Misses uint64
+	// Evictions is the number of entries removed to stay within the limits, including new
+	// entries that were rejected right away.
+	Evictions uint64
+}
+
+// HitRatio returns the share of Load calls that found their key, 0 if Load was never called.
+func (s CacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// mightyMapBoundedStorage is an in-memory storage with a maximum number of entries and/or a
+// maximum total cost, evicting entries chosen by an eviction policy when a write exceeds them.
+//
+// Load only takes the read lock of the map. The access it makes is recorded in one of several
+// small buffers, picked round robin, and applied to the policy in batches when a buffer is full
+// or before the next write. When the policy is busy and a buffer is full, further accesses are
+// dropped until it is drained; the policy only needs an approximate picture of the accesses.
+// The policy has its own lock, always taken after the map lock.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+type mightyMapBoundedStorage[K comparable, V any] struct {
+	data       map[K]boundedEntry[V]
+	mutex      *sync.RWMutex
+	maxEntries int
+	maxCost    int64
+	totalCost  int64
+	cost       func(key K, value V) int64
+	onEvict    func(key K, value V)
+
+	policyMu   sync.Mutex
+	policy     evictionPolicy[K]
+	reads      [boundedReadStripes]boundedReadBuffer[K]
+	readCursor atomic.Uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+type boundedEntry[V any] struct {
+	value V
+	cost  int64
+}
+
+// boundedReadBuffer holds accesses recorded by Load that were not applied to the policy yet.
+type boundedReadBuffer[K comparable] struct {
+	mu   sync.Mutex
+	keys []K
+}
+
+type boundedOpts struct {
+	maxEntries int
+	maxCost    int64
+	policy     EvictionPolicy
+	cost       any
+	onEvict    any
+}
+
+// OptionFuncBounded is a function type that modifies boundedOpts configuration.
+// It allows customizing the limits and eviction of the bounded in-memory storage
+// through functional options pattern.
+type OptionFuncBounded func(*boundedOpts)
+
+// WithBoundedStorageMaxEntries sets the maximum number of entries. Storing a new key while the
+// storage is full evicts an entry first.
+// **Default value**: `0` (no entry limit)
+func WithBoundedStorageMaxEntries(maxEntries int) OptionFuncBounded {
+	return func(o *boundedOpts) {
+		o.maxEntries = maxEntries
+	}
+}
+
+// WithBoundedStorageMaxCost sets the maximum total cost of the entries, see
+// WithBoundedStorageCost. An entry that costs more than the maximum on its own is not stored.
+// **Default value**: `0` (no cost limit)
+func WithBoundedStorageMaxCost(maxCost int64) OptionFuncBounded {
+	return func(o *boundedOpts) {
+		o.maxCost = maxCost
+	}
+}
+
+// WithBoundedStorageCost sets the function computing the cost of an entry when it is stored,
+// typically its size in bytes. Its key and value types must match the storage.
+// **Default value**: every entry costs `1`
+func WithBoundedStorageCost[K comparable, V any](cost func(key K, value V) int64) OptionFuncBounded {
+	return func(o *boundedOpts) {
+		o.cost = cost
+	}
+}
+
+// WithBoundedStorageEvictionPolicy sets the policy choosing the entries to evict.
+// **Default value**: `LRU`
+func WithBoundedStorageEvictionPolicy(policy EvictionPolicy) OptionFuncBounded {
+	return func(o *boundedOpts) {
+		o.policy = policy
+	}
+}
+
+// WithBoundedStorageOnEvict sets a function called with every entry evicted to stay within the
+// limits, after the write that caused it released its locks, so it may use the storage.
+// Entries removed by Delete, Next or Clear are not reported. Its key and value types must
+// match the storage.
+// **Default value**: `nil`
+func WithBoundedStorageOnEvict[K comparable, V any](onEvict func(key K, value V)) OptionFuncBounded {
+	return func(o *boundedOpts) {
+		o.onEvict = onEvict
+	}
+}
+
+// NewMightyMapBoundedStorage creates an in-memory storage for use as a cache, holding at most
+// the number of entries set with WithBoundedStorageMaxEntries and/or the total cost set with
+// WithBoundedStorageMaxCost. Without either it never evicts. Like the default storage, values
+// are stored as-is without any serialization.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+//
+// Parameters:
+//   - optfuncs: Optional configuration functions that modify boundedOpts settings
+//
+// Returns a new IMightyMapStorage instance ready for use.
+// Panics if the cost or eviction function does not match the key and value types.
+func NewMightyMapBoundedStorage[K comparable, V any](optfuncs ...OptionFuncBounded) IMightyMapStorage[K, V] {
+	opts := &boundedOpts{}
+	for _, optfunc := range optfuncs {
+		optfunc(opts)
+	}
+
+	c := &mightyMapBoundedStorage[K, V]{
+		data:       make(map[K]boundedEntry[V]),
+		mutex:      &sync.RWMutex{},
+		maxEntries: opts.maxEntries,
+		maxCost:    opts.maxCost,
+		cost:       func(K, V) int64 { return 1 },
+	}
+	if opts.cost != nil {
+		cost, ok := opts.cost.(func(key K, value V) int64)
+		if !ok {
+			panic(fmt.Sprintf("mightymap: cost function %T does not match storage of %T to %T", opts.cost, *new(K), *new(V)))
+		}
+		c.cost = cost
+	}
+	if opts.onEvict != nil {
+		onEvict, ok := opts.onEvict.(func(key K, value V))
+		if !ok {
+			panic(fmt.Sprintf("mightymap: eviction function %T does not match storage of %T to %T", opts.onEvict, *new(K), *new(V)))
+		}
+		c.onEvict = onEvict
+	}
+	capacity := boundedDefaultCapacity
+	if opts.maxEntries > 0 {
+		capacity = opts.maxEntries
+	}
+	c.policy = newEvictionPolicy[K](opts.policy, capacity)
+	return c
+}
+
+// Load retrieves a value for the given key under the read lock and records the access for the
+// eviction policy without waiting for it.
+func (c *mightyMapBoundedStorage[K, V]) Load(_ context.Context, key K) (value V, ok bool) {
+	c.mutex.RLock()
+	entry, ok := c.data[key]
+	c.mutex.RUnlock()
+	if !ok {
+		c.misses.Add(1)
+		return value, false
+	}
+	c.hits.Add(1)
+	c.recordAccess(key)
+	return entry.value, true
+}
+
+// recordAccess adds key to a read buffer and applies the buffers to the policy once it is
+// full, unless another goroutine holds the policy.
+func (c *mightyMapBoundedStorage[K, V]) recordAccess(key K) {
+	b := &c.reads[c.readCursor.Add(1)%boundedReadStripes]
+	b.mu.Lock()
+	if len(b.keys) < boundedReadBufferSize {
+		b.keys = append(b.keys, key)
+	}
+	full := len(b.keys) >= boundedReadBufferSize
+	b.mu.Unlock()
+
+	if full && c.policyMu.TryLock() {
+		c.drainReads()
+		c.policyMu.Unlock()
+	}
+}
+
+// drainReads applies the buffered accesses to the policy. The caller must hold policyMu.
+func (c *mightyMapBoundedStorage[K, V]) drainReads() {
+	for i := range c.reads {
+		b := &c.reads[i]
+		b.mu.Lock()
+		keys := b.keys
+		b.keys = nil
+		b.mu.Unlock()
+		for _, key := range keys {
+			c.policy.access(key)
+		}
+	}
+}
+
+// Store adds or updates a key-value pair, then evicts entries until the storage is within its
+// limits again. An entry that exceeds the cost limit on its own is evicted right away, together
+// with the value it replaces.
+func (c *mightyMapBoundedStorage[K, V]) Store(_ context.Context, key K, value V) {
+	cost := c.cost(key, value)
+
+	c.mutex.Lock()
+	c.policyMu.Lock()
+	c.drainReads()
+	var evicted []boundedEvicted[K, V]
+	if c.maxCost > 0 && cost > c.maxCost {
+		if old, ok := c.data[key]; ok {
+			c.removeLocked(key, old)
+			evicted = append(evicted, boundedEvicted[K, V]{key, old.value})
+		}
+		evicted = append(evicted, boundedEvicted[K, V]{key, value})
+	} else {
+		if old, ok := c.data[key]; ok {
+			c.totalCost -= old.cost
+			c.policy.access(key)
+		} else {
+			c.policy.add(key)
+		}
+		c.data[key] = boundedEntry[V]{value: value, cost: cost}
+		c.totalCost += cost
+		evicted = c.evictLocked()
+	}
+	c.policyMu.Unlock()
+	c.mutex.Unlock()
+
+	c.evictions.Add(uint64(len(evicted)))
+	if c.onEvict != nil {
+		for _, e := range evicted {
+			c.onEvict(e.key, e.value)
+		}
+	}
+}
+
+type boundedEvicted[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// evictLocked removes the entries chosen by the policy while the storage exceeds a limit and
+// returns them. The caller must hold the write lock and policyMu.
+func (c *mightyMapBoundedStorage[K, V]) evictLocked() (evicted []boundedEvicted[K, V]) {
+	for (c.maxEntries > 0 && len(c.data) > c.maxEntries) || (c.maxCost > 0 && c.totalCost > c.maxCost) {
+		key, ok := c.policy.evict()
+		if !ok {
+			break
+		}
+		entry := c.data[key]
+		delete(c.data, key)
+		c.totalCost -= entry.cost
+		evicted = append(evicted, boundedEvicted[K, V]{key, entry.value})
+	}
+	return evicted
+}
+
+// removeLocked removes key from the map and the policy. The caller must hold the write lock
+// and policyMu.
+func (c *mightyMapBoundedStorage[K, V]) removeLocked(key K, entry boundedEntry[V]) {
+	delete(c.data, key)
+	c.totalCost -= entry.cost
+	c.policy.remove(key)
+}
+
+// Delete removes one or more keys and their associated values.
+// Non-existent keys are silently ignored.
+func (c *mightyMapBoundedStorage[K, V]) Delete(_ context.Context, keys ...K) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+	for _, key := range keys {
+		if entry, ok := c.data[key]; ok {
+			c.removeLocked(key, entry)
+		}
+	}
+}
+
+// Range iterates over all key-value pairs in an unspecified order under the read lock.
+// Visiting an entry does not count as an access for the eviction policy.
+// If the provided function returns false, iteration stops early.
+func (c *mightyMapBoundedStorage[K, V]) Range(_ context.Context, f func(key K, value V) bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for k, entry := range c.data {
+		if !f(k, entry.value) {
+			break
+		}
+	}
+}
+
+// Keys returns all keys in an unspecified order.
+func (c *mightyMapBoundedStorage[K, V]) Keys(_ context.Context) []K {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	keys := make([]K, 0, len(c.data))
+	for k := range c.data {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Next returns and removes an entry in an unspecified order under a single write lock, so
+// zero-value keys are returned as well.
+func (c *mightyMapBoundedStorage[K, V]) Next(_ context.Context) (key K, value V, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+	for k, entry := range c.data {
+		c.removeLocked(k, entry)
+		return k, entry.value, true
+	}
+	return key, value, false
+}
+
+// Len returns the current number of key-value pairs.
+func (c *mightyMapBoundedStorage[K, V]) Len(_ context.Context) int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.data)
+}
+
+// Clear removes all key-value pairs. The statistics are kept.
+func (c *mightyMapBoundedStorage[K, V]) Clear(_ context.Context) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.policyMu.Lock()
+	defer c.policyMu.Unlock()
+	c.drainReads()
+	c.data = make(map[K]boundedEntry[V])
+	c.totalCost = 0
+	c.policy.reset()
+}
+
+// Stats returns the hit, miss and eviction counters since the storage was created.
+func (c *mightyMapBoundedStorage[K, V]) Stats(_ context.Context) (CacheStats, error) {
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}, nil
+}
+
+// Close releases any resources held by the bounded storage.
+// For the bounded storage implementation, no cleanup is required.
+func (c *mightyMapBoundedStorage[K, V]) Close(_ context.Context) error {
+	// No resources to clean up for bounded storage
+	return nil
+}
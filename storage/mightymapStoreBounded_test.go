@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestBoundedStorage(t *testing.T) {
+	ctx := context.Background()
+
+	for name, policy := range map[string]EvictionPolicy{"LRU": LRU, "LFU": LFU, "TinyLFU": TinyLFU} {
+		t.Run(name, func(t *testing.T) {
+			var evicted []string
+			store := NewMightyMapBoundedStorage[string, int](
+				WithBoundedStorageMaxEntries(100),
+				WithBoundedStorageEvictionPolicy(policy),
+				WithBoundedStorageOnEvict(func(key string, _ int) {
+					evicted = append(evicted, key)
+				}),
+			)
+			defer store.Close(ctx)
+
+			for i := 0; i < 1000; i++ {
+				store.Store(ctx, fmt.Sprintf("key-%d", i), i)
+			}
+			if n := store.Len(ctx); n != 100 {
+				t.Errorf("Len() = %d; want 100", n)
+			}
+			if len(evicted) != 900 {
+				t.Errorf("OnEvict called %d times; want 900", len(evicted))
+			}
+			stats, err := store.(IMightyMapStatsStorage).Stats(ctx)
+			if err != nil || stats.Evictions != 900 {
+				t.Errorf("Stats() = %+v, %v; want 900 evictions", stats, err)
+			}
+
+			store.Delete(ctx, store.Keys(ctx)...)
+			store.Store(ctx, "a", 1)
+			if _, ok := store.Load(ctx, "a"); !ok {
+				t.Error("Load() of a stored key failed")
+			}
+			store.Load(ctx, "b")
+			stats, _ = store.(IMightyMapStatsStorage).Stats(ctx)
+			if stats.Hits != 1 || stats.Misses != 1 || stats.HitRatio() != 0.5 {
+				t.Errorf("Stats() = %+v; want 1 hit and 1 miss", stats)
+			}
+		})
+	}
+}
+
+func TestBoundedStorageKeepsPopularEntries(t *testing.T) {
+	ctx := context.Background()
+
+	for name, policy := range map[string]EvictionPolicy{"LFU": LFU, "TinyLFU": TinyLFU} {
+		t.Run(name, func(t *testing.T) {
+			store := NewMightyMapBoundedStorage[int, int](
+				WithBoundedStorageMaxEntries(100),
+				WithBoundedStorageEvictionPolicy(policy),
+			).(*mightyMapBoundedStorage[int, int])
+
+			for i := 0; i < 50; i++ {
+				store.Store(ctx, i, i)
+				for j := 0; j < 10; j++ {
+					store.Load(ctx, i)
+				}
+			}
+			// a scan of one-off keys must not push out the popular ones
+			for i := 1000; i < 2000; i++ {
+				store.Store(ctx, i, i)
+			}
+
+			kept := 0
+			for i := 0; i < 50; i++ {
+				if _, ok := store.Load(ctx, i); ok {
+					kept++
+				}
+			}
+			if kept < 45 {
+				t.Errorf("%d of 50 popular keys survived a scan; want at least 45", kept)
+			}
+		})
+	}
+}
+
+func TestBoundedStorageLRUOrder(t *testing.T) {
+	ctx := context.Background()
+	var evicted []int
+	store := NewMightyMapBoundedStorage[int, string](
+		WithBoundedStorageMaxEntries(3),
+		WithBoundedStorageOnEvict(func(key int, _ string) {
+			evicted = append(evicted, key)
+		}),
+	).(*mightyMapBoundedStorage[int, string])
+
+	store.Store(ctx, 1, "a")
+	store.Store(ctx, 2, "b")
+	store.Store(ctx, 3, "c")
+	store.Load(ctx, 1)
+	store.Store(ctx, 4, "d")
+	store.Store(ctx, 2, "bb")
+	store.Store(ctx, 5, "e")
+
+	// 1 outlives 2 thanks to the Load, storing 2 again adds it as a new key
+	if fmt.Sprint(evicted) != "[2 3 1]" {
+		t.Errorf("evicted %v; want [2 3 1]", evicted)
+	}
+	keys := store.Keys(ctx)
+	sort.Ints(keys)
+	if fmt.Sprint(keys) != "[2 4 5]" {
+		t.Errorf("Keys() = %v; want [2 4 5]", keys)
+	}
+}
+
+func TestBoundedStorageMaxCost(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	store := NewMightyMapBoundedStorage[string, string](
+		WithBoundedStorageMaxCost(10),
+		WithBoundedStorageCost(func(_ string, value string) int64 {
+			return int64(len(value))
+		}),
+		WithBoundedStorageOnEvict(func(key string, _ string) {
+			evicted = append(evicted, key)
+		}),
+	)
+
+	store.Store(ctx, "a", "12345")
+	store.Store(ctx, "b", "1234")
+	store.Store(ctx, "c", "12")
+	if fmt.Sprint(evicted) != "[a]" || store.Len(ctx) != 2 {
+		t.Errorf("evicted %v with %d entries left; want [a] with 2", evicted, store.Len(ctx))
+	}
+
+	// an entry larger than the limit is rejected and takes the old value with it
+	evicted = nil
+	store.Store(ctx, "b", "12345678901")
+	if _, ok := store.Load(ctx, "b"); ok {
+		t.Error("an entry over the cost limit was stored")
+	}
+	if fmt.Sprint(evicted) != "[b b]" || store.Len(ctx) != 1 {
+		t.Errorf("evicted %v with %d entries left; want [b b] with 1", evicted, store.Len(ctx))
+	}
+}
+
+func TestBoundedStorageMismatchedOption(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewMightyMapBoundedStorage() did not panic on a mismatched cost function")
+		}
+	}()
+	NewMightyMapBoundedStorage[string, int](WithBoundedStorageCost(func(int, int) int64 { return 1 }))
+}
+
+func TestBoundedStorageConcurrent(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBoundedStorage[int, int](
+		WithBoundedStorageMaxEntries(64),
+		WithBoundedStorageEvictionPolicy(TinyLFU),
+	)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := (g*7 + i) % 256
+				if i%4 == 0 {
+					store.Store(ctx, key, i)
+				} else if i%97 == 0 {
+					store.Delete(ctx, key)
+				} else {
+					store.Load(ctx, key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if n := store.Len(ctx); n > 64 {
+		t.Errorf("Len() = %d; want at most 64", n)
+	}
+	b := store.(*mightyMapBoundedStorage[int, int])
+	b.policyMu.Lock()
+	defer b.policyMu.Unlock()
+	if tracked := len(b.policy.(*tinyLFUPolicy[int]).elements); tracked != store.Len(ctx) {
+		t.Errorf("policy tracks %d keys; want %d", tracked, store.Len(ctx))
+	}
+}
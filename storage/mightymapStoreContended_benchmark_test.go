@@ -0,0 +1,81 @@
+package storage_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/thisisdevelopment/mightymap/internal/storagetest"
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+// The benchmarks below compare the in-memory storages under concurrent load.
+// Run them with several values of GOMAXPROCS to see how they scale, e.g.
+//
+//	go test ./storage -run '^$' -bench 'Contended|ReadMostly' -cpu 1,4,16,64
+
+const (
+	contendedKeys  = 1 << 16
+	readMostlyKeys = 1 << 10
+)
+
+// benchmarkContended runs a mix of Store and Load calls over keys keys on all procs,
+// writePercent of them Store.
+func benchmarkContended(b *testing.B, storages map[string]func(testing.TB) storage.IMightyMapStorage[int, int], keys, writePercent int) {
+	for name, newStore := range storages {
+		b.Run(name, func(b *testing.B) {
+			store := newStore(b)
+			for i := 0; i < keys; i++ {
+				store.Store(ctx, i, i)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+				for pb.Next() {
+					key := r.IntN(keys)
+					if r.IntN(100) < writePercent {
+						store.Store(ctx, key, key)
+					} else {
+						store.Load(ctx, key)
+					}
+				}
+			})
+		})
+	}
+}
+
+func contendedStorages(b *testing.B) map[string]func(testing.TB) storage.IMightyMapStorage[int, int] {
+	return storagetest.Storages[int, int](b, []storagetest.Config{
+		{Backend: storagetest.Default},
+		{Backend: storagetest.Sharded},
+	})
+}
+
+func BenchmarkContendedWrites(b *testing.B) {
+	benchmarkContended(b, contendedStorages(b), contendedKeys, 100)
+}
+
+func BenchmarkContendedMixed(b *testing.B) {
+	benchmarkContended(b, contendedStorages(b), contendedKeys, 10)
+}
+
+func BenchmarkContendedReads(b *testing.B) {
+	benchmarkContended(b, contendedStorages(b), contendedKeys, 0)
+}
+
+// readMostlyStorages adds the read-optimized storage, whose writes copy the whole map, so it is
+// only benchmarked on a small map and low write ratios.
+func readMostlyStorages(b *testing.B) map[string]func(testing.TB) storage.IMightyMapStorage[int, int] {
+	return storagetest.Storages[int, int](b, []storagetest.Config{
+		{Backend: storagetest.Default},
+		{Backend: storagetest.Sharded},
+		{Backend: storagetest.ReadOptimized},
+	})
+}
+
+func BenchmarkReadMostly99to1(b *testing.B) {
+	benchmarkContended(b, readMostlyStorages(b), readMostlyKeys, 1)
+}
+
+func BenchmarkReadMostly90to10(b *testing.B) {
+	benchmarkContended(b, readMostlyStorages(b), readMostlyKeys, 10)
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// mightyMapReadOptimizedStorage is an in-memory storage for read-mostly data, such as feature
+// flags or routing tables, whose reads take no lock at all.
+//
+// The entries live in an immutable map that is replaced atomically on every change: readers
+// load the current map and use it without synchronization, writers copy it, apply their change
+// to the copy and publish the copy. Writers arriving while a copy is being made join a batch
+// that the next copy applies at once, so concurrent writers share the cost of copying. A write
+// costs O(n) regardless, which makes this storage a poor fit for large or write-heavy maps.
+//
+// Range, Keys and Len work on the map current when they start, a consistent snapshot, so Range
+// callbacks may write to the storage.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+type mightyMapReadOptimizedStorage[K comparable, V any] struct {
+	data atomic.Pointer[map[K]V]
+
+	// batchMu guards batch, the changes waiting for the next copy
+	batchMu sync.Mutex
+	batch   *readOptimizedBatch[K, V]
+	// commitMu serializes the copies
+	commitMu sync.Mutex
+}
+
+// readOptimizedBatch collects changes made while another batch is being applied.
+type readOptimizedBatch[K comparable, V any] struct {
+	changes []func(m map[K]V)
+	done    chan struct{}
+}
+
+// NewMightyMapReadOptimizedStorage creates an in-memory storage with lock-free reads and
+// copy-on-write updates, for maps that are read far more often than they are written.
+// Values are stored as-is without any serialization.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+//
+// Returns a new IMightyMapStorage instance ready for use.
+func NewMightyMapReadOptimizedStorage[K comparable, V any]() IMightyMapStorage[K, V] {
+	c := &mightyMapReadOptimizedStorage[K, V]{}
+	c.data.Store(&map[K]V{})
+	return c
+}
+
+// update applies change to a copy of the entries and publishes it, together with the changes of
+// concurrent callers. The first caller of a batch copies the map once it is its turn; the others
+// wait for it. Changes are applied in the order update was called and must not call the storage.
+func (c *mightyMapReadOptimizedStorage[K, V]) update(change func(m map[K]V)) {
+	c.batchMu.Lock()
+	b := c.batch
+	leader := b == nil
+	if leader {
+		b = &readOptimizedBatch[K, V]{done: make(chan struct{})}
+		c.batch = b
+	}
+	b.changes = append(b.changes, change)
+	c.batchMu.Unlock()
+
+	if !leader {
+		<-b.done
+		return
+	}
+
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+	// close the batch, later callers start the next one
+	c.batchMu.Lock()
+	c.batch = nil
+	c.batchMu.Unlock()
+
+	old := *c.data.Load()
+	m := make(map[K]V, len(old))
+	for k, v := range old {
+		m[k] = v
+	}
+	for _, change := range b.changes {
+		change(m)
+	}
+	c.data.Store(&m)
+	close(b.done)
+}
+
+// Load retrieves a value for the given key without taking a lock.
+func (c *mightyMapReadOptimizedStorage[K, V]) Load(_ context.Context, key K) (value V, ok bool) {
+	value, ok = (*c.data.Load())[key]
+	return
+}
+
+// Store adds or updates a key-value pair by publishing a new copy of the entries.
+func (c *mightyMapReadOptimizedStorage[K, V]) Store(_ context.Context, key K, value V) {
+	c.update(func(m map[K]V) {
+		m[key] = value
+	})
+}
+
+// Delete removes one or more keys by publishing a new copy of the entries.
+// Non-existent keys are silently ignored, and nothing is copied if none of the keys exist.
+func (c *mightyMapReadOptimizedStorage[K, V]) Delete(_ context.Context, keys ...K) {
+	current := *c.data.Load()
+	found := false
+	for _, key := range keys {
+		if _, found = current[key]; found {
+			break
+		}
+	}
+	if !found {
+		return
+	}
+	c.update(func(m map[K]V) {
+		for _, key := range keys {
+			delete(m, key)
+		}
+	})
+}
+
+// Range iterates over a snapshot of all key-value pairs in an unspecified order without taking
+// a lock. Changes made while iterating, also by f, are not visited.
+// If the provided function returns false, iteration stops early.
+func (c *mightyMapReadOptimizedStorage[K, V]) Range(_ context.Context, f func(key K, value V) bool) {
+	for k, v := range *c.data.Load() {
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+// Keys returns all keys of a snapshot in an unspecified order.
+func (c *mightyMapReadOptimizedStorage[K, V]) Keys(_ context.Context) []K {
+	data := *c.data.Load()
+	keys := make([]K, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Next returns and removes an entry in an unspecified order by publishing a new copy of the
+// entries. Concurrent callers each receive a different entry.
+func (c *mightyMapReadOptimizedStorage[K, V]) Next(_ context.Context) (key K, value V, ok bool) {
+	if len(*c.data.Load()) == 0 {
+		return key, value, false
+	}
+	c.update(func(m map[K]V) {
+		for k, v := range m {
+			delete(m, k)
+			key, value, ok = k, v, true
+			return
+		}
+	})
+	return key, value, ok
+}
+
+// Len returns the number of key-value pairs without taking a lock.
+func (c *mightyMapReadOptimizedStorage[K, V]) Len(_ context.Context) int {
+	return len(*c.data.Load())
+}
+
+// Clear removes all key-value pairs.
+func (c *mightyMapReadOptimizedStorage[K, V]) Clear(_ context.Context) {
+	c.update(func(m map[K]V) {
+		clear(m)
+	})
+}
+
+// Close releases any resources held by the read-optimized storage.
+// For the read-optimized storage implementation, no cleanup is required.
+func (c *mightyMapReadOptimizedStorage[K, V]) Close(_ context.Context) error {
+	// No resources to clean up for read-optimized storage
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestReadOptimizedStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapReadOptimizedStorage[int, string]()
+	defer store.Close(ctx)
+
+	for i := 0; i < 10; i++ {
+		store.Store(ctx, i, "value")
+	}
+	store.Delete(ctx, 3, 4, 1000)
+	store.Delete(ctx, 1000)
+	if n := store.Len(ctx); n != 8 {
+		t.Errorf("Len() = %d; want 8", n)
+	}
+	if _, ok := store.Load(ctx, 3); ok {
+		t.Error("Load() found a deleted key")
+	}
+	keys := store.Keys(ctx)
+	sort.Ints(keys)
+	if len(keys) != 8 || keys[0] != 0 || keys[7] != 9 {
+		t.Errorf("Keys() = %v; want 8 keys from 0 to 9", keys)
+	}
+
+	// Range visits a snapshot, so it may write to the storage
+	visited := 0
+	store.Range(ctx, func(k int, _ string) bool {
+		visited++
+		store.Delete(ctx, k)
+		store.Store(ctx, k+100, "moved")
+		return true
+	})
+	if visited != 8 || store.Len(ctx) != 8 {
+		t.Errorf("Range() visited %d entries leaving %d; want 8 and 8", visited, store.Len(ctx))
+	}
+	if v, ok := store.Load(ctx, 100); !ok || v != "moved" {
+		t.Errorf("Load(100) = %q, %v; want moved, true", v, ok)
+	}
+
+	seen := 0
+	for {
+		if _, _, ok := store.Next(ctx); !ok {
+			break
+		}
+		seen++
+	}
+	if seen != 8 || store.Len(ctx) != 0 {
+		t.Errorf("Next() returned %d entries leaving %d; want 8 and 0", seen, store.Len(ctx))
+	}
+
+	store.Store(ctx, 0, "zero")
+	store.Clear(ctx)
+	if n := store.Len(ctx); n != 0 {
+		t.Errorf("Len() after Clear() = %d; want 0", n)
+	}
+}
+
+func TestReadOptimizedStorageConcurrent(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapReadOptimizedStorage[int, int]()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				store.Store(ctx, g*1000+i, i)
+				// a writer always reads its own writes
+				if v, ok := store.Load(ctx, g*1000+i); !ok || v != i {
+					t.Errorf("Load() after Store() = %d, %v; want %d, true", v, ok, i)
+					return
+				}
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				store.Load(ctx, i)
+				store.Len(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := store.Len(ctx); n != 1600 {
+		t.Errorf("Len() = %d; want 1600", n)
+	}
+}
@@ -3,10 +3,13 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	// SQLite driver - requires the following dependency:
@@ -18,17 +21,35 @@ import (
 const (
 	// sqliteDirPermissions is the default permissions for creating SQLite database directories
 	sqliteDirPermissions = 0o755
+	// sqliteParallelRangeChunkSize is the number of keys read by a ParallelRange worker at once
+	sqliteParallelRangeChunkSize = 1024
+	// sqliteRangePageSize is the number of rows Range reads at once
+	sqliteRangePageSize = 1024
 )
 
-// mightyMapSQLiteStorage is the SQLite implementation of byteStorage interface
+// mightyMapSQLiteStorage is the SQLite implementation of byteStorage interface.
+// Concurrency is left to SQLite: readers run in parallel in WAL mode and writers wait for each
+// other through the busy timeout, see WithSQLiteBusyTimeout.
 type mightyMapSQLiteStorage[K comparable] struct {
 	db            *sql.DB
-	mutex         *sync.RWMutex
+	stmts         *sqliteStatements
 	cachingMutex  *sync.RWMutex
 	countCache    int
 	lastCount     time.Time
 	tableName     string
 	cacheDuration time.Duration
+	expire        time.Duration
+	sliding       bool
+	// lastPurge is the time of the last purge of expired rows in unix nanoseconds
+	lastPurge  atomic.Int64
+	inMemory   bool
+	jsonValues bool
+	ordering   Ordering
+	// stored wakes up NextWait in this process; pollInterval catches writes of other processes
+	stored       *storeNotifier
+	pollInterval time.Duration
+	// ownsDB is false for databases passed in with WithSQLiteDB, which Close leaves open
+	ownsDB bool
 }
 
 type sqliteOpts struct {
@@ -39,8 +60,18 @@ type sqliteOpts struct {
 	cacheCountDuration time.Duration
 	maxOpenConns       int
 	maxIdleConns       int
+	busyTimeout        time.Duration
 	journalMode        string
 	syncMode           string
+	expire             time.Duration
+	slidingExpiration  bool
+	jsonValues         bool
+	jsonIndexes        []string
+	exactCount         bool
+	autoVacuum         string
+	ordering           Ordering
+	pollInterval       time.Duration
+	db                 *sql.DB
 }
 
 // Default options
@@ -49,6 +80,7 @@ const (
 	defaultCacheCountDuration = 5 * time.Second
 	defaultMaxOpenConns       = 10
 	defaultMaxIdleConns       = 5
+	defaultBusyTimeout        = 5 * time.Second
 	defaultJournalMode        = "WAL"
 	defaultSyncMode           = "NORMAL"
 )
@@ -77,95 +109,255 @@ func NewMightyMapSQLiteStorage[K comparable, V any](optfuncs ...OptionFuncSQLite
 		optfunc(opts)
 	}
 
-	// Prepare connection string
-	var dsn string
-	if opts.inMemory {
-		dsn = ":memory:"
+	db := opts.db
+	ownsDB := db == nil
+	if ownsDB {
+		db = openSQLiteDB(opts)
 	} else {
-		// Ensure directory exists
-		if err := os.MkdirAll(filepath.Dir(opts.dbPath), sqliteDirPermissions); err != nil {
-			panic(fmt.Errorf("failed to create directory for SQLite database: %w", err))
-		}
-		dsn = opts.dbPath
+		opts.inMemory = false
 	}
-
-	// Add connection options
-	dsn = fmt.Sprintf("%s?_journal_mode=%s&_synchronous=%s", dsn, opts.journalMode, opts.syncMode)
-
-	// Open database connection
-	db, err := sql.Open("sqlite3", dsn)
-	if err != nil {
-		panic(fmt.Errorf("failed to open SQLite database: %w", err))
-	}
-
-	// Configure connection pool
-	db.SetMaxOpenConns(opts.maxOpenConns)
-	db.SetMaxIdleConns(opts.maxIdleConns)
-
-	// Verify connection
-	if err := db.Ping(); err != nil {
-		db.Close()
-		panic(fmt.Errorf("failed to connect to SQLite database: %w", err))
+	// a borrowed database is left open if initialization fails
+	closeOwned := func() {
+		if ownsDB {
+			db.Close()
+		}
 	}
 
 	// Apply PRAGMA settings
 	for pragma, value := range opts.pragmas {
 		if _, err := db.Exec(fmt.Sprintf("PRAGMA %s = %s", pragma, value)); err != nil {
-			db.Close()
+			closeOwned()
 			panic(fmt.Errorf("failed to set PRAGMA %s: %w", pragma, err))
 		}
 	}
 
 	// Create table if not exists
+	valueType := "BLOB"
+	if opts.jsonValues {
+		valueType = "TEXT"
+	}
+	// WITHOUT ROWID clusters the rows by key, so lookups by key need a single b-tree search;
+	// tables created by earlier versions keep their rowid, which works the same
 	createTableSQL := fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
 			key BLOB PRIMARY KEY,
-			value BLOB
-		)`, opts.tableName)
+			value %s,
+			expires_at INTEGER
+		) WITHOUT ROWID`, opts.tableName, valueType)
 
 	if _, err := db.Exec(createTableSQL); err != nil {
-		db.Close()
+		closeOwned()
 		panic(fmt.Errorf("failed to create table: %w", err))
 	}
 
-	// Create index on key for faster lookups
-	createIndexSQL := fmt.Sprintf(`
-		CREATE INDEX IF NOT EXISTS idx_%s_key ON %s(key)
+	// Tables created by earlier versions lack the expiration, due time and priority columns
+	for _, column := range []string{"expires_at", "visible_at", "priority", "priority_seq"} {
+		if err := addSQLiteColumnIfMissing(db, opts.tableName, column, "INTEGER"); err != nil {
+			closeOwned()
+			panic(fmt.Errorf("failed to migrate table: %w", err))
+		}
+	}
+
+	// Partial index so purging expired rows does not scan the table
+	createExpiresIndexSQL := fmt.Sprintf(`
+		CREATE INDEX IF NOT EXISTS idx_%s_expires_at ON %s(expires_at) WHERE expires_at IS NOT NULL
 	`, opts.tableName, opts.tableName)
 
-	if _, err := db.Exec(createIndexSQL); err != nil {
-		db.Close()
+	if _, err := db.Exec(createExpiresIndexSQL); err != nil {
+		closeOwned()
+		panic(fmt.Errorf("failed to create index: %w", err))
+	}
+
+	// Partial index so NextDue finds the earliest scheduled row with a single seek
+	createVisibleIndexSQL := fmt.Sprintf(`
+		CREATE INDEX IF NOT EXISTS idx_%s_visible_at ON %s(visible_at) WHERE visible_at IS NOT NULL
+	`, opts.tableName, opts.tableName)
+
+	if _, err := db.Exec(createVisibleIndexSQL); err != nil {
+		closeOwned()
 		panic(fmt.Errorf("failed to create index: %w", err))
 	}
 
+	// Partial index so Next finds the row with the highest priority with a single seek
+	createPriorityIndexSQL := fmt.Sprintf(`
+		CREATE INDEX IF NOT EXISTS idx_%s_priority ON %s(priority DESC, priority_seq) WHERE priority IS NOT NULL
+	`, opts.tableName, opts.tableName)
+
+	if _, err := db.Exec(createPriorityIndexSQL); err != nil {
+		closeOwned()
+		panic(fmt.Errorf("failed to create index: %w", err))
+	}
+
+	// Earlier versions created an index on key that duplicated the primary key index
+	dropIndexSQL := fmt.Sprintf("DROP INDEX IF EXISTS idx_%s_key", opts.tableName)
+	if _, err := db.Exec(dropIndexSQL); err != nil {
+		closeOwned()
+		panic(fmt.Errorf("failed to drop index: %w", err))
+	}
+
+	// Expression indexes on the JSON paths used by queries
+	for _, path := range opts.jsonIndexes {
+		if err := createSQLiteJSONIndex(db, opts.tableName, path); err != nil {
+			closeOwned()
+			panic(fmt.Errorf("failed to create index: %w", err))
+		}
+	}
+
+	// Insertion sequence numbers for FIFO ordering
+	if opts.ordering == FIFO {
+		if err := createSQLiteOrderColumn(db, opts.tableName); err != nil {
+			closeOwned()
+			panic(fmt.Errorf("failed to create order column: %w", err))
+		}
+	}
+
+	stmts, err := prepareSQLiteStatements(db, opts.tableName, opts.ordering)
+	if err != nil {
+		closeOwned()
+		panic(fmt.Errorf("failed to prepare statements: %w", err))
+	}
+
+	// Counter maintained by triggers, read by Len instead of COUNT(*)
+	if opts.exactCount {
+		if err := createSQLiteCountTriggers(db, opts.tableName); err != nil {
+			stmts.close()
+			closeOwned()
+			panic(fmt.Errorf("failed to create count triggers: %w", err))
+		}
+		if stmts.exactCount, err = prepareSQLiteExactCount(db, opts.tableName); err != nil {
+			stmts.close()
+			closeOwned()
+			panic(fmt.Errorf("failed to prepare statements: %w", err))
+		}
+	}
+
 	storage := &mightyMapSQLiteStorage[K]{
 		db:            db,
-		mutex:         &sync.RWMutex{},
+		stmts:         stmts,
 		cachingMutex:  &sync.RWMutex{},
 		countCache:    -1,
 		lastCount:     time.Time{},
 		tableName:     opts.tableName,
 		cacheDuration: opts.cacheCountDuration,
+		expire:        opts.expire,
+		sliding:       opts.slidingExpiration,
+		inMemory:      opts.inMemory,
+		jsonValues:    opts.jsonValues,
+		ordering:      opts.ordering,
+		stored:        newStoreNotifier(),
+		pollInterval:  opts.pollInterval,
+		ownsDB:        ownsDB,
 	}
+	storage.lastPurge.Store(time.Now().UnixNano())
 
+	if opts.jsonValues {
+		return newAdapterWithCodec[K, V](storage, jsonCodec[V]{})
+	}
 	return newMsgpackAdapter[K, V](storage)
 }
 
+// openSQLiteDB opens and configures the database described by opts.
+func openSQLiteDB(opts *sqliteOpts) *sql.DB {
+	// Prepare connection string
+	var dsn string
+	if opts.inMemory {
+		dsn = ":memory:"
+	} else {
+		// Ensure directory exists
+		if err := os.MkdirAll(filepath.Dir(opts.dbPath), sqliteDirPermissions); err != nil {
+			panic(fmt.Errorf("failed to create directory for SQLite database: %w", err))
+		}
+		dsn = opts.dbPath
+	}
+
+	// Add connection options; writers wait for each other for up to the busy timeout, and
+	// transactions take the write lock when they begin so they never fail upgrading to it
+	dsn = fmt.Sprintf("%s?_journal_mode=%s&_synchronous=%s&_busy_timeout=%d&_txlock=immediate",
+		dsn, opts.journalMode, opts.syncMode, opts.busyTimeout.Milliseconds())
+	if opts.autoVacuum != "" {
+		dsn += "&_auto_vacuum=" + opts.autoVacuum
+	}
+
+	// Open database connection
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		panic(fmt.Errorf("failed to open SQLite database: %w", err))
+	}
+
+	// Configure connection pool. Every connection to ":memory:" opens a separate database, so
+	// an in-memory database must live on a single connection that is never closed.
+	if opts.inMemory {
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+	} else {
+		db.SetMaxOpenConns(opts.maxOpenConns)
+		db.SetMaxIdleConns(opts.maxIdleConns)
+	}
+
+	// Verify connection
+	if err := db.Ping(); err != nil {
+		db.Close()
+		panic(fmt.Errorf("failed to connect to SQLite database: %w", err))
+	}
+	return db
+}
+
+// addSQLiteColumnIfMissing adds a column to an existing table unless it is already present.
+func addSQLiteColumnIfMissing(db *sql.DB, tableName, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", tableName))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", tableName, column, definition))
+	return err
+}
+
+// sqliteVisible is the condition selecting rows that have not expired and are not scheduled for
+// later, see StoreAt. It takes the current time in unix nanoseconds as its single argument; the
+// named parameter is bound by position like a plain placeholder, but can be used twice.
+const sqliteVisible = "((expires_at IS NULL OR expires_at > :now) AND (visible_at IS NULL OR visible_at <= :now))"
+
 // Load retrieves a value from the SQLite storage.
-func (s *mightyMapSQLiteStorage[K]) Load(_ context.Context, key K) (value []byte, ok bool) {
+func (s *mightyMapSQLiteStorage[K]) Load(ctx context.Context, key K) (value []byte, ok bool) {
 	// Marshal the key to a byte slice
 	keyBytes, err := msgpack.Marshal(key)
 	if err != nil {
 		return nil, false
 	}
 
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	var valueBytes []byte
+	now := time.Now()
+
+	if s.sliding && s.expire > 0 {
+		// Restart the expiration and read the value in a single statement
+		err = s.stmt(ctx, s.stmts.loadSliding).QueryRow(now.Add(s.expire).UnixNano(), keyBytes, now.UnixNano(), now.UnixNano()).Scan(&valueBytes)
+		if err == nil {
+			return valueBytes, true
+		}
+		if err != sql.ErrNoRows {
+			fmt.Printf("Error loading from SQLite: %v\n", err)
+			return nil, false
+		}
+		// the row is missing, expired or has no expiration; the query below tells them apart
+	}
 
 	// Query the database
-	var valueBytes []byte
-	query := fmt.Sprintf("SELECT value FROM %s WHERE key = ?", s.getTableName())
-	err = s.db.QueryRow(query, keyBytes).Scan(&valueBytes)
+	err = s.stmt(ctx, s.stmts.load).QueryRow(keyBytes, now.UnixNano()).Scan(&valueBytes)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, false
@@ -178,119 +370,266 @@ func (s *mightyMapSQLiteStorage[K]) Load(_ context.Context, key K) (value []byte
 	return valueBytes, true
 }
 
-// Store adds or updates a key-value pair in the SQLite storage.
-func (s *mightyMapSQLiteStorage[K]) Store(_ context.Context, key K, value []byte) {
+// Store adds or updates a key-value pair in the SQLite storage. An existing row keeps its priority.
+func (s *mightyMapSQLiteStorage[K]) Store(ctx context.Context, key K, value []byte) {
+	s.store(ctx, s.stmts.store, key, value, time.Time{})
+}
+
+// StoreWithPriority stores a row with a priority in the indexed priority column. Rows with equal
+// priority are returned by Next in the order of the priority_seq column, the time the priority
+// was set.
+func (s *mightyMapSQLiteStorage[K]) StoreWithPriority(ctx context.Context, key K, value []byte, priority int) error {
+	s.store(ctx, s.stmts.storePriority, key, value, time.Time{}, priority, time.Now().UnixNano())
+	return nil
+}
+
+// SetPriority changes the priority of a row, or gives it one, with a single UPDATE that leaves
+// the value alone. A row that already has a priority keeps its place among equal priorities.
+// Returns false if the key is not present.
+func (s *mightyMapSQLiteStorage[K]) SetPriority(ctx context.Context, key K, priority int) (bool, error) {
+	keyBytes, err := msgpack.Marshal(key)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UnixNano()
+	res, err := s.stmt(ctx, s.stmts.setPriority).Exec(priority, now, keyBytes, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// StoreAt stores a row that reads ignore until visibleAt, using the visible_at column. Its
+// expiration starts at visibleAt. NextWait in this process is woken up when the row is due.
+func (s *mightyMapSQLiteStorage[K]) StoreAt(ctx context.Context, key K, value []byte, visibleAt time.Time) error {
+	s.store(ctx, s.stmts.store, key, value, visibleAt)
+	if d := time.Until(visibleAt); d > 0 {
+		time.AfterFunc(d, s.stored.notify)
+	}
+	return nil
+}
+
+// store upserts a row with stmt, scheduled at visibleAt unless it is zero. The extra arguments
+// follow the due time.
+func (s *mightyMapSQLiteStorage[K]) store(ctx context.Context, stmt *sql.Stmt, key K, value []byte, visibleAt time.Time, extra ...any) {
 	// Marshal the key to a byte slice
 	keyBytes, err := msgpack.Marshal(key)
 	if err != nil {
 		return
 	}
 
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	var expiresAt, visibleAtArg any
+	start := time.Now()
+	if !visibleAt.IsZero() {
+		start = visibleAt
+		visibleAtArg = visibleAt.UnixNano()
+	}
+	if s.expire > 0 {
+		expiresAt = start.Add(s.expire).UnixNano()
+	}
+
+	args := append([]any{keyBytes, s.valueArg(value), expiresAt, visibleAtArg}, extra...)
+	if s.ordering == FIFO {
+		args = append(args, time.Now().UnixNano())
+	}
 
-	// Use INSERT OR REPLACE to handle both insert and update
-	query := fmt.Sprintf("INSERT OR REPLACE INTO %s (key, value) VALUES (?, ?)", s.getTableName())
-	_, err = s.db.Exec(query, keyBytes, value)
+	// UPSERT handles both insert and update without deleting the existing row
+	_, err = s.stmt(ctx, stmt).Exec(args...)
 	if err != nil {
 		// Log the error but don't return it to maintain interface compatibility
 		fmt.Printf("Error storing to SQLite: %v\n", err)
 	}
 
+	s.purgeExpired(ctx)
+
 	// Invalidate count cache
 	s.invalidateCountCache()
+	s.stored.notify()
 }
 
 // Delete removes one or more keys from the SQLite storage.
-func (s *mightyMapSQLiteStorage[K]) Delete(_ context.Context, keys ...K) {
+func (s *mightyMapSQLiteStorage[K]) Delete(ctx context.Context, keys ...K) {
 	if len(keys) == 0 {
 		return
 	}
 
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	tx, err := s.db.Begin()
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt := tx.StmtContext(ctx, s.stmts.delete)
+		for _, key := range keys {
+			keyBytes, err := msgpack.Marshal(key)
+			if err != nil {
+				continue
+			}
+
+			_, err = stmt.Exec(keyBytes)
+			if err != nil {
+				fmt.Printf("Error deleting key from SQLite: %v\n", err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		fmt.Printf("Error starting transaction for delete: %v\n", err)
-		return
+		fmt.Printf("Error in delete transaction: %v\n", err)
 	}
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
 
-	query := fmt.Sprintf("DELETE FROM %s WHERE key = ?", s.getTableName())
-	stmt, err := tx.Prepare(query)
-	if err != nil {
-		fmt.Printf("Error preparing delete statement: %v\n", err)
+	// Invalidate count cache
+	s.invalidateCountCache()
+}
+
+// Range iterates over all key-value pairs in the SQLite storage in key order, or in insertion
+// order with FIFO ordering.
+// Rows are read in pages of sqliteRangePageSize, and each page is read completely before f is
+// called for its rows, so no connection or read transaction is held while f runs and f may
+// itself use the storage. Rows written during the iteration may or may not be visited.
+func (s *mightyMapSQLiteStorage[K]) Range(ctx context.Context, f func(key K, value []byte) bool) {
+	if s.ordering == FIFO {
+		s.rangeOrdered(ctx, f)
 		return
 	}
-	defer stmt.Close()
 
-	for _, key := range keys {
-		keyBytes, err := msgpack.Marshal(key)
+	after := []byte{}
+	for {
+		page, err := s.readRows(s.stmt(ctx, s.stmts.rangePage), after, time.Now().UnixNano(), sqliteRangePageSize)
 		if err != nil {
-			continue
+			fmt.Printf("Error querying SQLite for range: %v\n", err)
+			return
 		}
 
-		_, err = stmt.Exec(keyBytes)
-		if err != nil {
-			fmt.Printf("Error deleting key from SQLite: %v\n", err)
+		for _, row := range page {
+			var key K
+			if err := msgpack.Unmarshal(row[0], &key); err != nil {
+				fmt.Printf("Error unmarshalling key in range: %v\n", err)
+				continue
+			}
+
+			if !f(key, row[1]) {
+				return
+			}
 		}
-	}
 
-	if err = tx.Commit(); err != nil {
-		fmt.Printf("Error committing delete transaction: %v\n", err)
+		if len(page) < sqliteRangePageSize {
+			return
+		}
+		after = page[len(page)-1][0]
 	}
-
-	// Invalidate count cache
-	s.invalidateCountCache()
 }
 
-// Range iterates over all key-value pairs in the SQLite storage.
-func (s *mightyMapSQLiteStorage[K]) Range(_ context.Context, f func(key K, value []byte) bool) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
-	query := fmt.Sprintf("SELECT key, value FROM %s", s.getTableName())
-	rows, err := s.db.Query(query)
+// readRows runs a query returning key and value columns and reads all rows.
+func (s *mightyMapSQLiteStorage[K]) readRows(stmt *sql.Stmt, args ...any) ([][2][]byte, error) {
+	rows, err := stmt.Query(args...)
 	if err != nil {
-		fmt.Printf("Error querying SQLite for range: %v\n", err)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
+	var result [][2][]byte
 	for rows.Next() {
 		var keyBytes, valueBytes []byte
 		if err := rows.Scan(&keyBytes, &valueBytes); err != nil {
-			fmt.Printf("Error scanning row in range: %v\n", err)
-			continue
+			return nil, err
 		}
+		result = append(result, [2][]byte{keyBytes, valueBytes})
+	}
+	return result, rows.Err()
+}
 
-		var key K
-		if err := msgpack.Unmarshal(keyBytes, &key); err != nil {
-			fmt.Printf("Error unmarshalling key in range: %v\n", err)
-			continue
+// chunkBounds returns every sqliteParallelRangeChunkSize-th key in key order, the boundaries of
+// the ParallelRange chunks. The rows are read completely, so a caller's transaction is free for
+// the chunks afterwards.
+func (s *mightyMapSQLiteStorage[K]) chunkBounds(ctx context.Context) ([][]byte, error) {
+	rows, err := s.stmt(ctx, s.stmts.chunkBounds).QueryContext(ctx, sqliteParallelRangeChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bounds [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, key)
+	}
+	return bounds, rows.Err()
+}
+
+// sqliteChunk is a range of keys read by one ParallelRange worker; a nil end is unbounded.
+type sqliteChunk struct {
+	start, end []byte
+}
+
+// ParallelRange splits the key space into key ranges of sqliteParallelRangeChunkSize keys which
+// are read by up to workers goroutines concurrently. The range boundaries are every
+// sqliteParallelRangeChunkSize-th key, found up front in a single pass over the primary key, so
+// this works for WITHOUT ROWID tables as well. Each range is read completely before f is called
+// for its rows, so no connection is held while f runs and f may itself use the storage.
+//
+// Every range is read at a different point in time: rows inserted or removed during the scan may
+// or may not be visited. Rows are visited in no particular order.
+func (s *mightyMapSQLiteStorage[K]) ParallelRange(ctx context.Context, workers int, f func(key K, value []byte) bool) error {
+	produce := func(ctx context.Context, emit func(sqliteChunk) bool) error {
+		bounds, err := s.chunkBounds(ctx)
+		if err != nil {
+			return err
+		}
+		start := []byte{}
+		for _, end := range bounds {
+			if !emit(sqliteChunk{start: start, end: end}) {
+				return ctx.Err()
+			}
+			start = end
+		}
+		// the remaining keys fit into the last chunk
+		if !emit(sqliteChunk{start: start}) {
+			return ctx.Err()
 		}
+		return nil
+	}
 
-		if !f(key, valueBytes) {
-			break
+	// a caller's transaction has a single connection, so its chunks are read one at a time;
+	// callbacks still run concurrently
+	_, inTx := SQLTxFromContext(ctx)
+	var readMu sync.Mutex
+	readChunk := func(ctx context.Context, chunk sqliteChunk) ([][2][]byte, error) {
+		if inTx {
+			readMu.Lock()
+			defer readMu.Unlock()
+		}
+		now := time.Now().UnixNano()
+		if chunk.end == nil {
+			return s.readRows(s.stmt(ctx, s.stmts.chunkTail), chunk.start, now)
 		}
+		return s.readRows(s.stmt(ctx, s.stmts.chunk), chunk.start, chunk.end, now)
 	}
 
-	if err := rows.Err(); err != nil {
-		fmt.Printf("Error iterating rows in range: %v\n", err)
+	consume := func(ctx context.Context, chunk sqliteChunk) (bool, error) {
+		rows, err := readChunk(ctx, chunk)
+		if err != nil {
+			return false, err
+		}
+		for _, row := range rows {
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			var key K
+			if err := msgpack.Unmarshal(row[0], &key); err != nil {
+				fmt.Printf("Error unmarshalling key in parallel range: %v\n", err)
+				continue
+			}
+			if !f(key, row[1]) {
+				return false, nil
+			}
+		}
+		return true, nil
 	}
-}
 
-func (s *mightyMapSQLiteStorage[K]) Keys(_ context.Context) []K {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	return parallelDispatch(ctx, workers, produce, consume)
+}
 
-	query := fmt.Sprintf("SELECT key FROM %s", s.getTableName())
-	rows, err := s.db.Query(query)
+func (s *mightyMapSQLiteStorage[K]) Keys(ctx context.Context) []K {
+	rows, err := s.stmt(ctx, s.stmts.keys).Query(time.Now().UnixNano())
 	if err != nil {
 		fmt.Printf("Error querying SQLite for keys: %v\n", err)
 		return []K{}
@@ -316,43 +655,74 @@ func (s *mightyMapSQLiteStorage[K]) Keys(_ context.Context) []K {
 	return keys
 }
 
-// Next retrieves and removes the next key-value pair from the SQLite storage.
+// Next retrieves and removes the next key-value pair from the SQLite storage: the row with the
+// highest priority if any row has one, otherwise the oldest one with FIFO ordering. The row is
+// selected and deleted by a single DELETE ... RETURNING statement, so concurrent callers never
+// receive the same entry.
 func (s *mightyMapSQLiteStorage[K]) Next(ctx context.Context) (key K, value []byte, ok bool) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	if key, value, ok = s.take(ctx, s.stmts.nextPriority, "next"); ok {
+		return key, value, ok
+	}
+	return s.take(ctx, s.stmts.next, "next")
+}
 
-	query := fmt.Sprintf("SELECT key, value FROM %s LIMIT 1", s.getTableName())
-	row := s.db.QueryRow(query)
+// NextDue removes and returns the scheduled row with the earliest due time, if it has passed,
+// in a single DELETE ... RETURNING statement using the index on visible_at.
+func (s *mightyMapSQLiteStorage[K]) NextDue(ctx context.Context) (key K, value []byte, ok bool) {
+	return s.take(ctx, s.stmts.nextDue, "next due")
+}
 
+// take runs one of the DELETE ... RETURNING statements of Next and NextDue; op names the caller
+// in error messages.
+func (s *mightyMapSQLiteStorage[K]) take(ctx context.Context, stmt *sql.Stmt, op string) (key K, value []byte, ok bool) {
 	var keyBytes []byte
-	err := row.Scan(&keyBytes, &value)
+	err := s.stmt(ctx, stmt).QueryRow(time.Now().UnixNano()).Scan(&keyBytes, &value)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			fmt.Printf("Error fetching next item: %v\n", err)
+			fmt.Printf("Error fetching %s item: %v\n", op, err)
 		}
 		return key, nil, false
 	}
 
+	// Invalidate count cache
+	s.invalidateCountCache()
+
 	if err := msgpack.Unmarshal(keyBytes, &key); err != nil {
-		fmt.Printf("Error unmarshalling key in next: %v\n", err)
+		fmt.Printf("Error unmarshalling key in %s: %v\n", op, err)
 		return key, nil, false
 	}
 
-	// Delete the retrieved key
-	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE key = ?", s.getTableName())
-	_, err = s.db.Exec(deleteQuery, keyBytes)
-	if err != nil {
-		fmt.Printf("Error deleting next item: %v\n", err)
-	}
-
-	// Invalidate count cache
-	s.invalidateCountCache()
-
 	return key, value, true
 }
 
-// Len returns the number of items in the SQLite storage.
-func (s *mightyMapSQLiteStorage[K]) Len(_ context.Context) int {
+// NextWait removes and returns an entry like Next, waiting until one is stored while the table is
+// empty. Stores through this storage wake it up at once; rows written by other connections or
+// processes are noticed within WithSQLiteNextWaitPollInterval. Every row is deleted by a single
+// statement, so concurrent callers each receive a different entry.
+// Returns the context error if ctx is cancelled first.
+func (s *mightyMapSQLiteStorage[K]) NextWait(ctx context.Context) (key K, value []byte, err error) {
+	return waitNext(ctx, s.stored, s.pollInterval, s.Next)
+}
+
+// Len returns the number of items in the SQLite storage. With WithSQLiteExactCount it reads
+// the trigger-maintained counter, which is always exact; otherwise COUNT(*) is cached for
+// WithSQLiteCountCacheDuration.
+func (s *mightyMapSQLiteStorage[K]) Len(ctx context.Context) int {
+	if s.stmts.exactCount != nil {
+		var count int
+		err := s.stmt(ctx, s.stmts.exactCount).QueryRow(time.Now().UnixNano()).Scan(&count)
+		if err != nil {
+			fmt.Printf("Error counting items: %v\n", err)
+			return 0
+		}
+		return count
+	}
+
+	// the cache holds committed state; within a transaction its own writes must be counted
+	if _, ok := SQLTxFromContext(ctx); ok {
+		return s.count(ctx)
+	}
+
 	s.cachingMutex.RLock()
 	if !s.lastCount.IsZero() && time.Since(s.lastCount) < s.getCacheCountDuration() {
 		count := s.countCache
@@ -369,31 +739,52 @@ func (s *mightyMapSQLiteStorage[K]) Len(_ context.Context) int {
 		return s.countCache
 	}
 
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	count := s.count(ctx)
 
+	// Update cache
+	s.countCache = count
+	s.lastCount = time.Now()
+
+	return count
+}
+
+// count counts the entries that have not expired.
+func (s *mightyMapSQLiteStorage[K]) count(ctx context.Context) int {
 	var count int
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", s.getTableName())
-	err := s.db.QueryRow(query).Scan(&count)
+	err := s.stmt(ctx, s.stmts.count).QueryRow(time.Now().UnixNano()).Scan(&count)
 	if err != nil {
 		fmt.Printf("Error counting items: %v\n", err)
 		return 0
 	}
+	return count
+}
 
-	// Update cache
-	s.countCache = count
-	s.lastCount = time.Now()
+// Touch restarts the expiration of the given keys without reading their values.
+// Missing, expired and non-expiring keys are ignored. Without WithSQLiteExpire this is a no-op.
+func (s *mightyMapSQLiteStorage[K]) Touch(ctx context.Context, keys ...K) error {
+	if s.expire <= 0 || len(keys) == 0 {
+		return nil
+	}
 
-	return count
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt := tx.StmtContext(ctx, s.stmts.touch)
+		now := time.Now()
+		for _, key := range keys {
+			keyBytes, err := msgpack.Marshal(key)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.Exec(now.Add(s.expire).UnixNano(), keyBytes, now.UnixNano()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // Clear removes all items from the SQLite storage.
-func (s *mightyMapSQLiteStorage[K]) Clear(_ context.Context) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	query := fmt.Sprintf("DELETE FROM %s", s.getTableName())
-	_, err := s.db.Exec(query)
+func (s *mightyMapSQLiteStorage[K]) Clear(ctx context.Context) {
+	_, err := s.stmt(ctx, s.stmts.clear).Exec()
 	if err != nil {
 		fmt.Printf("Error clearing SQLite storage: %v\n", err)
 	}
@@ -402,15 +793,14 @@ func (s *mightyMapSQLiteStorage[K]) Clear(_ context.Context) {
 	s.invalidateCountCache()
 }
 
-// Close closes the SQLite database connection.
+// Close closes the prepared statements and the SQLite database connection, unless the
+// database was passed in with WithSQLiteDB.
 func (s *mightyMapSQLiteStorage[K]) Close(_ context.Context) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	if s.db != nil {
-		return s.db.Close()
+	err := s.stmts.close()
+	if s.db != nil && s.ownsDB {
+		return errors.Join(err, s.db.Close())
 	}
-	return nil
+	return err
 }
 
 // Helper methods
@@ -423,6 +813,33 @@ func (s *mightyMapSQLiteStorage[K]) getCacheCountDuration() time.Duration {
 	return s.cacheDuration
 }
 
+// valueArg returns the value as bound to statements. JSON documents are bound as TEXT, since
+// SQLite's JSON functions do not read text stored as a BLOB.
+func (s *mightyMapSQLiteStorage[K]) valueArg(value []byte) any {
+	if s.jsonValues {
+		return string(value)
+	}
+	return value
+}
+
+// purgeExpired deletes expired rows, at most once per expiration period so the amortized
+// cost per write stays constant. Concurrent writers race for the purge with a compare-and-swap
+// so only one of them runs it.
+func (s *mightyMapSQLiteStorage[K]) purgeExpired(ctx context.Context) {
+	if s.expire <= 0 {
+		return
+	}
+	now := time.Now()
+	last := s.lastPurge.Load()
+	if now.Sub(time.Unix(0, last)) < s.expire || !s.lastPurge.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	if _, err := s.stmt(ctx, s.stmts.purge).Exec(now.UnixNano()); err != nil {
+		fmt.Printf("Error purging expired items: %v\n", err)
+	}
+}
+
 func (s *mightyMapSQLiteStorage[K]) invalidateCountCache() {
 	s.cachingMutex.Lock()
 	defer s.cachingMutex.Unlock()
@@ -441,6 +858,16 @@ func WithSQLiteDBPath(path string) OptionFuncSQLite {
 	}
 }
 
+// WithSQLiteDB makes the storage use an existing database, e.g. one that also holds the
+// application's own tables, instead of opening one. The options configuring the connection
+// (path, in-memory, journal and sync mode, pool sizes) are ignored, and Close leaves db open.
+// Combine it with ContextWithSQLTx to write to the map within the application's transactions.
+func WithSQLiteDB(db *sql.DB) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.db = db
+	}
+}
+
 // WithSQLiteInMemory specifies that an in-memory database should be used.
 // This is faster but data will be lost when the application exits.
 func WithSQLiteInMemory() OptionFuncSQLite {
@@ -472,6 +899,48 @@ func WithSQLiteSyncMode(mode string) OptionFuncSQLite {
 	}
 }
 
+// WithSQLiteExpire sets the duration after which entries expire.
+// The expiration is stored in an indexed expires_at column; expired rows are invisible
+// to all operations and are purged periodically by writes.
+// **Default value**: `0` (entries never expire)
+func WithSQLiteExpire(expire time.Duration) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.expire = expire
+	}
+}
+
+// WithSQLiteSlidingExpiration makes Load update the expires_at column of the entry it reads,
+// so entries expire after their last access instead of their last write.
+// Only effective together with WithSQLiteExpire.
+// **Default value**: `false`
+func WithSQLiteSlidingExpiration(sliding bool) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.slidingExpiration = sliding
+	}
+}
+
+// WithSQLiteJSONValues stores values as JSON text instead of MessagePack, so they can be filtered
+// with SQLite's JSON functions in Query and indexed with WithSQLiteJSONIndex. Values are encoded
+// with encoding/json and must round-trip through it.
+// The format of an existing table can not be switched; rows in the other format are skipped.
+// **Default value**: `false`
+func WithSQLiteJSONValues(jsonValues bool) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.jsonValues = jsonValues
+	}
+}
+
+// WithSQLiteJSONIndex creates an index on a JSON path of the values, e.g. `$.status`, so queries
+// filtering on SQLiteJSONPath(path) don't scan the table. Can be given several times.
+// Only effective together with WithSQLiteJSONValues.
+// Panics if path is not a simple JSON path of object members and array indexes.
+func WithSQLiteJSONIndex(path string) OptionFuncSQLite {
+	mustValidSQLiteJSONPath(path)
+	return func(o *sqliteOpts) {
+		o.jsonIndexes = append(o.jsonIndexes, path)
+	}
+}
+
 // WithSQLiteCountCacheDuration sets the duration for which the count result is cached.
 func WithSQLiteCountCacheDuration(duration time.Duration) OptionFuncSQLite {
 	return func(o *sqliteOpts) {
@@ -479,7 +948,49 @@ func WithSQLiteCountCacheDuration(duration time.Duration) OptionFuncSQLite {
 	}
 }
 
+// WithSQLiteExactCount makes Len read a counter that triggers on the table keep up to date,
+// instead of caching COUNT(*). Len is then exact and cheap, also when other processes write to
+// the same database file. The triggers are stored in the database and stay in place when the
+// storage is later opened without this option, so every writer keeps the counter exact.
+func WithSQLiteExactCount(exact bool) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.exactCount = exact
+	}
+}
+
+// WithSQLiteAutoVacuum sets the auto_vacuum mode of the database: "NONE", "FULL" or
+// "INCREMENTAL". With INCREMENTAL, Vacuum releases free pages without rebuilding the file.
+// The mode of an existing database only changes with the next Vacuum, which then rebuilds it
+// once. Ignored together with WithSQLiteDB.
+// **Default value**: `NONE`
+func WithSQLiteAutoVacuum(mode string) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.autoVacuum = strings.ToLower(mode)
+	}
+}
+
+// WithSQLiteOrdering sets the order of Next, Range and Keys. FIFO adds a seq column numbering
+// the rows in insertion order, an index on it and a trigger that assigns the numbers, so rows
+// inserted by other connections or processes are numbered as well. Rows of an existing table
+// are numbered in key order when the option is first used.
+// **Default value**: `Unordered`
+func WithSQLiteOrdering(ordering Ordering) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.ordering = ordering
+	}
+}
+
+// WithSQLiteNextWaitPollInterval sets how often NextWait looks for rows written by other
+// connections or processes while it waits. Stores through the same storage wake it up at once.
+// **Default value**: `1s`
+func WithSQLiteNextWaitPollInterval(interval time.Duration) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.pollInterval = interval
+	}
+}
+
 // WithSQLiteMaxOpenConns sets the maximum number of open connections to the database.
+// In-memory databases always use a single connection.
 func WithSQLiteMaxOpenConns(count int) OptionFuncSQLite {
 	return func(o *sqliteOpts) {
 		o.maxOpenConns = count
@@ -493,6 +1004,15 @@ func WithSQLiteMaxIdleConns(count int) OptionFuncSQLite {
 	}
 }
 
+// WithSQLiteBusyTimeout sets how long a write waits for the write lock held by another
+// connection before failing with SQLITE_BUSY.
+// **Default value**: `5s`
+func WithSQLiteBusyTimeout(timeout time.Duration) OptionFuncSQLite {
+	return func(o *sqliteOpts) {
+		o.busyTimeout = timeout
+	}
+}
+
 // WithSQLitePragma sets a custom PRAGMA option for the SQLite database.
 func WithSQLitePragma(pragma, value string) OptionFuncSQLite {
 	return func(o *sqliteOpts) {
@@ -510,8 +1030,18 @@ func getDefaultSQLiteOptions() *sqliteOpts {
 		cacheCountDuration: defaultCacheCountDuration,
 		maxOpenConns:       defaultMaxOpenConns,
 		maxIdleConns:       defaultMaxIdleConns,
+		busyTimeout:        defaultBusyTimeout,
 		journalMode:        defaultJournalMode,
 		syncMode:           defaultSyncMode,
+		expire:             0,
+		slidingExpiration:  false,
+		jsonValues:         false,
+		jsonIndexes:        nil,
+		exactCount:         false,
+		autoVacuum:         "",
+		ordering:           Unordered,
+		pollInterval:       defaultNextWaitPollInterval,
+		db:                 nil,
 	}
 }
 
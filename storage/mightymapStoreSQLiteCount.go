@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// sqliteMetaTable holds the number of rows of every table using WithSQLiteExactCount.
+const sqliteMetaTable = "mightymap_meta"
+
+// createSQLiteCountTriggers creates the counter row of tableName and the triggers keeping it up
+// to date. The triggers are part of the schema, so the counter stays exact whichever connection
+// or process writes to the table. An UPSERT that updates an existing key fires neither trigger.
+//
+// The counter is initialized with a full count in the same transaction that creates the
+// triggers, so writes from other connections can not slip in between.
+func createSQLiteCountTriggers(db *sql.DB, tableName string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			table_name TEXT PRIMARY KEY,
+			count INTEGER NOT NULL
+		) WITHOUT ROWID`, sqliteMetaTable),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[2]s_count_insert AFTER INSERT ON %[2]s BEGIN
+			UPDATE %[1]s SET count = count + 1 WHERE table_name = '%[2]s';
+		END`, sqliteMetaTable, tableName),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[2]s_count_delete AFTER DELETE ON %[2]s BEGIN
+			UPDATE %[1]s SET count = count - 1 WHERE table_name = '%[2]s';
+		END`, sqliteMetaTable, tableName),
+		fmt.Sprintf(`INSERT OR IGNORE INTO %[1]s (table_name, count) SELECT '%[2]s', COUNT(*) FROM %[2]s`,
+			sqliteMetaTable, tableName),
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// prepareSQLiteExactCount prepares the statement reading the counter of tableName. Expired rows
+// are still counted by the triggers until they are purged, and rows scheduled for later are
+// counted from the start, so both are subtracted using the indexes on expires_at and visible_at;
+// everything is read in the same statement and thus from the same snapshot.
+func prepareSQLiteExactCount(db *sql.DB, tableName string) (*sql.Stmt, error) {
+	return db.Prepare(fmt.Sprintf(`SELECT
+		(SELECT count FROM %[1]s WHERE table_name = '%[2]s') -
+		(SELECT COUNT(*) FROM %[2]s WHERE expires_at <= :now OR visible_at > :now)`, sqliteMetaTable, tableName))
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMightyMapSQLiteStorageExactCount(t *testing.T) {
+	ctx := context.Background()
+	dbPath := t.TempDir() + "/count.db"
+
+	// rows written before the counter exists are counted when it is created
+	plain := NewMightyMapSQLiteStorage[int, string](WithSQLiteDBPath(dbPath))
+	for i := 0; i < 10; i++ {
+		plain.Store(ctx, i, "value")
+	}
+	plain.Close(ctx)
+
+	store := NewMightyMapSQLiteStorage[int, string](WithSQLiteDBPath(dbPath), WithSQLiteExactCount(true))
+	defer store.Close(ctx)
+	if n := store.Len(ctx); n != 10 {
+		t.Fatalf("Len() = %d; want 10", n)
+	}
+
+	t.Run("Store and overwrite", func(t *testing.T) {
+		store.Store(ctx, 10, "value")
+		store.Store(ctx, 10, "overwritten")
+		if n := store.Len(ctx); n != 11 {
+			t.Errorf("Len() = %d; want 11", n)
+		}
+	})
+
+	t.Run("Delete and Next", func(t *testing.T) {
+		store.Delete(ctx, 0, 1, 1000)
+		if _, _, ok := store.Next(ctx); !ok {
+			t.Fatal("Next() = false; want true")
+		}
+		if n := store.Len(ctx); n != 8 {
+			t.Errorf("Len() = %d; want 8", n)
+		}
+	})
+
+	t.Run("Other connection", func(t *testing.T) {
+		// a second storage on the same file stands in for another process; its writes are
+		// counted although it does not use the option
+		other := NewMightyMapSQLiteStorage[int, string](WithSQLiteDBPath(dbPath))
+		defer other.Close(ctx)
+		other.Store(ctx, 100, "value")
+		other.Store(ctx, 101, "value")
+		if n := store.Len(ctx); n != 10 {
+			t.Errorf("Len() = %d; want 10", n)
+		}
+	})
+
+	t.Run("Rolled back transaction", func(t *testing.T) {
+		db := store.(*msgpackAdapter[int, string]).storage.(*mightyMapSQLiteStorage[int]).db
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		txCtx := ContextWithSQLTx(ctx, tx)
+		store.Store(txCtx, 200, "value")
+		if n := store.Len(txCtx); n != 11 {
+			t.Errorf("Len() in transaction = %d; want 11", n)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if n := store.Len(ctx); n != 10 {
+			t.Errorf("Len() after rollback = %d; want 10", n)
+		}
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		store.Clear(ctx)
+		if n := store.Len(ctx); n != 0 {
+			t.Errorf("Len() = %d; want 0", n)
+		}
+	})
+}
+
+func TestMightyMapSQLiteStorageExactCountExpiration(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapSQLiteStorage[int, string](
+		WithSQLiteDBPath(t.TempDir()+"/count.db"),
+		WithSQLiteExactCount(true),
+		WithSQLiteExpire(100*time.Millisecond),
+	)
+	defer store.Close(ctx)
+
+	store.Store(ctx, 1, "value")
+	store.Store(ctx, 2, "value")
+	if n := store.Len(ctx); n != 2 {
+		t.Fatalf("Len() = %d; want 2", n)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	store.Store(ctx, 3, "value")
+	if n := store.Len(ctx); n != 1 {
+		t.Errorf("Len() = %d; want 1 after expiration", n)
+	}
+}
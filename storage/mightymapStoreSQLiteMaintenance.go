@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// sqliteBackupRetryInterval is the time BackupFile waits before retrying a step that found
+// the source database locked.
+const sqliteBackupRetryInterval = 10 * time.Millisecond
+
+// BackupFile copies the database to destPath with SQLite's online backup API. The copy is made
+// from a single read transaction, so it is consistent, and in WAL mode writers are not blocked
+// while it runs. An existing file at destPath is replaced. The storage must use the
+// github.com/mattn/go-sqlite3 driver, which is always the case unless WithSQLiteDB is used.
+func (s *mightyMapSQLiteStorage[K]) BackupFile(ctx context.Context, destPath string) error {
+	// the backup overwrites the pages of the destination; a stale log would be replayed on top
+	for _, path := range []string{destPath, destPath + "-wal", destPath + "-shm"} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	destDB, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			dest, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			src, srcOK := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok || !srcOK {
+				return fmt.Errorf("online backup requires the sqlite3 driver: %w", ErrNotSupported)
+			}
+
+			backup, err := dest.Backup("main", src, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				if err := ctx.Err(); err != nil {
+					backup.Close()
+					return err
+				}
+				// copying all pages in one step keeps the copy consistent even while the
+				// database is written to; a step that finds the source locked copies nothing
+				done, err := backup.Step(-1)
+				if err != nil {
+					backup.Close()
+					return err
+				}
+				if done {
+					return backup.Finish()
+				}
+				time.Sleep(sqliteBackupRetryInterval)
+			}
+		})
+	})
+}
+
+// Vacuum reclaims the space of deleted rows. With auto_vacuum set to INCREMENTAL, see
+// WithSQLiteAutoVacuum, it runs an incremental vacuum that only releases free pages. Otherwise
+// it runs VACUUM, which rebuilds the database file, needs as much free disk space as the file
+// itself and blocks writers until it is done; it also applies a changed auto_vacuum mode.
+func (s *mightyMapSQLiteStorage[K]) Vacuum(ctx context.Context) error {
+	var autoVacuum int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		return err
+	}
+
+	query := "VACUUM"
+	// 2 is INCREMENTAL
+	if autoVacuum == 2 {
+		query = "PRAGMA incremental_vacuum"
+	}
+	_, err := s.db.ExecContext(ctx, query)
+	return err
+}
+
+// Compact is the same as Vacuum.
+func (s *mightyMapSQLiteStorage[K]) Compact(ctx context.Context) error {
+	return s.Vacuum(ctx)
+}
+
+// Checkpoint copies the write-ahead log into the database file with the wal_checkpoint pragma.
+// Returns ErrCheckpointBusy if the checkpoint could not complete because of concurrent readers
+// or writers. Databases not in WAL mode have nothing to checkpoint.
+func (s *mightyMapSQLiteStorage[K]) Checkpoint(ctx context.Context, mode CheckpointMode) error {
+	switch mode {
+	case CheckpointPassive, CheckpointFull, CheckpointRestart, CheckpointTruncate:
+	default:
+		return fmt.Errorf("invalid checkpoint mode %q", mode)
+	}
+
+	var busy, logFrames, checkpointed int
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf("PRAGMA wal_checkpoint(%s)", mode)).Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		return err
+	}
+	if busy != 0 {
+		return ErrCheckpointBusy
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMightyMapSQLiteStorageMaintenance(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewMightyMapSQLiteStorage[int, string](
+		WithSQLiteDBPath(filepath.Join(dir, "source.db")),
+		WithSQLiteJournalMode("WAL"),
+		WithSQLiteAutoVacuum("INCREMENTAL"),
+	)
+	defer store.Close(ctx)
+	maintainer := store.(IMightyMapMaintenanceStorage)
+
+	for i := 0; i < 100; i++ {
+		store.Store(ctx, i, "value")
+	}
+
+	t.Run("BackupFile", func(t *testing.T) {
+		destPath := filepath.Join(dir, "backup.db")
+		// an existing file is replaced
+		if err := os.WriteFile(destPath, []byte("stale"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := maintainer.BackupFile(ctx, destPath); err != nil {
+			t.Fatalf("BackupFile() error: %v", err)
+		}
+		store.Store(ctx, 1000, "after backup")
+
+		backup := NewMightyMapSQLiteStorage[int, string](WithSQLiteDBPath(destPath))
+		defer backup.Close(ctx)
+		if n := backup.Len(ctx); n != 100 {
+			t.Errorf("Len() of backup = %d; want 100", n)
+		}
+		if value, ok := backup.Load(ctx, 42); !ok || value != "value" {
+			t.Errorf("Load(42) from backup = %q, %v; want \"value\", true", value, ok)
+		}
+	})
+
+	t.Run("BackupFile cancelled", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := maintainer.BackupFile(cancelled, filepath.Join(dir, "cancelled.db")); err == nil {
+			t.Error("BackupFile() with cancelled context succeeded; want error")
+		}
+	})
+
+	t.Run("Vacuum", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			store.Delete(ctx, i)
+		}
+		if err := maintainer.Vacuum(ctx); err != nil {
+			t.Fatalf("Vacuum() error: %v", err)
+		}
+		if n := store.Len(ctx); n != 51 {
+			t.Errorf("Len() after Vacuum = %d; want 51", n)
+		}
+	})
+
+	t.Run("Checkpoint", func(t *testing.T) {
+		if err := maintainer.Checkpoint(ctx, CheckpointTruncate); err != nil {
+			t.Fatalf("Checkpoint() error: %v", err)
+		}
+		info, err := os.Stat(filepath.Join(dir, "source.db-wal"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 0 {
+			t.Errorf("WAL size after truncating checkpoint = %d; want 0", info.Size())
+		}
+		if err := maintainer.Checkpoint(ctx, "BOGUS"); err == nil {
+			t.Error("Checkpoint() with invalid mode succeeded; want error")
+		}
+	})
+}
+
+func TestMightyMapBadgerStorageMaintenance(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(true))
+	defer store.Close(ctx)
+	maintainer := store.(IMightyMapMaintenanceStorage)
+
+	store.Store(ctx, "a", 1)
+	store.Store(ctx, "b", 2)
+
+	destPath := filepath.Join(t.TempDir(), "backup.bak")
+	if err := maintainer.BackupFile(ctx, destPath); err != nil {
+		t.Fatalf("BackupFile() error: %v", err)
+	}
+	f, err := os.Open(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	restored := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(true))
+	defer restored.Close(ctx)
+	if err := restored.(IMightyMapBackupStorage).Restore(ctx, f); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if n := restored.Len(ctx); n != 2 {
+		t.Errorf("Len() after Restore = %d; want 2", n)
+	}
+	if err := maintainer.Checkpoint(ctx, CheckpointPassive); err != nil {
+		t.Errorf("Checkpoint() error: %v", err)
+	}
+}
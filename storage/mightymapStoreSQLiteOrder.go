@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// sqliteNextSeq is the expression assigning the next insertion sequence number of a table.
+// The seq index makes MAX a single seek, and writers are serialized by SQLite's write lock.
+const sqliteNextSeq = "(SELECT COALESCE(MAX(seq), 0) + 1 FROM %[1]s)"
+
+// createSQLiteOrderColumn adds the seq column used by FIFO ordering, its index and the trigger
+// numbering new rows. Like the count triggers, the trigger is part of the schema, so rows are
+// numbered whichever connection or process inserts them. Rows written before the column existed
+// are numbered in key order, after the rows that already have a number.
+func createSQLiteOrderColumn(db *sql.DB, tableName string) error {
+	if err := addSQLiteColumnIfMissing(db, tableName, "seq", "INTEGER"); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"CREATE INDEX IF NOT EXISTS idx_%[1]s_seq ON %[1]s(seq)",
+		`CREATE TRIGGER IF NOT EXISTS %[1]s_seq_insert AFTER INSERT ON %[1]s WHEN NEW.seq IS NULL BEGIN
+			UPDATE %[1]s SET seq = ` + sqliteNextSeq + ` WHERE key = NEW.key;
+		END`,
+		`UPDATE %[1]s SET seq = base.seq + numbered.n
+		FROM (SELECT key, row_number() OVER (ORDER BY key) AS n FROM %[1]s WHERE seq IS NULL) AS numbered,
+			(SELECT COALESCE(MAX(seq), 0) AS seq FROM %[1]s) AS base
+		WHERE %[1]s.key = numbered.key`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(fmt.Sprintf(statement, tableName)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// rangeOrdered is Range for FIFO ordering. It pages through the rows by their sequence number
+// instead of their key, with the same guarantees as Range.
+func (s *mightyMapSQLiteStorage[K]) rangeOrdered(ctx context.Context, f func(key K, value []byte) bool) {
+	var after int64
+	for {
+		rows, err := s.stmt(ctx, s.stmts.rangeSeqPage).Query(after, time.Now().UnixNano(), sqliteRangePageSize)
+		if err != nil {
+			fmt.Printf("Error querying SQLite for range: %v\n", err)
+			return
+		}
+
+		type row struct {
+			key, value []byte
+		}
+		var page []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.key, &r.value, &after); err != nil {
+				fmt.Printf("Error scanning row in range: %v\n", err)
+				rows.Close()
+				return
+			}
+			page = append(page, r)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			fmt.Printf("Error querying SQLite for range: %v\n", err)
+			return
+		}
+
+		for _, r := range page {
+			var key K
+			if err := msgpack.Unmarshal(r.key, &key); err != nil {
+				fmt.Printf("Error unmarshalling key in range: %v\n", err)
+				continue
+			}
+			if !f(key, r.value) {
+				return
+			}
+		}
+
+		if len(page) < sqliteRangePageSize {
+			return
+		}
+	}
+}
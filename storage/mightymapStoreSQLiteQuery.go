@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// sqliteJSONPathPattern accepts JSON paths made of object members and array indexes, e.g.
+// `$.address.city` or `$.tags[0]`. Paths are embedded into SQL, so nothing else is allowed.
+var sqliteJSONPathPattern = regexp.MustCompile(`^\$(\.[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+\])*$`)
+
+// SQLiteJSONPath returns the SQL expression extracting path from the JSON value of an entry,
+// for use in the where clause of Query:
+//
+//	where := storage.SQLiteJSONPath("$.status") + " = ?"
+//	users, err := m.Query(ctx, where, "active")
+//
+// The expression is the same as the one indexed by WithSQLiteJSONIndex, which SQLite requires
+// to use the index. Panics if path is not a simple JSON path of object members and array indexes.
+func SQLiteJSONPath(path string) string {
+	mustValidSQLiteJSONPath(path)
+	return fmt.Sprintf("json_extract(value, '%s')", path)
+}
+
+func mustValidSQLiteJSONPath(path string) {
+	if !sqliteJSONPathPattern.MatchString(path) {
+		panic(fmt.Sprintf("invalid JSON path %q: only object members and array indexes are supported", path))
+	}
+}
+
+// createSQLiteJSONIndex creates an expression index on path, named after the table and the path.
+func createSQLiteJSONIndex(db *sql.DB, tableName, path string) error {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.TrimPrefix(path, "$"))
+
+	query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_json%s ON %s(%s)", tableName, name, tableName, SQLiteJSONPath(path))
+	_, err := db.Exec(query)
+	return err
+}
+
+// Query returns the entries matching where, an SQL condition with `?` placeholders for args.
+// The condition is inserted into the statement as is, so it must not be built from untrusted
+// input; pass such values as args. Together with WithSQLiteJSONValues the values can be
+// filtered with SQLite's JSON functions, see SQLiteJSONPath. Expired entries are excluded and,
+// as for Range, reading does not restart their expiration.
+func (s *mightyMapSQLiteStorage[K]) Query(ctx context.Context, where string, args ...any) ([]Entry[K, []byte], error) {
+	query := fmt.Sprintf("SELECT key, value FROM %s WHERE (%s) AND %s", s.getTableName(), where, sqliteVisible)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, append(args, time.Now().UnixNano())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry[K, []byte]
+	for rows.Next() {
+		var keyBytes, valueBytes []byte
+		if err := rows.Scan(&keyBytes, &valueBytes); err != nil {
+			return nil, err
+		}
+		var key K
+		if err := msgpack.Unmarshal(keyBytes, &key); err != nil {
+			fmt.Printf("Error unmarshalling key in query: %v\n", err)
+			continue
+		}
+		entries = append(entries, Entry[K, []byte]{Key: key, Value: valueBytes})
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type queryTestUser struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Age    int    `json:"age"`
+}
+
+func TestSQLiteQueryJSONValues(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapSQLiteStorage[string, queryTestUser](
+		WithSQLiteDBPath(filepath.Join(t.TempDir(), "users.db")),
+		WithSQLiteJSONValues(true),
+		WithSQLiteJSONIndex("$.status"),
+	)
+	defer store.Close(ctx)
+
+	users := map[string]queryTestUser{
+		"u1": {Name: "Ann", Status: "active", Age: 31},
+		"u2": {Name: "Bob", Status: "inactive", Age: 45},
+		"u3": {Name: "Cid", Status: "active", Age: 27},
+	}
+	for k, u := range users {
+		store.Store(ctx, k, u)
+	}
+	if u, ok := store.Load(ctx, "u2"); !ok || u != users["u2"] {
+		t.Errorf("Load() = %+v, %v; want %+v", u, ok, users["u2"])
+	}
+
+	querier := store.(IMightyMapQueryStorage[string, queryTestUser])
+	entries, err := querier.Query(ctx, SQLiteJSONPath("$.status")+" = ?", "active")
+	if err != nil {
+		t.Fatalf("Query() error: %v", err)
+	}
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+		if e.Value != users[e.Key] {
+			t.Errorf("Query() value of %s = %+v; want %+v", e.Key, e.Value, users[e.Key])
+		}
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "u1,u3" {
+		t.Errorf("Query() keys = %v; want u1 and u3", keys)
+	}
+
+	entries, err = querier.Query(ctx, SQLiteJSONPath("$.status")+" = ? AND "+SQLiteJSONPath("$.age")+" > ?", "active", 30)
+	if err != nil {
+		t.Fatalf("Query() error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Key != "u1" {
+		t.Errorf("Query() with two conditions = %+v; want u1", entries)
+	}
+
+	// the status filter is answered from the index
+	raw := store.(*msgpackAdapter[string, queryTestUser]).storage.(*mightyMapSQLiteStorage[string])
+	var id, parent, unused int
+	var detail string
+	err = raw.db.QueryRow("EXPLAIN QUERY PLAN SELECT key FROM "+defaultTableName+" WHERE "+SQLiteJSONPath("$.status")+" = ?", "active").
+		Scan(&id, &parent, &unused, &detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(detail, "idx_"+defaultTableName+"_json_status") {
+		t.Errorf("query plan %q does not use the JSON index", detail)
+	}
+
+	if _, err := querier.Query(ctx, "no such column = 1"); err == nil {
+		t.Error("Query() with an invalid condition succeeded")
+	}
+}
+
+func TestSQLiteJSONPathValidation(t *testing.T) {
+	for _, path := range []string{"$.a.b_c", "$.tags[0]", "$"} {
+		SQLiteJSONPath(path)
+	}
+	for _, path := range []string{"status", "$.a'); DROP TABLE x; --", "$.a b", "$[x]"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("SQLiteJSONPath(%q) did not panic", path)
+				}
+			}()
+			SQLiteJSONPath(path)
+		}()
+	}
+}
+
+func TestQueryNotSupported(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapBadgerStorage[string, int](WithMemoryStorage(true))
+	defer store.Close(ctx)
+
+	if _, err := store.(IMightyMapQueryStorage[string, int]).Query(ctx, "1"); err != ErrNotSupported {
+		t.Errorf("Query() error = %v; want ErrNotSupported", err)
+	}
+}
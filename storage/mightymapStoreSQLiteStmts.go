@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// sqliteStatements holds the prepared statements of a SQLite storage. A *sql.Stmt prepared on a
+// *sql.DB is prepared lazily on every pooled connection it runs on and cached there, so the SQL
+// is parsed once per connection instead of once per call.
+type sqliteStatements struct {
+	load        *sql.Stmt
+	loadSliding *sql.Stmt
+	store       *sql.Stmt
+	delete      *sql.Stmt
+	next        *sql.Stmt
+	nextDue     *sql.Stmt
+	// storePriority, setPriority and nextPriority maintain and follow the priority column
+	storePriority *sql.Stmt
+	setPriority   *sql.Stmt
+	nextPriority  *sql.Stmt
+	rangePage     *sql.Stmt
+	keys          *sql.Stmt
+	count         *sql.Stmt
+	touch         *sql.Stmt
+	clear         *sql.Stmt
+	purge         *sql.Stmt
+	// chunkBounds, chunk and chunkTail split the key space for ParallelRange
+	chunkBounds *sql.Stmt
+	chunk       *sql.Stmt
+	chunkTail   *sql.Stmt
+	// rangeSeqPage is only prepared with FIFO ordering, see WithSQLiteOrdering
+	rangeSeqPage *sql.Stmt
+	// exactCount is only prepared with WithSQLiteExactCount
+	exactCount *sql.Stmt
+}
+
+// prepareSQLiteStatements prepares all statements for tableName. Rows that have expired or are
+// not due yet are excluded by every read; the current time is always the last argument of
+// those statements.
+// With FIFO ordering, Next and Keys follow the seq column, and the store statements take the
+// current time as their last argument to move an expired row that is stored again to the end.
+// Store keeps the priority of a row unless it schedules it.
+func prepareSQLiteStatements(db *sql.DB, tableName string, ordering Ordering) (*sqliteStatements, error) {
+	stmts := &sqliteStatements{}
+	store := `INSERT INTO %[1]s (key, value, expires_at, visible_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at,
+			visible_at = excluded.visible_at,
+			priority = CASE WHEN excluded.visible_at IS NULL THEN %[1]s.priority END,
+			priority_seq = CASE WHEN excluded.visible_at IS NULL THEN %[1]s.priority_seq END`
+	storePriority := `INSERT INTO %[1]s (key, value, expires_at, visible_at, priority, priority_seq) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at,
+			visible_at = excluded.visible_at, priority = excluded.priority, priority_seq = excluded.priority_seq`
+	next := "DELETE FROM %[1]s WHERE key = (SELECT key FROM %[1]s WHERE %[2]s LIMIT 1) RETURNING key, value"
+	keys := "SELECT key FROM %[1]s WHERE %[2]s"
+	if ordering == FIFO {
+		reseq := `, seq = CASE WHEN %[1]s.expires_at <= ? THEN ` + sqliteNextSeq + ` ELSE %[1]s.seq END`
+		store += reseq
+		storePriority += reseq
+		next = "DELETE FROM %[1]s WHERE key = (SELECT key FROM %[1]s WHERE %[2]s ORDER BY seq LIMIT 1) RETURNING key, value"
+		keys += " ORDER BY seq"
+	}
+
+	type preparedQuery struct {
+		stmt  **sql.Stmt
+		query string
+	}
+	queries := []preparedQuery{
+		{&stmts.load, "SELECT value FROM %[1]s WHERE key = ? AND %[2]s"},
+		{&stmts.loadSliding, "UPDATE %[1]s SET expires_at = ? WHERE key = ? AND expires_at > ? AND (visible_at IS NULL OR visible_at <= ?) RETURNING value"},
+		{&stmts.store, store},
+		{&stmts.delete, "DELETE FROM %[1]s WHERE key = ?"},
+		{&stmts.next, next},
+		{&stmts.storePriority, storePriority},
+		{&stmts.setPriority, "UPDATE %[1]s SET priority = ?, priority_seq = COALESCE(priority_seq, ?) WHERE key = ? AND %[2]s"},
+		{&stmts.nextPriority, "DELETE FROM %[1]s WHERE key = (SELECT key FROM %[1]s WHERE priority IS NOT NULL AND %[2]s ORDER BY priority DESC, priority_seq LIMIT 1) RETURNING key, value"},
+		{&stmts.nextDue, "DELETE FROM %[1]s WHERE key = (SELECT key FROM %[1]s WHERE visible_at IS NOT NULL AND %[2]s ORDER BY visible_at LIMIT 1) RETURNING key, value"},
+		{&stmts.rangePage, "SELECT key, value FROM %[1]s WHERE key > ? AND %[2]s ORDER BY key LIMIT ?"},
+		{&stmts.keys, keys},
+		{&stmts.count, "SELECT COUNT(*) FROM %[1]s WHERE %[2]s"},
+		{&stmts.touch, "UPDATE %[1]s SET expires_at = ? WHERE key = ? AND expires_at > ?"},
+		{&stmts.clear, "DELETE FROM %[1]s"},
+		{&stmts.purge, "DELETE FROM %[1]s WHERE expires_at <= ?"},
+		{&stmts.chunkBounds, "SELECT key FROM (SELECT key, row_number() OVER (ORDER BY key) AS n FROM %[1]s) WHERE n %% ? = 0"},
+		{&stmts.chunk, "SELECT key, value FROM %[1]s WHERE key >= ? AND key < ? AND %[2]s"},
+		{&stmts.chunkTail, "SELECT key, value FROM %[1]s WHERE key >= ? AND %[2]s"},
+	}
+	if ordering == FIFO {
+		queries = append(queries, preparedQuery{&stmts.rangeSeqPage, "SELECT key, value, seq FROM %[1]s WHERE seq > ? AND %[2]s ORDER BY seq LIMIT ?"})
+	}
+	for _, q := range queries {
+		stmt, err := db.Prepare(fmt.Sprintf(q.query, tableName, sqliteVisible))
+		if err != nil {
+			stmts.close()
+			return nil, err
+		}
+		*q.stmt = stmt
+	}
+	return stmts, nil
+}
+
+// close closes all prepared statements.
+func (p *sqliteStatements) close() error {
+	var errs []error
+	for _, stmt := range []*sql.Stmt{
+		p.load, p.loadSliding, p.store, p.delete, p.next, p.nextDue, p.storePriority,
+		p.setPriority, p.nextPriority, p.rangePage, p.keys,
+		p.count, p.touch, p.clear, p.purge, p.chunkBounds, p.chunk, p.chunkTail, p.rangeSeqPage,
+		p.exactCount,
+	} {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// stmt returns stmt bound to the caller's transaction carried by ctx, or stmt itself.
+func (s *mightyMapSQLiteStorage[K]) stmt(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if tx, ok := SQLTxFromContext(ctx); ok {
+		return tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+)
+
+// sqlTxKey is the context key of the transaction set by ContextWithSQLTx.
+type sqlTxKey struct{}
+
+// ContextWithSQLTx returns a context carrying tx. SQLite storages called with this context run
+// their statements inside tx instead of on their own connection pool, so map writes commit or
+// roll back together with the caller's other writes, e.g. to implement the outbox pattern:
+//
+//	tx, err := db.BeginTx(ctx, nil)
+//	txCtx := storage.ContextWithSQLTx(ctx, tx)
+//	_, err = tx.ExecContext(txCtx, "INSERT INTO orders ...")
+//	outbox.Store(txCtx, eventID, event)
+//	err = tx.Commit()
+//
+// tx must belong to the database the storage uses, see WithSQLiteDB. Other storages ignore it.
+func ContextWithSQLTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, sqlTxKey{}, tx)
+}
+
+// SQLTxFromContext returns the transaction set by ContextWithSQLTx, if any.
+func SQLTxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tx, ok := ctx.Value(sqlTxKey{}).(*sql.Tx)
+	return tx, ok && tx != nil
+}
+
+// sqliteConn is the part of *sql.DB and *sql.Tx used by the SQLite storage.
+type sqliteConn interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the caller's transaction carried by ctx, or the connection pool.
+func (s *mightyMapSQLiteStorage[K]) conn(ctx context.Context) sqliteConn {
+	if tx, ok := SQLTxFromContext(ctx); ok {
+		return tx
+	}
+	return s.db
+}
+
+// inTx runs f in the caller's transaction carried by ctx. Without one, f runs in a new
+// transaction that is committed if f succeeds and rolled back otherwise.
+func (s *mightyMapSQLiteStorage[K]) inTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	if tx, ok := SQLTxFromContext(ctx); ok {
+		return f(tx)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
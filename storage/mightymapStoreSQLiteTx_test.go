@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func openSQLiteTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "app.db")+"?_journal_mode=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("CREATE TABLE orders (id INTEGER PRIMARY KEY, total INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func countOrders(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM orders").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSQLiteCallerTransaction(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLiteTestDB(t)
+	outbox := NewMightyMapSQLiteStorage[string, string](WithSQLiteDB(db), WithSQLiteTableName("outbox"))
+
+	// a rolled back transaction discards the domain write and the map write
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCtx := ContextWithSQLTx(ctx, tx)
+	if _, err := tx.Exec("INSERT INTO orders (id, total) VALUES (1, 10)"); err != nil {
+		t.Fatal(err)
+	}
+	outbox.Store(txCtx, "order-1", "created")
+	if v, ok := outbox.Load(txCtx, "order-1"); !ok || v != "created" {
+		t.Errorf("Load() within the transaction = %q, %v; want created, true", v, ok)
+	}
+	if n := outbox.Len(txCtx); n != 1 {
+		t.Errorf("Len() within the transaction = %d; want 1", n)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := outbox.Load(ctx, "order-1"); ok {
+		t.Error("map write survived the rollback")
+	}
+	if n := countOrders(t, db); n != 0 {
+		t.Errorf("orders after rollback = %d; want 0", n)
+	}
+
+	// a committed transaction keeps both
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCtx = ContextWithSQLTx(ctx, tx)
+	if _, err := tx.Exec("INSERT INTO orders (id, total) VALUES (2, 20)"); err != nil {
+		t.Fatal(err)
+	}
+	outbox.Store(txCtx, "order-2", "created")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := outbox.Load(ctx, "order-2"); !ok || v != "created" {
+		t.Errorf("Load() after commit = %q, %v; want created, true", v, ok)
+	}
+	if n := countOrders(t, db); n != 1 {
+		t.Errorf("orders after commit = %d; want 1", n)
+	}
+
+	// deletes roll back as well
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox.Delete(ContextWithSQLTx(ctx, tx), "order-2")
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := outbox.Load(ctx, "order-2"); !ok {
+		t.Error("delete survived the rollback")
+	}
+
+	// the borrowed database stays open
+	if err := outbox.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Errorf("database closed by the storage: %v", err)
+	}
+}
+
+func TestSQLTxFromContext(t *testing.T) {
+	if _, ok := SQLTxFromContext(context.Background()); ok {
+		t.Error("SQLTxFromContext() found a transaction in an empty context")
+	}
+	db := openSQLiteTestDB(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if got, ok := SQLTxFromContext(ContextWithSQLTx(context.Background(), tx)); !ok || got != tx {
+		t.Error("SQLTxFromContext() did not return the transaction")
+	}
+}
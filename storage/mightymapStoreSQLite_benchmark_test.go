@@ -0,0 +1,108 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/thisisdevelopment/mightymap/storage"
+)
+
+func newSQLiteBenchmarkStorage(b *testing.B) storage.IMightyMapStorage[int, string] {
+	store := storage.NewMightyMapSQLiteStorage[int, string](storage.WithSQLiteDBPath(b.TempDir() + "/bench.db"))
+	b.Cleanup(func() { store.Close(ctx) })
+	return store
+}
+
+func BenchmarkSQLiteStorageStore(b *testing.B) {
+	store := newSQLiteBenchmarkStorage(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.Store(ctx, i, "value")
+	}
+}
+
+func BenchmarkSQLiteStorageLoad(b *testing.B) {
+	store := newSQLiteBenchmarkStorage(b)
+	// Pre-populate the store
+	for i := 0; i < 10000; i++ {
+		store.Store(ctx, i, "value")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = store.Load(ctx, i%10000)
+	}
+}
+
+func BenchmarkSQLiteStorageDelete(b *testing.B) {
+	store := newSQLiteBenchmarkStorage(b)
+	// Pre-populate the store
+	for i := 0; i < 10000; i++ {
+		store.Store(ctx, i, "value")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.Delete(ctx, i%10000)
+	}
+}
+
+func BenchmarkSQLiteStorageConcurrentLoad(b *testing.B) {
+	store := newSQLiteBenchmarkStorage(b)
+	// Pre-populate the store
+	for i := 0; i < 10000; i++ {
+		store.Store(ctx, i, "value")
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = store.Load(ctx, i%10000)
+			i++
+		}
+	})
+}
+
+func BenchmarkSQLiteStorageConcurrentLoadWithWriter(b *testing.B) {
+	store := newSQLiteBenchmarkStorage(b)
+	// Pre-populate the store
+	for i := 0; i < 10000; i++ {
+		store.Store(ctx, i, "value")
+	}
+
+	stop := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				store.Store(ctx, i%10000, "updated")
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = store.Load(ctx, i%10000)
+			i++
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-writerDone
+}
+
+func BenchmarkSQLiteStorageInMemoryLoad(b *testing.B) {
+	store := storage.NewMightyMapSQLiteStorage[int, string]()
+	defer store.Close(ctx)
+	// Pre-populate the store
+	for i := 0; i < 10000; i++ {
+		store.Store(ctx, i, "value")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = store.Load(ctx, i%10000)
+	}
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -113,7 +115,7 @@ func TestMightyMapSQLiteStorageOptions(t *testing.T) {
 	// Test with file-based storage
 	t.Run("File-based storage", func(t *testing.T) {
 		store := NewMightyMapSQLiteStorage[string, int](
-			WithSQLiteDBPath("test.db"),
+			WithSQLiteDBPath(t.TempDir()+"/test.db"),
 			WithSQLiteJournalMode("WAL"),
 			WithSQLiteSyncMode("NORMAL"),
 			WithSQLiteMaxOpenConns(10),
@@ -228,3 +230,114 @@ func TestMightyMapSQLiteStorageEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestMightyMapSQLiteStorageSchema(t *testing.T) {
+	dbPath := t.TempDir() + "/schema.db"
+	store := NewMightyMapSQLiteStorage[string, int](WithSQLiteDBPath(dbPath))
+	defer store.Close(context.Background())
+
+	db := store.(*msgpackAdapter[string, int]).storage.(*mightyMapSQLiteStorage[string]).db
+
+	var tableSQL string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'mightymap_kv'").Scan(&tableSQL); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(tableSQL, "WITHOUT ROWID") {
+		t.Errorf("table is not created WITHOUT ROWID: %s", tableSQL)
+	}
+
+	var indexes int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_mightymap_kv_key'").Scan(&indexes); err != nil {
+		t.Fatal(err)
+	}
+	if indexes != 0 {
+		t.Error("redundant key index was created")
+	}
+}
+
+func TestMightyMapSQLiteStorageUpsert(t *testing.T) {
+	store := NewMightyMapSQLiteStorage[string, int]()
+	defer store.Close(context.Background())
+
+	ctx := context.Background()
+	store.Store(ctx, "key", 1)
+	store.Store(ctx, "key", 2)
+	if value, ok := store.Load(ctx, "key"); !ok || value != 2 {
+		t.Errorf("Load() = %v, %v; want 2, true", value, ok)
+	}
+	if n := store.Len(ctx); n != 1 {
+		t.Errorf("Len() = %d; want 1", n)
+	}
+}
+
+func TestMightyMapSQLiteStorageStoreInRange(t *testing.T) {
+	// Range must not hold the single connection of an in-memory database while f runs.
+	store := NewMightyMapSQLiteStorage[int, int]()
+	defer store.Close(context.Background())
+
+	ctx := context.Background()
+	for i := 0; i < 3000; i++ {
+		store.Store(ctx, i, i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		store.Range(ctx, func(key, value int) bool {
+			store.Store(ctx, key, value+1)
+			return true
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Range() with Store() in f deadlocked")
+	}
+
+	for _, key := range []int{0, 1500, 2999} {
+		if value, ok := store.Load(ctx, key); !ok || value != key+1 {
+			t.Errorf("Load(%d) = %v, %v; want %d, true", key, value, ok, key+1)
+		}
+	}
+}
+
+func TestMightyMapSQLiteStorageConcurrentNext(t *testing.T) {
+	dbPath := t.TempDir() + "/next.db"
+	store := NewMightyMapSQLiteStorage[int, int](WithSQLiteDBPath(dbPath))
+	defer store.Close(context.Background())
+
+	ctx := context.Background()
+	const entries = 500
+	for i := 0; i < entries; i++ {
+		store.Store(ctx, i, i)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int]int)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				key, _, ok := store.Next(ctx)
+				if !ok {
+					return
+				}
+				mu.Lock()
+				seen[key]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != entries {
+		t.Errorf("Next() returned %d distinct keys; want %d", len(seen), entries)
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("Next() returned key %d %d times; want 1", key, n)
+		}
+	}
+}
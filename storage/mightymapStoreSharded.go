@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"hash/maphash"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// shardedShardsPerProc is the default number of shards per GOMAXPROCS
+const shardedShardsPerProc = 4
+
+// mightyMapShardedStorage is an in-memory storage that spreads its keys over a power-of-two
+// number of shards, each a Go map with its own lock, so writes to different shards do not
+// contend. Values are stored as-is without any serialization.
+//
+// Operations on single keys lock one shard. Range and Keys visit the shards one after another,
+// so every entry that exists during the whole call is visited exactly once, but entries written
+// meanwhile may or may not be. Len and Clear lock all shards at once, in shard order, so they
+// are atomic.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+type mightyMapShardedStorage[K comparable, V any] struct {
+	shards     []shardedShard[K, V]
+	mask       uint64
+	hash       func(key K) uint64
+	nextCursor atomic.Uint64
+}
+
+// shardedShard is padded to 64 bytes, a cache line, so the locks of neighbouring shards do not
+// share one.
+type shardedShard[K comparable, V any] struct {
+	mutex sync.RWMutex
+	data  map[K]V
+	_     [64 - unsafe.Sizeof(sync.RWMutex{})%64 - 8]byte
+}
+
+type shardedOpts struct {
+	shards int
+	hasher any
+}
+
+// OptionFuncSharded is a function type that modifies shardedOpts configuration.
+// It allows customizing the sharded in-memory storage through functional options pattern.
+type OptionFuncSharded func(*shardedOpts)
+
+// WithShardedStorageShards sets the number of shards, rounded up to a power of two. More shards
+// mean less contention between writers but slower Len and Clear.
+// **Default value**: `4 * GOMAXPROCS` rounded up to a power of two
+func WithShardedStorageShards(shards int) OptionFuncSharded {
+	return func(o *shardedOpts) {
+		o.shards = shards
+	}
+}
+
+// WithShardedStorageHasher sets the function spreading keys over the shards. Equal keys must
+// have equal hashes; the low bits select the shard. Its key type must match the storage.
+// **Default value**: `maphash.Comparable` with a random seed
+func WithShardedStorageHasher[K comparable](hasher func(key K) uint64) OptionFuncSharded {
+	return func(o *shardedOpts) {
+		o.hasher = hasher
+	}
+}
+
+// NewMightyMapShardedStorage creates an in-memory storage for write-heavy workloads on many
+// cores, which spreads its keys over shards with their own locks instead of guarding a single
+// map with one lock like the default storage.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+//
+// Parameters:
+//   - optfuncs: Optional configuration functions that modify shardedOpts settings
+//
+// Returns a new IMightyMapStorage instance ready for use.
+// Panics if the hasher does not match the key type.
+func NewMightyMapShardedStorage[K comparable, V any](optfuncs ...OptionFuncSharded) IMightyMapStorage[K, V] {
+	opts := &shardedOpts{shards: shardedShardsPerProc * runtime.GOMAXPROCS(0)}
+	for _, optfunc := range optfuncs {
+		optfunc(opts)
+	}
+
+	shards := shardCount(opts.shards)
+	c := &mightyMapShardedStorage[K, V]{
+		shards: make([]shardedShard[K, V], shards),
+		mask:   uint64(shards - 1),
+	}
+	for i := range c.shards {
+		c.shards[i].data = make(map[K]V)
+	}
+
+	if opts.hasher != nil {
+		hasher, ok := opts.hasher.(func(key K) uint64)
+		if !ok {
+			panic(fmt.Sprintf("mightymap: hasher %T does not match keys of %T", opts.hasher, *new(K)))
+		}
+		c.hash = hasher
+	} else {
+		seed := maphash.MakeSeed()
+		c.hash = func(key K) uint64 {
+			return hashKey(seed, key)
+		}
+	}
+	return c
+}
+
+// shardCount rounds shards up to a power of two, at least 1.
+func shardCount(shards int) int {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	return n
+}
+
+// shard returns the shard holding key.
+func (c *mightyMapShardedStorage[K, V]) shard(key K) *shardedShard[K, V] {
+	return &c.shards[c.hash(key)&c.mask]
+}
+
+// Load retrieves a value for the given key under the read lock of its shard.
+func (c *mightyMapShardedStorage[K, V]) Load(_ context.Context, key K) (value V, ok bool) {
+	s := c.shard(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	value, ok = s.data[key]
+	return
+}
+
+// Store adds or updates a key-value pair under the write lock of its shard.
+func (c *mightyMapShardedStorage[K, V]) Store(_ context.Context, key K, value V) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data[key] = value
+}
+
+// Delete removes one or more keys, locking the shard of each key in turn.
+// Non-existent keys are silently ignored.
+func (c *mightyMapShardedStorage[K, V]) Delete(_ context.Context, keys ...K) {
+	for _, key := range keys {
+		s := c.shard(key)
+		s.mutex.Lock()
+		delete(s.data, key)
+		s.mutex.Unlock()
+	}
+}
+
+// Range iterates over all key-value pairs in an unspecified order, one shard at a time under
+// its read lock. If the provided function returns false, iteration stops early.
+func (c *mightyMapShardedStorage[K, V]) Range(_ context.Context, f func(key K, value V) bool) {
+	for i := range c.shards {
+		if !c.shards[i].each(f) {
+			return
+		}
+	}
+}
+
+// each calls f for every entry of the shard under its read lock, reporting whether f asked to
+// continue.
+func (s *shardedShard[K, V]) each(f func(key K, value V) bool) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for k, v := range s.data {
+		if !f(k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Keys returns all keys in an unspecified order, collected one shard at a time.
+func (c *mightyMapShardedStorage[K, V]) Keys(ctx context.Context) []K {
+	keys := []K{}
+	c.Range(ctx, func(k K, _ V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// Next returns and removes an entry in an unspecified order under the write lock of its shard.
+// Callers start at different shards, so concurrent callers rarely contend.
+func (c *mightyMapShardedStorage[K, V]) Next(_ context.Context) (key K, value V, ok bool) {
+	start := c.nextCursor.Add(1)
+	for i := range uint64(len(c.shards)) {
+		s := &c.shards[(start+i)&c.mask]
+		if key, value, ok = s.take(); ok {
+			return key, value, true
+		}
+	}
+	return key, value, false
+}
+
+// take removes and returns any entry of the shard.
+func (s *shardedShard[K, V]) take() (key K, value V, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for k, v := range s.data {
+		delete(s.data, k)
+		return k, v, true
+	}
+	return key, value, false
+}
+
+// Len returns the number of key-value pairs, holding the read locks of all shards at once.
+func (c *mightyMapShardedStorage[K, V]) Len(_ context.Context) int {
+	for i := range c.shards {
+		c.shards[i].mutex.RLock()
+	}
+	count := 0
+	for i := range c.shards {
+		count += len(c.shards[i].data)
+		c.shards[i].mutex.RUnlock()
+	}
+	return count
+}
+
+// Clear removes all key-value pairs, holding the write locks of all shards at once.
+func (c *mightyMapShardedStorage[K, V]) Clear(_ context.Context) {
+	for i := range c.shards {
+		c.shards[i].mutex.Lock()
+	}
+	for i := range c.shards {
+		c.shards[i].data = make(map[K]V)
+		c.shards[i].mutex.Unlock()
+	}
+}
+
+// Close releases any resources held by the sharded storage.
+// For the sharded storage implementation, no cleanup is required.
+func (c *mightyMapShardedStorage[K, V]) Close(_ context.Context) error {
+	// No resources to clean up for sharded storage
+	return nil
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestShardedStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapShardedStorage[int, string](WithShardedStorageShards(5))
+	defer store.Close(ctx)
+	if n := len(store.(*mightyMapShardedStorage[int, string]).shards); n != 8 {
+		t.Errorf("shards = %d; want 8", n)
+	}
+
+	for i := 0; i < 100; i++ {
+		store.Store(ctx, i, "value")
+	}
+	store.Delete(ctx, 10, 20, 1000)
+	if n := store.Len(ctx); n != 98 {
+		t.Errorf("Len() = %d; want 98", n)
+	}
+	if _, ok := store.Load(ctx, 10); ok {
+		t.Error("Load() found a deleted key")
+	}
+	if v, ok := store.Load(ctx, 0); !ok || v != "value" {
+		t.Errorf("Load(0) = %q, %v; want value, true", v, ok)
+	}
+
+	keys := store.Keys(ctx)
+	sort.Ints(keys)
+	if len(keys) != 98 || keys[0] != 0 || keys[97] != 99 {
+		t.Errorf("Keys() returned %d keys from %v to %v; want 98 from 0 to 99", len(keys), keys[0], keys[len(keys)-1])
+	}
+	visited := 0
+	store.Range(ctx, func(int, string) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Errorf("Range() visited %d entries after stopping at 10", visited)
+	}
+
+	// Next also returns the zero key
+	seen := map[int]bool{}
+	for {
+		key, _, ok := store.Next(ctx)
+		if !ok {
+			break
+		}
+		if seen[key] {
+			t.Fatalf("Next() returned %d twice", key)
+		}
+		seen[key] = true
+	}
+	if len(seen) != 98 || !seen[0] || store.Len(ctx) != 0 {
+		t.Errorf("Next() returned %d keys, zero key %v, %d left; want 98, true, 0", len(seen), seen[0], store.Len(ctx))
+	}
+
+	store.Store(ctx, 1, "one")
+	store.Clear(ctx)
+	if n := store.Len(ctx); n != 0 {
+		t.Errorf("Len() after Clear() = %d; want 0", n)
+	}
+}
+
+func TestShardedStorageSignedZeroKeys(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapShardedStorage[float64, int](WithShardedStorageShards(64))
+	defer store.Close(ctx)
+
+	// -0 == +0, so both must land in the same shard and be one key
+	store.Store(ctx, math.Copysign(0, -1), 1)
+	store.Store(ctx, 0, 2)
+	if n := store.Len(ctx); n != 1 {
+		t.Errorf("Len() = %d; want 1", n)
+	}
+	if v, ok := store.Load(ctx, math.Copysign(0, -1)); !ok || v != 2 {
+		t.Errorf("Load(-0) = %d, %v; want 2, true", v, ok)
+	}
+}
+
+func TestShardedStorageHasher(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapShardedStorage[string, int](
+		WithShardedStorageShards(4),
+		WithShardedStorageHasher(func(key string) uint64 { return uint64(len(key)) }),
+	).(*mightyMapShardedStorage[string, int])
+
+	store.Store(ctx, "a", 1)
+	store.Store(ctx, "bb", 2)
+	store.Store(ctx, "cccc", 3)
+	for i, want := range []int{1, 1, 1, 0} {
+		if n := len(store.shards[i].data); n != want {
+			t.Errorf("shard %d holds %d keys; want %d", i, n, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewMightyMapShardedStorage() did not panic on a mismatched hasher")
+		}
+	}()
+	NewMightyMapShardedStorage[int, int](WithShardedStorageHasher(func(string) uint64 { return 0 }))
+}
+
+func TestShardedStorageConcurrentNext(t *testing.T) {
+	ctx := context.Background()
+	store := NewMightyMapShardedStorage[int, int](WithShardedStorageShards(16))
+	for i := 0; i < 10000; i++ {
+		store.Store(ctx, i, i)
+	}
+
+	var mu sync.Mutex
+	seen := map[int]bool{}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				key, _, ok := store.Next(ctx)
+				if !ok {
+					return
+				}
+				mu.Lock()
+				if seen[key] {
+					t.Errorf("Next() returned %d twice", key)
+				}
+				seen[key] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 10000 {
+		t.Errorf("Next() returned %d keys; want 10000", len(seen))
+	}
+}
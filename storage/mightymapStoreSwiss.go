@@ -7,17 +7,45 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dolthub/swiss"
 )
 
-type mightyMapSwissStorage[K comparable] struct {
-	data  *swiss.Map[K, []byte]
-	mutex *sync.RWMutex
+// mightyMapSwissStorage stores values as-is in a swiss.Map guarded by a read-write mutex.
+// With WithSwissEncoding it is instantiated with []byte values behind the msgpack adapter.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, can be any type
+type mightyMapSwissStorage[K comparable, V any] struct {
+	data     *swiss.Map[K, V]
+	mutex    *sync.RWMutex
+	expiry   *expiryTracker[K]
+	order    *orderIndex[K]
+	due      *dueIndex[K]
+	priority *priorityIndex[K]
+	stored   *storeNotifier
+	ranging  *rangeGuard
+	// snapshotRange makes Range call its callback without holding the lock
+	snapshotRange bool
+
+	// capacity is the requested initial capacity, baseCapacity the size of a table created
+	// with it, which the table never shrinks below
+	capacity     uint32
+	baseCapacity int
+	shrinkRatio  float64
 }
 
 type swissOpts struct {
-	defaultCapacity uint32
+	defaultCapacity   uint32
+	expire            time.Duration
+	slidingExpiration bool
+	ordering          Ordering
+	encoding          bool
+	shards            int
+	shrinkRatio       float64
+	snapshotRange     bool
 }
 
 const defaultSwissCapacity = 10_000
@@ -29,10 +57,13 @@ type OptionFuncSwiss func(*swissOpts)
 
 // NewMightyMapSwissStorage creates a new thread-safe map storage implementation using swiss.Map
 // with optional configuration through OptionFuncSwiss functions.
-// Values are automatically encoded using MessagePack encoding.
+// Values are stored as-is without any serialization, unless WithSwissEncoding is set.
 //
 // NOTE: If you're using Go 1.24 or later, consider using the default storage implementation
 // instead, as Go 1.24+ already uses SwissMap internally for its map implementation.
+//
+// With WithSwissShards the storage does not implement IMightyMapPriorityStorage and
+// IMightyMapScheduleStorage, so the corresponding Map methods return ErrNotSupported.
 func NewMightyMapSwissStorage[K comparable, V any](optfuncs ...OptionFuncSwiss) IMightyMapStorage[K, V] {
 	// Check Go version and print warning if using Go 1.24+
 	checkGoVersion()
@@ -43,11 +74,36 @@ func NewMightyMapSwissStorage[K comparable, V any](optfuncs ...OptionFuncSwiss)
 		optfunc(opts)
 	}
 
-	storage := &mightyMapSwissStorage[K]{
-		data:  swiss.NewMap[K, []byte](opts.defaultCapacity),
-		mutex: &sync.RWMutex{},
+	if opts.encoding {
+		if opts.shards > 1 {
+			return newMsgpackAdapter[K, V](newSwissShardedStorage[K, []byte](opts))
+		}
+		return newMsgpackAdapter[K, V](newSwissStorage[K, []byte](opts))
+	}
+	if opts.shards > 1 {
+		return newSwissShardedStorage[K, V](opts)
+	}
+	return newSwissStorage[K, V](opts)
+}
+
+// newSwissStorage creates a single table storage.
+func newSwissStorage[K comparable, V any](opts *swissOpts) *mightyMapSwissStorage[K, V] {
+	c := &mightyMapSwissStorage[K, V]{
+		data:        swiss.NewMap[K, V](opts.defaultCapacity),
+		mutex:       &sync.RWMutex{},
+		expiry:      newExpiryTracker[K](opts.expire, opts.slidingExpiration),
+		order:       newOrderIndex[K](opts.ordering),
+		due:         newDueIndex[K](),
+		priority:    newPriorityIndex[K](),
+		stored:      newStoreNotifier(),
+		ranging:     newRangeGuard(),
+		capacity:    opts.defaultCapacity,
+		shrinkRatio: opts.shrinkRatio,
+
+		snapshotRange: opts.snapshotRange,
 	}
-	return newMsgpackAdapter[K, V](storage)
+	c.baseCapacity = c.tableSize()
+	return c
 }
 
 // checkGoVersion checks if the runtime Go version is 1.24 or higher and logs a warning
@@ -75,74 +131,492 @@ func WithDefaultCapacity(capacity uint32) OptionFuncSwiss {
 	}
 }
 
-func (c *mightyMapSwissStorage[K]) Load(_ context.Context, key K) (value []byte, ok bool) {
+// WithSwissEncoding stores values msgpack encoded instead of as-is. Every Load then decodes a
+// fresh copy, so callers can modify returned values without affecting the storage, at the cost
+// of encoding and decoding on every operation.
+// **Default value**: `false`
+func WithSwissEncoding(encoding bool) OptionFuncSwiss {
+	return func(o *swissOpts) {
+		o.encoding = encoding
+	}
+}
+
+// WithSwissShards spreads the keys over shards, rounded up to a power of two, each a swiss.Map
+// with its own lock and an equal part of the capacity, so writers to different shards do not
+// contend. A sharded storage has no priorities and scheduled entries, whose methods return
+// ErrNotSupported. With FIFO ordering the shards share one order index, so every write also
+// takes its lock.
+// **Default value**: `1` (a single table)
+func WithSwissShards(shards int) OptionFuncSwiss {
+	return func(o *swissOpts) {
+		o.shards = shards
+	}
+}
+
+// WithSwissShrinkRatio rebuilds the table to fit its entries when, after removing entries, they
+// fill less than ratio of its capacity. The table never shrinks below the initial capacity.
+// A swiss.Map only grows by itself, so without shrinking the memory of a table that was once
+// large is kept until Clear or Compact. Values up to 0.25 avoid rebuilding too often.
+// **Default value**: `0` (never shrink automatically)
+func WithSwissShrinkRatio(ratio float64) OptionFuncSwiss {
+	return func(o *swissOpts) {
+		o.shrinkRatio = ratio
+	}
+}
+
+// WithSwissSnapshotRange makes Range iterate over a copy of the keys taken when it starts,
+// calling its callback without holding the lock, so the callback may read and write the storage.
+// Keys deleted meanwhile are skipped, changed values are seen as changed, and keys stored
+// meanwhile are not visited. Disabled, Range holds the read lock during the whole iteration
+// instead, which saves the copy, and writes from the callback panic with ErrReentrantWrite.
+// **Default value**: `true`
+func WithSwissSnapshotRange(snapshot bool) OptionFuncSwiss {
+	return func(o *swissOpts) {
+		o.snapshotRange = snapshot
+	}
+}
+
+// WithSwissExpire sets the duration after which entries expire.
+// Expired entries are invisible to all operations and are purged lazily.
+// **Default value**: `0` (entries never expire)
+func WithSwissExpire(expire time.Duration) OptionFuncSwiss {
+	return func(o *swissOpts) {
+		o.expire = expire
+	}
+}
+
+// WithSwissSlidingExpiration makes Load restart the expiration of the entry it reads,
+// so entries expire after their last access instead of their last write.
+// Only effective together with WithSwissExpire.
+// **Default value**: `false`
+func WithSwissSlidingExpiration(sliding bool) OptionFuncSwiss {
+	return func(o *swissOpts) {
+		o.slidingExpiration = sliding
+	}
+}
+
+// WithSwissOrdering sets the order of Next, Range and Keys. With FIFO the insertion order is
+// kept in a linked list next to the table, which costs one list element per entry.
+// **Default value**: `Unordered`
+func WithSwissOrdering(ordering Ordering) OptionFuncSwiss {
+	return func(o *swissOpts) {
+		o.ordering = ordering
+	}
+}
+
+func (c *mightyMapSwissStorage[K, V]) Load(_ context.Context, key K) (value V, ok bool) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 	value, ok = c.data.Get(key)
+	if !ok {
+		return
+	}
+	if !c.visible(key, c.clock()) {
+		return *new(V), false
+	}
+	c.expiry.slide(key)
 	return
 }
 
-func (c *mightyMapSwissStorage[K]) Store(_ context.Context, key K, value []byte) {
-	c.mutex.Lock()
+func (c *mightyMapSwissStorage[K, V]) Store(_ context.Context, key K, value V) {
+	c.store(key, value, time.Time{})
+}
+
+// StoreAt stores a key-value pair that Load, Range, Keys, Len and Next ignore until visibleAt.
+// Its expiration starts at visibleAt. A timer wakes up NextWait when the entry becomes due.
+func (c *mightyMapSwissStorage[K, V]) StoreAt(_ context.Context, key K, value V, visibleAt time.Time) error {
+	c.store(key, value, visibleAt)
+	if d := time.Until(visibleAt); d > 0 {
+		time.AfterFunc(d, c.stored.notify)
+	}
+	return nil
+}
+
+// StoreWithPriority stores a key-value pair that Next returns before the entries with a lower
+// priority or without one, after the entries with the same priority that were stored earlier.
+func (c *mightyMapSwissStorage[K, V]) StoreWithPriority(_ context.Context, key K, value V, priority int) error {
+	c.lock()
 	defer c.mutex.Unlock()
+	c.storeLocked(key, value, time.Time{})
+	c.priority.set(key, priority, true)
+	return nil
+}
+
+// SetPriority changes the priority of an entry, or gives it one, without rewriting its value.
+// The entry keeps its place among the entries with the same priority.
+// Returns false if the key is not present.
+func (c *mightyMapSwissStorage[K, V]) SetPriority(_ context.Context, key K, priority int) (bool, error) {
+	c.lock()
+	defer c.mutex.Unlock()
+	if !c.data.Has(key) || !c.visible(key, c.clock()) {
+		return false, nil
+	}
+	c.priority.set(key, priority, false)
+	return true, nil
+}
+
+// store writes key, scheduled at visibleAt unless it is zero.
+func (c *mightyMapSwissStorage[K, V]) store(key K, value V, visibleAt time.Time) {
+	c.lock()
+	defer c.mutex.Unlock()
+	c.storeLocked(key, value, visibleAt)
+}
+
+// storeLocked is store with the write lock held. Scheduling an entry drops its priority.
+func (c *mightyMapSwissStorage[K, V]) storeLocked(key K, value V, visibleAt time.Time) {
+	if c.data.Has(key) && !c.expiry.alive(key, c.expiry.now()) {
+		// an expired entry that was not purged yet is stored as a new one
+		c.order.remove(key)
+		c.priority.remove(key)
+	}
 	c.data.Put(key, value)
+	c.expiry.setFrom(key, visibleAt)
+	c.due.set(key, visibleAt)
+	if !visibleAt.IsZero() {
+		c.priority.remove(key)
+	}
+	c.order.add(key)
+	if c.expiry.purgeDue() {
+		for _, k := range c.expiry.expired() {
+			c.data.Delete(k)
+			c.order.remove(k)
+			c.due.remove(k)
+			c.priority.remove(k)
+		}
+		c.shrinkLocked()
+	}
+	c.stored.notify()
 }
 
-func (c *mightyMapSwissStorage[K]) Delete(_ context.Context, keys ...K) {
-	c.mutex.Lock()
+func (c *mightyMapSwissStorage[K, V]) Delete(_ context.Context, keys ...K) {
+	c.lock()
 	defer c.mutex.Unlock()
 	for _, key := range keys {
 		c.data.Delete(key)
+		c.expiry.remove(key)
+		c.order.remove(key)
+		c.due.remove(key)
+		c.priority.remove(key)
 	}
+	c.shrinkLocked()
 }
 
-func (c *mightyMapSwissStorage[K]) Range(_ context.Context, f func(key K, value []byte) bool) {
+// Range iterates over a copy of the keys, so f may write to the storage, unless
+// WithSwissSnapshotRange is disabled and it holds the read lock while calling f.
+func (c *mightyMapSwissStorage[K, V]) Range(ctx context.Context, f func(key K, value V) bool) {
+	if c.snapshotRange {
+		for _, k := range c.Keys(ctx) {
+			if v, ok := c.peek(k); ok && !f(k, v) {
+				return
+			}
+		}
+		return
+	}
+
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	c.data.Iter(func(k K, v []byte) bool {
+	defer c.ranging.leave(c.ranging.enter())
+	now := c.clock()
+	if c.order != nil {
+		c.order.each(func(k K) bool {
+			if !c.visible(k, now) {
+				return true
+			}
+			v, _ := c.data.Get(k)
+			return f(k, v)
+		})
+		return
+	}
+	c.data.Iter(func(k K, v V) bool {
+		if !c.visible(k, now) {
+			return false
+		}
 		return !f(k, v)
 	})
 }
 
-func (c *mightyMapSwissStorage[K]) Keys(_ context.Context) []K {
+// peek returns the value of a visible key without restarting its expiration.
+func (c *mightyMapSwissStorage[K, V]) peek(key K) (value V, ok bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	value, ok = c.data.Get(key)
+	if !ok || !c.visible(key, c.clock()) {
+		return *new(V), false
+	}
+	return value, true
+}
+
+func (c *mightyMapSwissStorage[K, V]) Keys(_ context.Context) []K {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	now := c.clock()
 	keys := []K{}
-	c.data.Iter(func(k K, v []byte) bool {
-		keys = append(keys, k)
+	if c.order != nil {
+		c.order.each(func(k K) bool {
+			if c.visible(k, now) {
+				keys = append(keys, k)
+			}
+			return true
+		})
+		return keys
+	}
+	c.data.Iter(func(k K, v V) bool {
+		if c.visible(k, now) {
+			keys = append(keys, k)
+		}
 		return false // Continue iteration (based on Range method pattern)
 	})
 	return keys
 }
 
-func (c *mightyMapSwissStorage[K]) Len(_ context.Context) int {
+func (c *mightyMapSwissStorage[K, V]) Len(_ context.Context) int {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	return c.data.Count()
+	return c.lenLocked()
+}
+
+// lenLocked counts the visible entries. The caller must hold a lock.
+func (c *mightyMapSwissStorage[K, V]) lenLocked() int {
+	now := c.clock()
+	if c.expiry == nil {
+		return c.data.Count() - c.due.pending(now)
+	}
+	count := 0
+	c.data.Iter(func(k K, _ V) bool {
+		if c.visible(k, now) {
+			count++
+		}
+		return false
+	})
+	return count
 }
 
-func (c *mightyMapSwissStorage[K]) Clear(_ context.Context) {
-	c.mutex.Lock()
+func (c *mightyMapSwissStorage[K, V]) Clear(_ context.Context) {
+	c.lock()
 	defer c.mutex.Unlock()
-	c.data.Clear()
+	c.clearLocked()
 }
 
-func (c *mightyMapSwissStorage[K]) Next(ctx context.Context) (key K, value []byte, ok bool) {
-	c.Range(ctx, func(k K, v []byte) bool {
-		value = v
-		key = k
-		return false
+// clearLocked replaces the table with a new one of the initial capacity, releasing the memory
+// of a grown table. The caller must hold the write lock.
+func (c *mightyMapSwissStorage[K, V]) clearLocked() {
+	c.data = swiss.NewMap[K, V](c.capacity)
+	c.expiry.reset()
+	c.order.reset()
+	c.due.reset()
+	c.priority.reset()
+}
+
+// Touch restarts the expiration of the given keys without reading their values.
+// Missing and already expired keys are ignored. Without an expiration configured this is a no-op.
+func (c *mightyMapSwissStorage[K, V]) Touch(_ context.Context, keys ...K) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, key := range keys {
+		c.expiry.touch(key)
+	}
+	return nil
+}
+
+// Next removes and returns an entry: the one with the highest priority if any entry was stored
+// with a priority, otherwise any entry, or the oldest one with FIFO ordering. The entry is taken
+// under a single write lock, so concurrent callers each receive a different entry.
+func (c *mightyMapSwissStorage[K, V]) Next(_ context.Context) (key K, value V, ok bool) {
+	return c.takeNext()
+}
+
+// nextOrdered removes and returns the oldest entry under a single write lock. Expired entries
+// found at the front are dropped on the way.
+func (c *mightyMapSwissStorage[K, V]) nextOrdered() (key K, value V, ok bool) {
+	c.lock()
+	defer c.mutex.Unlock()
+	defer c.shrinkLocked()
+	now := c.clock()
+	for e := c.order.keys.Front(); e != nil; {
+		k, next := e.Value.(K), e.Next()
+		if !c.due.visible(k, now) {
+			// scheduled entries keep their place until they are due
+			e = next
+			continue
+		}
+		v, _ := c.data.Get(k)
+		alive := c.expiry.alive(k, now)
+		c.data.Delete(k)
+		c.expiry.remove(k)
+		c.order.remove(k)
+		c.due.remove(k)
+		c.priority.remove(k)
+		if alive {
+			return k, v, true
+		}
+		e = next
+	}
+	return key, value, false
+}
+
+// nextPrioritized removes and returns the entry with the highest priority under a single write
+// lock. Expired entries are dropped on the way.
+func (c *mightyMapSwissStorage[K, V]) nextPrioritized() (key K, value V, ok bool) {
+	c.lock()
+	defer c.mutex.Unlock()
+	defer c.shrinkLocked()
+	now := c.clock()
+	for {
+		k, found := c.priority.pop()
+		if !found {
+			return key, value, false
+		}
+		v, _ := c.data.Get(k)
+		alive := c.expiry.alive(k, now)
+		c.data.Delete(k)
+		c.expiry.remove(k)
+		c.order.remove(k)
+		c.due.remove(k)
+		if alive {
+			return k, v, true
+		}
+	}
+}
+
+// take removes key and returns its value unless it has expired. An expired key is removed as
+// well, and a missing one from the order index in case it lingers there. It is used by the
+// sharded storage, which has no scheduled entries.
+func (c *mightyMapSwissStorage[K, V]) take(key K) (value V, ok bool) {
+	c.lock()
+	defer c.mutex.Unlock()
+	defer c.shrinkLocked()
+	value, ok = c.data.Get(key)
+	ok = ok && c.expiry.alive(key, c.clock())
+	c.data.Delete(key)
+	c.expiry.remove(key)
+	c.order.remove(key)
+	c.due.remove(key)
+	c.priority.remove(key)
+	if !ok {
+		return *new(V), false
+	}
+	return value, true
+}
+
+// NextWait removes and returns an entry like Next, waiting until one is stored while the storage
+// is empty. The entry is taken under a single write lock, so concurrent callers each receive a
+// different entry. Returns the context error if ctx is cancelled first.
+func (c *mightyMapSwissStorage[K, V]) NextWait(ctx context.Context) (key K, value V, err error) {
+	return waitNext(ctx, c.stored, 0, func(context.Context) (K, V, bool) {
+		return c.takeNext()
+	})
+}
+
+// takeNext removes and returns an entry under a single write lock, the one with the highest
+// priority or, with FIFO ordering, the oldest one.
+func (c *mightyMapSwissStorage[K, V]) takeNext() (key K, value V, ok bool) {
+	if key, value, ok = c.nextPrioritized(); ok {
+		return
+	}
+	if c.order != nil {
+		return c.nextOrdered()
+	}
+	c.lock()
+	defer c.mutex.Unlock()
+	defer c.shrinkLocked()
+	now := c.clock()
+	c.data.Iter(func(k K, v V) bool {
+		if !c.visible(k, now) {
+			return false
+		}
+		key, value, ok = k, v, true
+		return true
 	})
+	if ok {
+		c.data.Delete(key)
+		c.expiry.remove(key)
+		c.due.remove(key)
+		c.priority.remove(key)
+	}
+	return key, value, ok
+}
 
-	if key != *new(K) {
-		ok = true
-		c.Delete(ctx, key)
+// NextDue removes and returns the scheduled entry with the earliest due time, if that time has
+// passed. Entries stored with Store are never returned. Expired entries are dropped on the way.
+func (c *mightyMapSwissStorage[K, V]) NextDue(_ context.Context) (key K, value V, ok bool) {
+	c.lock()
+	defer c.mutex.Unlock()
+	defer c.shrinkLocked()
+	now := time.Now().UnixNano()
+	for {
+		k, due := c.due.popDue(now)
+		if !due {
+			return key, value, false
+		}
+		v, _ := c.data.Get(k)
+		alive := c.expiry.alive(k, now)
+		c.data.Delete(k)
+		c.expiry.remove(k)
+		c.order.remove(k)
+		c.priority.remove(k)
+		if alive {
+			return k, v, true
+		}
 	}
+}
 
-	return
+// lock takes the write lock, panicking with ErrReentrantWrite if the calling goroutine holds the
+// read lock in a Range callback.
+func (c *mightyMapSwissStorage[K, V]) lock() {
+	c.ranging.lock(c.mutex)
+}
+
+// clock returns the current time in unix nanoseconds, or 0 when neither expiration nor
+// scheduled entries need it so callers can skip the clock read.
+func (c *mightyMapSwissStorage[K, V]) clock() int64 {
+	if c.expiry == nil && c.due.empty() {
+		return 0
+	}
+	return time.Now().UnixNano()
+}
+
+// visible reports whether key has neither expired nor is scheduled after now.
+func (c *mightyMapSwissStorage[K, V]) visible(key K, now int64) bool {
+	return c.expiry.alive(key, now) && c.due.visible(key, now)
+}
+
+// Compact rebuilds the table to fit its entries, releasing the memory the table kept after
+// growing, but never below the initial capacity.
+func (c *mightyMapSwissStorage[K, V]) Compact(_ context.Context) error {
+	c.lock()
+	defer c.mutex.Unlock()
+	c.rebuildLocked()
+	return nil
+}
+
+// shrinkLocked rebuilds the table when its entries fill less than the shrink ratio of its
+// capacity. The caller must hold the write lock.
+func (c *mightyMapSwissStorage[K, V]) shrinkLocked() {
+	size := c.tableSize()
+	if c.shrinkRatio > 0 && size > c.baseCapacity && float64(c.data.Count()) < c.shrinkRatio*float64(size) {
+		c.rebuildLocked()
+	}
+}
+
+// tableSize returns the number of entries the table holds before it grows. swiss.Map only
+// reports the room that is left, which slots of deleted entries that were not reclaimed yet
+// reduce, so this underestimates the size of a table with many deletions.
+func (c *mightyMapSwissStorage[K, V]) tableSize() int {
+	return c.data.Capacity() + c.data.Count()
+}
+
+// rebuildLocked copies the entries into a new table sized for them. The caller must hold the
+// write lock.
+func (c *mightyMapSwissStorage[K, V]) rebuildLocked() {
+	data := swiss.NewMap[K, V](max(c.capacity, uint32(c.data.Count())))
+	c.data.Iter(func(k K, v V) bool {
+		data.Put(k, v)
+		return false
+	})
+	c.data = data
 }
 
-func (c *mightyMapSwissStorage[K]) Close(_ context.Context) error {
+func (c *mightyMapSwissStorage[K, V]) Close(_ context.Context) error {
 	// nothing to do
 	return nil
 }
@@ -150,5 +624,6 @@ func (c *mightyMapSwissStorage[K]) Close(_ context.Context) error {
 func getDefaultSwissOptions() *swissOpts {
 	return &swissOpts{
 		defaultCapacity: defaultSwissCapacity,
+		snapshotRange:   true,
 	}
 }
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"hash/maphash"
+	"sync/atomic"
+)
+
+// mightyMapSwissShardedStorage spreads its keys over several single table Swiss storages, like
+// the sharded storage does over Go maps. Every shard keeps its own expiration; priorities and
+// scheduled entries would only hold within a shard and are not offered. With FIFO ordering the
+// shards share one order index, which has its own lock and is always locked after a shard.
+//
+// Operations on single keys lock one shard. Range and Keys visit the shards one after another,
+// or with FIFO ordering lock all shards at once; Len, Clear and Compact lock all shards at once,
+// in shard order.
+//
+// Type parameters:
+//   - K: the key type, must be comparable
+//   - V: the value type, []byte behind the msgpack adapter
+type mightyMapSwissShardedStorage[K comparable, V any] struct {
+	shards     []*mightyMapSwissStorage[K, V]
+	order      *orderIndex[K]
+	mask       uint64
+	seed       maphash.Seed
+	nextCursor atomic.Uint64
+}
+
+// newSwissShardedStorage creates the shards, each with an equal part of the capacity and, with
+// FIFO ordering, the shared order index.
+func newSwissShardedStorage[K comparable, V any](opts *swissOpts) *mightyMapSwissShardedStorage[K, V] {
+	n := shardCount(opts.shards)
+	shardOpts := *opts
+	shardOpts.defaultCapacity = max(1, opts.defaultCapacity/uint32(n))
+	shardOpts.ordering = Unordered
+	c := &mightyMapSwissShardedStorage[K, V]{
+		shards: make([]*mightyMapSwissStorage[K, V], n),
+		order:  newSharedOrderIndex[K](opts.ordering),
+		mask:   uint64(n - 1),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range c.shards {
+		c.shards[i] = newSwissStorage[K, V](&shardOpts)
+		c.shards[i].order = c.order
+	}
+	return c
+}
+
+// shard returns the shard holding key.
+func (c *mightyMapSwissShardedStorage[K, V]) shard(key K) *mightyMapSwissStorage[K, V] {
+	return c.shards[hashKey(c.seed, key)&c.mask]
+}
+
+func (c *mightyMapSwissShardedStorage[K, V]) Load(ctx context.Context, key K) (value V, ok bool) {
+	return c.shard(key).Load(ctx, key)
+}
+
+func (c *mightyMapSwissShardedStorage[K, V]) Store(ctx context.Context, key K, value V) {
+	c.shard(key).Store(ctx, key, value)
+}
+
+// Delete removes one or more keys, locking the shard of each key in turn.
+func (c *mightyMapSwissShardedStorage[K, V]) Delete(ctx context.Context, keys ...K) {
+	for _, key := range keys {
+		c.shard(key).Delete(ctx, key)
+	}
+}
+
+// Range copies the keys of all shards first and looks each up when its turn comes. With
+// WithSwissSnapshotRange disabled and without FIFO ordering it visits the shards one after
+// another, each under its read lock, so f must not write keys of the shard being visited.
+// If f returns false, iteration stops early.
+func (c *mightyMapSwissShardedStorage[K, V]) Range(ctx context.Context, f func(key K, value V) bool) {
+	if c.shards[0].snapshotRange || c.order != nil {
+		for _, k := range c.Keys(ctx) {
+			if v, ok := c.shard(k).peek(k); ok && !f(k, v) {
+				return
+			}
+		}
+		return
+	}
+	stopped := false
+	for _, s := range c.shards {
+		s.Range(ctx, func(k K, v V) bool {
+			stopped = !f(k, v)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+// Keys returns the keys shard by shard, or in insertion order with FIFO ordering, holding the
+// read locks of all shards at once so the order index matches their entries.
+func (c *mightyMapSwissShardedStorage[K, V]) Keys(ctx context.Context) []K {
+	if c.order != nil {
+		return c.keysOrdered()
+	}
+	keys := []K{}
+	for _, s := range c.shards {
+		keys = append(keys, s.Keys(ctx)...)
+	}
+	return keys
+}
+
+// keysOrdered is Keys for FIFO ordering.
+func (c *mightyMapSwissShardedStorage[K, V]) keysOrdered() []K {
+	for _, s := range c.shards {
+		s.mutex.RLock()
+	}
+	defer func() {
+		for _, s := range c.shards {
+			s.mutex.RUnlock()
+		}
+	}()
+	keys := []K{}
+	now := c.shards[0].clock()
+	c.order.each(func(k K) bool {
+		if c.shard(k).visible(k, now) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return keys
+}
+
+// Next removes and returns an entry, starting at a different shard for each call so concurrent
+// callers rarely contend. With FIFO ordering it removes the oldest entry: the oldest key is
+// taken from the order index and then removed under the lock of its shard, which fails if a
+// concurrent call removed it first, in which case the next oldest key is tried.
+func (c *mightyMapSwissShardedStorage[K, V]) Next(_ context.Context) (key K, value V, ok bool) {
+	if c.order != nil {
+		for {
+			k, found := c.order.front()
+			if !found {
+				return key, value, false
+			}
+			if value, ok = c.shard(k).take(k); ok {
+				return k, value, true
+			}
+		}
+	}
+	start := c.nextCursor.Add(1)
+	for i := range uint64(len(c.shards)) {
+		if key, value, ok = c.shards[(start+i)&c.mask].takeNext(); ok {
+			return key, value, true
+		}
+	}
+	return key, value, false
+}
+
+// Len counts the entries holding the read locks of all shards at once.
+func (c *mightyMapSwissShardedStorage[K, V]) Len(_ context.Context) int {
+	for _, s := range c.shards {
+		s.mutex.RLock()
+	}
+	count := 0
+	for _, s := range c.shards {
+		count += s.lenLocked()
+		s.mutex.RUnlock()
+	}
+	return count
+}
+
+// Clear replaces the tables of all shards, holding all their write locks at once.
+// Debug builds check all shards for Range callbacks of the caller before locking any.
+func (c *mightyMapSwissShardedStorage[K, V]) Clear(_ context.Context) {
+	for _, s := range c.shards {
+		s.ranging.check()
+	}
+	for _, s := range c.shards {
+		s.mutex.Lock()
+	}
+	for _, s := range c.shards {
+		s.clearLocked()
+		s.mutex.Unlock()
+	}
+}
+
+// Touch restarts the expiration of the given keys without reading their values.
+func (c *mightyMapSwissShardedStorage[K, V]) Touch(ctx context.Context, keys ...K) error {
+	for _, key := range keys {
+		if err := c.shard(key).Touch(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact rebuilds the table of every shard to fit its entries, one shard at a time.
+func (c *mightyMapSwissShardedStorage[K, V]) Compact(ctx context.Context) error {
+	for _, s := range c.shards {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.Compact(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *mightyMapSwissShardedStorage[K, V]) Close(_ context.Context) error {
+	// nothing to do
+	return nil
+}
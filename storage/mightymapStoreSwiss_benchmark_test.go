@@ -36,3 +36,15 @@ func BenchmarkSwissStorageDelete(b *testing.B) {
 		store.Delete(ctx, i%1000000)
 	}
 }
+
+func BenchmarkSwissStorageLoadEncoded(b *testing.B) {
+	store := storage.NewMightyMapSwissStorage[int, string](storage.WithSwissEncoding(true))
+	// Pre-populate the store
+	for i := 0; i < 1000000; i++ {
+		store.Store(ctx, i, "value")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = store.Load(ctx, i%1000000)
+	}
+}
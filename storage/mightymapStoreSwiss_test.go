@@ -2,7 +2,9 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestMightyMapSwissStorage(t *testing.T) {
@@ -211,3 +213,154 @@ func TestMightyMapSwissStorageEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestMightyMapSwissStorageEncoding(t *testing.T) {
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		opts   []OptionFuncSwiss
+		shared bool
+	}{
+		"Typed":   {shared: true},
+		"Encoded": {opts: []OptionFuncSwiss{WithSwissEncoding(true)}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := NewMightyMapSwissStorage[string, []int](tc.opts...)
+			store.Store(ctx, "key", []int{1, 2})
+			loaded, _ := store.Load(ctx, "key")
+			loaded[0] = 100
+
+			again, _ := store.Load(ctx, "key")
+			if shared := again[0] == 100; shared != tc.shared {
+				t.Errorf("modifying a loaded value changed the stored one: %v; want %v", shared, tc.shared)
+			}
+		})
+	}
+}
+
+func TestMightyMapSwissStorageShards(t *testing.T) {
+	ctx := context.Background()
+
+	for name, opts := range map[string][]OptionFuncSwiss{
+		"Typed":   {WithSwissShards(3)},
+		"Encoded": {WithSwissShards(3), WithSwissEncoding(true)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := NewMightyMapSwissStorage[int, string](opts...)
+			defer store.Close(ctx)
+
+			for i := 0; i < 100; i++ {
+				store.Store(ctx, i, "value")
+			}
+			store.Delete(ctx, 5, 6)
+			if n := store.Len(ctx); n != 98 {
+				t.Errorf("Len() = %d; want 98", n)
+			}
+			if n := len(store.Keys(ctx)); n != 98 {
+				t.Errorf("Keys() returned %d keys; want 98", n)
+			}
+			visited := 0
+			store.Range(ctx, func(int, string) bool {
+				visited++
+				return visited < 10
+			})
+			if visited != 10 {
+				t.Errorf("Range() visited %d entries after stopping at 10", visited)
+			}
+			if _, _, ok := store.Next(ctx); !ok || store.Len(ctx) != 97 {
+				t.Errorf("Next() = %v leaving %d entries; want true and 97", ok, store.Len(ctx))
+			}
+			if err := store.(IMightyMapCompactStorage).Compact(ctx); err != nil {
+				t.Errorf("Compact() error: %v", err)
+			}
+			// the encoded storage satisfies the interfaces through the msgpack adapter
+			if p, ok := store.(IMightyMapPriorityStorage[int, string]); ok {
+				if err := p.StoreWithPriority(ctx, 1, "value", 1); !errors.Is(err, ErrNotSupported) {
+					t.Errorf("StoreWithPriority() error = %v; want ErrNotSupported", err)
+				}
+			}
+			if s, ok := store.(IMightyMapScheduleStorage[int, string]); ok {
+				if err := s.StoreAt(ctx, 1, "value", time.Now()); !errors.Is(err, ErrNotSupported) {
+					t.Errorf("StoreAt() error = %v; want ErrNotSupported", err)
+				}
+			}
+			store.Clear(ctx)
+			if n := store.Len(ctx); n != 0 {
+				t.Errorf("Len() after Clear() = %d; want 0", n)
+			}
+		})
+	}
+
+	t.Run("FIFO", func(t *testing.T) {
+		store := NewMightyMapSwissStorage[int, string](WithSwissShards(4), WithSwissOrdering(FIFO))
+		defer store.Close(ctx)
+
+		for i := 0; i < 20; i++ {
+			store.Store(ctx, i, "value")
+		}
+		store.Delete(ctx, 0)
+		store.Store(ctx, 0, "again")
+		keys := store.Keys(ctx)
+		if len(keys) != 20 || keys[0] != 1 || keys[19] != 0 {
+			t.Errorf("Keys() = %v; want 1..19 followed by 0", keys)
+		}
+		for want := 1; want < 20; want++ {
+			if key, _, ok := store.Next(ctx); !ok || key != want {
+				t.Fatalf("Next() = %d, %v; want %d, true", key, ok, want)
+			}
+		}
+		if key, value, ok := store.Next(ctx); !ok || key != 0 || value != "again" {
+			t.Errorf("Next() = %d, %q, %v; want 0, \"again\", true", key, value, ok)
+		}
+		if _, _, ok := store.Next(ctx); ok {
+			t.Error("Next() on an empty storage returned an entry")
+		}
+	})
+}
+
+func TestMightyMapSwissStorageShrink(t *testing.T) {
+	ctx := context.Background()
+	capacity := func(store IMightyMapStorage[int, int]) int {
+		return store.(*mightyMapSwissStorage[int, int]).tableSize()
+	}
+	fill := func(store IMightyMapStorage[int, int]) {
+		for i := 0; i < 10000; i++ {
+			store.Store(ctx, i, i)
+		}
+	}
+
+	store := NewMightyMapSwissStorage[int, int](WithDefaultCapacity(16), WithSwissShrinkRatio(0.25))
+	base := capacity(store)
+	fill(store)
+	grown := capacity(store)
+	for i := 10; i < 10000; i++ {
+		store.Delete(ctx, i)
+	}
+	if c := capacity(store); c >= grown/4 {
+		t.Errorf("capacity after deleting most entries = %d; want well below %d", c, grown)
+	}
+	for i := 0; i < 10; i++ {
+		if v, ok := store.Load(ctx, i); !ok || v != i {
+			t.Errorf("Load(%d) after shrinking = %v, %v; want %d, true", i, v, ok, i)
+		}
+	}
+
+	// without a shrink ratio Clear and Compact still release the memory
+	store = NewMightyMapSwissStorage[int, int](WithDefaultCapacity(16))
+	fill(store)
+	store.Clear(ctx)
+	if c := capacity(store); c != base {
+		t.Errorf("capacity after Clear() = %d; want %d", c, base)
+	}
+	fill(store)
+	store.Delete(ctx, store.Keys(ctx)[5:]...)
+	if c := capacity(store); c < grown/2 {
+		t.Errorf("capacity after Delete() without a shrink ratio = %d; want about %d", c, grown)
+	}
+	if err := store.(IMightyMapCompactStorage).Compact(ctx); err != nil {
+		t.Fatalf("Compact() error: %v", err)
+	}
+	if c := capacity(store); c != base || store.Len(ctx) != 5 {
+		t.Errorf("capacity after Compact() = %d with %d entries; want %d with 5", c, store.Len(ctx), base)
+	}
+}
@@ -440,14 +440,13 @@ func TestMightyMapDirectStorageRangeEarlyTermination(t *testing.T) {
 	}
 }
 
-// Test Next with zero value key detection
+// Test Next with zero value keys
 func TestMightyMapDirectStorageNextZeroValue(t *testing.T) {
 	store := NewMightyMapDefaultStorage[int, string]()
 	defer store.Close(context.Background())
 
 	ctx := context.Background()
 
-	// Test with non-zero value key first (since zero value detection has limitations)
 	store.Store(ctx, 1, "non-zero value")
 	key, value, ok := store.Next(ctx)
 	if !ok {
@@ -460,14 +459,13 @@ func TestMightyMapDirectStorageNextZeroValue(t *testing.T) {
 		t.Errorf("Next() value = %v; want 'non-zero value'", value)
 	}
 
-	// Test with zero value key - this is a known limitation of the current implementation
-	// The Next() function uses *new(K) to detect zero values, which doesn't work when
-	// the actual key is the zero value
 	store.Store(ctx, 0, "zero value")
-	_, _, ok = store.Next(ctx)
-	// This test documents the current behavior - zero value keys are not handled correctly by Next()
-	if ok {
-		t.Log("Note: Next() with zero-value keys has known limitations in the current implementation")
+	key, value, ok = store.Next(ctx)
+	if !ok || key != 0 || value != "zero value" {
+		t.Errorf("Next() = %v, %q, %v; want 0, 'zero value', true", key, value, ok)
+	}
+	if n := store.Len(ctx); n != 0 {
+		t.Errorf("Len() after Next() = %d; want 0", n)
 	}
 }
 
@@ -2,9 +2,12 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/vmihailenco/msgpack/v5"
 )
@@ -15,16 +18,64 @@ var (
 	typeRegistryLock sync.RWMutex
 )
 
-// The msgpackAdapter adapts any byteStorage implementation to implement IMightyMapStorage interface
+// The msgpackAdapter adapts any byteStorage implementation to implement IMightyMapStorage interface.
+// Values are MessagePack encoded unless the storage asks for another valueCodec.
 type msgpackAdapter[K comparable, V any] struct {
 	storage byteStorage[K]
+	codec   valueCodec[V]
 }
 
 // newMsgpackAdapter creates a new adapter that uses MessagePack encoding to convert between V and []byte
 func newMsgpackAdapter[K comparable, V any](storage byteStorage[K]) *msgpackAdapter[K, V] {
+	return newAdapterWithCodec[K, V](storage, msgpackCodec[V]{})
+}
+
+// newAdapterWithCodec creates a new adapter that uses codec to convert between V and []byte
+func newAdapterWithCodec[K comparable, V any](storage byteStorage[K], codec valueCodec[V]) *msgpackAdapter[K, V] {
 	return &msgpackAdapter[K, V]{
 		storage: storage,
+		codec:   codec,
+	}
+}
+
+// valueCodec converts values to and from the bytes kept by a byteStorage
+type valueCodec[V any] interface {
+	encode(value V) ([]byte, error)
+	decode(data []byte) (V, error)
+}
+
+// msgpackCodec is the default codec, see msgpackEncodeValue
+type msgpackCodec[V any] struct{}
+
+func (msgpackCodec[V]) encode(value V) ([]byte, error) {
+	return msgpackEncodeValue(value)
+}
+
+func (msgpackCodec[V]) decode(data []byte) (V, error) {
+	return msgpackDecodeValue[V](data)
+}
+
+// jsonCodec stores values as plain JSON documents, without the type wrapper of msgpackCodec,
+// so the backend can look into them, e.g. with SQLite's JSON functions
+type jsonCodec[V any] struct{}
+
+func (jsonCodec[V]) encode(value V) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json encode value: %w", err)
+	}
+	return encoded, nil
+}
+
+func (jsonCodec[V]) decode(data []byte) (V, error) {
+	var value V
+	if len(data) == 0 {
+		return value, nil
 	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("failed to json decode value: %w", err)
+	}
+	return value, nil
 }
 
 // msgpackEncodeValue encodes a value to a byte slice using MessagePack encoding
@@ -184,7 +235,7 @@ func (m *msgpackAdapter[K, V]) Load(ctx context.Context, key K) (value V, ok boo
 		return zeroV, false
 	}
 
-	decoded, err := msgpackDecodeValue[V](data)
+	decoded, err := m.codec.decode(data)
 	if err != nil {
 		// If we can't decode, it's as if the key isn't there
 		return zeroV, false
@@ -195,7 +246,7 @@ func (m *msgpackAdapter[K, V]) Load(ctx context.Context, key K) (value V, ok boo
 
 // Store serializes and stores a value in the storage
 func (m *msgpackAdapter[K, V]) Store(ctx context.Context, key K, value V) {
-	encoded, err := msgpackEncodeValue(value)
+	encoded, err := m.codec.encode(value)
 	if err != nil {
 		// If we can't encode, we don't store anything
 		return
@@ -212,7 +263,7 @@ func (m *msgpackAdapter[K, V]) Delete(ctx context.Context, keys ...K) {
 // Range iterates over all key-value pairs in the storage
 func (m *msgpackAdapter[K, V]) Range(ctx context.Context, f func(key K, value V) bool) {
 	m.storage.Range(ctx, func(key K, data []byte) bool {
-		decoded, err := msgpackDecodeValue[V](data)
+		decoded, err := m.codec.decode(data)
 		if err != nil {
 			// Skip entries that can't be decoded
 			return true
@@ -235,7 +286,7 @@ func (m *msgpackAdapter[K, V]) Next(ctx context.Context) (key K, value V, ok boo
 		return k, zeroV, false
 	}
 
-	decoded, err := msgpackDecodeValue[V](data)
+	decoded, err := m.codec.decode(data)
 	if err != nil {
 		// If we can't decode, it's as if there are no more items
 		return k, zeroV, false
@@ -244,6 +295,86 @@ func (m *msgpackAdapter[K, V]) Next(ctx context.Context) (key K, value V, ok boo
 	return k, decoded, true
 }
 
+// Supports reports whether the underlying storage supports c; the adapter itself satisfies every
+// capability interface.
+func (m *msgpackAdapter[K, V]) Supports(c Capability) bool {
+	return supports[K, []byte](m.storage, c)
+}
+
+// NextWait waits for and decodes the next entry if the underlying storage supports it.
+// Entries that can't be decoded are dropped, as by Next, and the wait continues.
+func (m *msgpackAdapter[K, V]) NextWait(ctx context.Context) (key K, value V, err error) {
+	w, ok := m.storage.(IMightyMapNextWaitStorage[K, []byte])
+	if !ok {
+		return key, value, ErrNotSupported
+	}
+	for {
+		k, data, err := w.NextWait(ctx)
+		if err != nil {
+			return k, value, err
+		}
+		decoded, err := m.codec.decode(data)
+		if err != nil {
+			continue
+		}
+		return k, decoded, nil
+	}
+}
+
+// StoreAt encodes and schedules a value if the underlying storage supports it.
+func (m *msgpackAdapter[K, V]) StoreAt(ctx context.Context, key K, value V, visibleAt time.Time) error {
+	s, ok := m.storage.(IMightyMapScheduleStorage[K, []byte])
+	if !ok {
+		return ErrNotSupported
+	}
+	encoded, err := m.codec.encode(value)
+	if err != nil {
+		return err
+	}
+	return s.StoreAt(ctx, key, encoded, visibleAt)
+}
+
+// NextDue returns the next due scheduled entry if the underlying storage supports scheduling.
+// Entries that can't be decoded are dropped, as by Next.
+func (m *msgpackAdapter[K, V]) NextDue(ctx context.Context) (key K, value V, ok bool) {
+	s, supported := m.storage.(IMightyMapScheduleStorage[K, []byte])
+	if !supported {
+		return key, value, false
+	}
+	for {
+		k, data, ok := s.NextDue(ctx)
+		if !ok {
+			return k, value, false
+		}
+		if decoded, err := m.codec.decode(data); err == nil {
+			return k, decoded, true
+		}
+	}
+}
+
+// StoreWithPriority encodes and stores a value with a priority if the underlying storage
+// supports priorities.
+func (m *msgpackAdapter[K, V]) StoreWithPriority(ctx context.Context, key K, value V, priority int) error {
+	s, ok := m.storage.(IMightyMapPriorityStorage[K, []byte])
+	if !ok {
+		return ErrNotSupported
+	}
+	encoded, err := m.codec.encode(value)
+	if err != nil {
+		return err
+	}
+	return s.StoreWithPriority(ctx, key, encoded, priority)
+}
+
+// SetPriority changes the priority of an entry if the underlying storage supports priorities.
+func (m *msgpackAdapter[K, V]) SetPriority(ctx context.Context, key K, priority int) (bool, error) {
+	s, ok := m.storage.(IMightyMapPriorityStorage[K, []byte])
+	if !ok {
+		return false, ErrNotSupported
+	}
+	return s.SetPriority(ctx, key, priority)
+}
+
 // Len returns the number of items in the storage
 func (m *msgpackAdapter[K, V]) Len(ctx context.Context) int {
 	return m.storage.Len(ctx)
@@ -254,6 +385,264 @@ func (m *msgpackAdapter[K, V]) Clear(ctx context.Context) {
 	m.storage.Clear(ctx)
 }
 
+// Touch extends the expiration of the given keys if the underlying storage supports it
+func (m *msgpackAdapter[K, V]) Touch(ctx context.Context, keys ...K) error {
+	if t, ok := m.storage.(IMightyMapTouchStorage[K]); ok {
+		return t.Touch(ctx, keys...)
+	}
+	return ErrNotSupported
+}
+
+// ParallelRange decodes and visits all key-value pairs concurrently if the underlying storage supports it.
+// Values are decoded on the worker goroutines; entries that can't be decoded are skipped.
+func (m *msgpackAdapter[K, V]) ParallelRange(ctx context.Context, workers int, f func(key K, value V) bool) error {
+	p, ok := m.storage.(IMightyMapParallelRangeStorage[K, []byte])
+	if !ok {
+		return ErrNotSupported
+	}
+	return p.ParallelRange(ctx, workers, func(key K, data []byte) bool {
+		decoded, err := m.codec.decode(data)
+		if err != nil {
+			return true
+		}
+		return f(key, decoded)
+	})
+}
+
+// Backup writes a backup of the underlying storage if it supports it
+func (m *msgpackAdapter[K, V]) Backup(ctx context.Context, w io.Writer, since uint64) (uint64, error) {
+	if b, ok := m.storage.(IMightyMapBackupStorage); ok {
+		return b.Backup(ctx, w, since)
+	}
+	return 0, ErrNotSupported
+}
+
+// Restore loads a backup into the underlying storage if it supports it
+func (m *msgpackAdapter[K, V]) Restore(ctx context.Context, r io.Reader) error {
+	if b, ok := m.storage.(IMightyMapBackupStorage); ok {
+		return b.Restore(ctx, r)
+	}
+	return ErrNotSupported
+}
+
+// Compact reclaims disk space of the underlying storage if it supports it
+func (m *msgpackAdapter[K, V]) Compact(ctx context.Context) error {
+	if c, ok := m.storage.(IMightyMapCompactStorage); ok {
+		return c.Compact(ctx)
+	}
+	return ErrNotSupported
+}
+
+// Size reports the disk usage of the underlying storage if it supports it
+func (m *msgpackAdapter[K, V]) Size(ctx context.Context) (index, values int64, err error) {
+	if s, ok := m.storage.(IMightyMapSizeStorage); ok {
+		return s.Size(ctx)
+	}
+	return 0, 0, ErrNotSupported
+}
+
+// MemoryUsage reports the memory usage of the underlying storage if it supports it
+func (m *msgpackAdapter[K, V]) MemoryUsage(ctx context.Context) (MemoryUsage, error) {
+	if s, ok := m.storage.(IMightyMapMemoryStorage); ok {
+		return s.MemoryUsage(ctx)
+	}
+	return MemoryUsage{}, ErrNotSupported
+}
+
+// BackupFile writes a backup file of the underlying storage if it supports it
+func (m *msgpackAdapter[K, V]) BackupFile(ctx context.Context, destPath string) error {
+	if mt, ok := m.storage.(IMightyMapMaintenanceStorage); ok {
+		return mt.BackupFile(ctx, destPath)
+	}
+	return ErrNotSupported
+}
+
+// Vacuum reclaims disk space of the underlying storage if it supports it
+func (m *msgpackAdapter[K, V]) Vacuum(ctx context.Context) error {
+	if mt, ok := m.storage.(IMightyMapMaintenanceStorage); ok {
+		return mt.Vacuum(ctx)
+	}
+	return ErrNotSupported
+}
+
+// Checkpoint checkpoints the write-ahead log of the underlying storage if it supports it
+func (m *msgpackAdapter[K, V]) Checkpoint(ctx context.Context, mode CheckpointMode) error {
+	if mt, ok := m.storage.(IMightyMapMaintenanceStorage); ok {
+		return mt.Checkpoint(ctx, mode)
+	}
+	return ErrNotSupported
+}
+
+// LoadVersions decodes the version history of key if the underlying storage keeps one.
+// Versions that can't be decoded are skipped.
+func (m *msgpackAdapter[K, V]) LoadVersions(ctx context.Context, key K, limit int) ([]Versioned[V], error) {
+	vs, ok := m.storage.(IMightyMapVersionedStorage[K, []byte])
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	raw, err := vs.LoadVersions(ctx, key, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]Versioned[V], 0, len(raw))
+	for _, r := range raw {
+		v := Versioned[V]{Version: r.Version, Timestamp: r.Timestamp, Deleted: r.Deleted}
+		if !r.Deleted {
+			if v.Value, err = m.codec.decode(r.Value); err != nil {
+				continue
+			}
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// LoadAt decodes the value key had at version if the underlying storage keeps a history
+func (m *msgpackAdapter[K, V]) LoadAt(ctx context.Context, key K, version uint64) (value V, ok bool, err error) {
+	vs, supported := m.storage.(IMightyMapVersionedStorage[K, []byte])
+	if !supported {
+		return value, false, ErrNotSupported
+	}
+	data, ok, err := vs.LoadAt(ctx, key, version)
+	if err != nil || !ok {
+		return value, false, err
+	}
+	value, err = m.codec.decode(data)
+	if err != nil {
+		// as for Load, an undecodable value is treated as missing
+		return value, false, nil
+	}
+	return value, true, nil
+}
+
+// CurrentVersion returns the current version of the underlying storage if it keeps a history
+func (m *msgpackAdapter[K, V]) CurrentVersion(ctx context.Context) (uint64, error) {
+	if vs, ok := m.storage.(IMightyMapVersionedStorage[K, []byte]); ok {
+		return vs.CurrentVersion(ctx)
+	}
+	return 0, ErrNotSupported
+}
+
+// SnapshotAt returns a decoding read-only view of the underlying storage at version
+func (m *msgpackAdapter[K, V]) SnapshotAt(ctx context.Context, version uint64) (IMightyMapSnapshot[K, V], error) {
+	vs, ok := m.storage.(IMightyMapVersionedStorage[K, []byte])
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	snapshot, err := vs.SnapshotAt(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return &msgpackSnapshot[K, V]{snapshot: snapshot, codec: m.codec}, nil
+}
+
+// msgpackSnapshot decodes the values of a byte-level snapshot
+type msgpackSnapshot[K comparable, V any] struct {
+	snapshot IMightyMapSnapshot[K, []byte]
+	codec    valueCodec[V]
+}
+
+func (s *msgpackSnapshot[K, V]) Version() uint64 {
+	return s.snapshot.Version()
+}
+
+func (s *msgpackSnapshot[K, V]) Load(ctx context.Context, key K) (value V, ok bool) {
+	data, ok := s.snapshot.Load(ctx, key)
+	if !ok {
+		return value, false
+	}
+	decoded, err := s.codec.decode(data)
+	if err != nil {
+		return value, false
+	}
+	return decoded, true
+}
+
+func (s *msgpackSnapshot[K, V]) Range(ctx context.Context, f func(key K, value V) bool) {
+	s.snapshot.Range(ctx, func(key K, data []byte) bool {
+		decoded, err := s.codec.decode(data)
+		if err != nil {
+			return true
+		}
+		return f(key, decoded)
+	})
+}
+
+func (s *msgpackSnapshot[K, V]) Keys(ctx context.Context) []K {
+	return s.snapshot.Keys(ctx)
+}
+
+func (s *msgpackSnapshot[K, V]) Len(ctx context.Context) int {
+	return s.snapshot.Len(ctx)
+}
+
+// Query runs a native query of the underlying storage if it supports it and decodes the values.
+// Entries that can't be decoded are skipped.
+func (m *msgpackAdapter[K, V]) Query(ctx context.Context, where string, args ...any) ([]Entry[K, V], error) {
+	q, ok := m.storage.(IMightyMapQueryStorage[K, []byte])
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	raw, err := q.Query(ctx, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry[K, V], 0, len(raw))
+	for _, r := range raw {
+		decoded, err := m.codec.decode(r.Value)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry[K, V]{Key: r.Key, Value: decoded})
+	}
+	return entries, nil
+}
+
+// BulkLoader starts an encoding bulk load if the underlying storage supports it
+func (m *msgpackAdapter[K, V]) BulkLoader(ctx context.Context) (IMightyMapBulkLoader[K, V], error) {
+	b, ok := m.storage.(IMightyMapBulkLoadStorage[K, []byte])
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	loader, err := b.BulkLoader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &msgpackBulkLoader[K, V]{loader: loader, codec: m.codec}, nil
+}
+
+// msgpackBulkLoader encodes the values of a byte-level bulk loader
+type msgpackBulkLoader[K comparable, V any] struct {
+	loader IMightyMapBulkLoader[K, []byte]
+	codec  valueCodec[V]
+}
+
+func (l *msgpackBulkLoader[K, V]) Add(key K, value V) error {
+	encoded, err := l.codec.encode(value)
+	if err != nil {
+		return err
+	}
+	return l.loader.Add(key, encoded)
+}
+
+func (l *msgpackBulkLoader[K, V]) Finish() error {
+	return l.loader.Finish()
+}
+
+func (l *msgpackBulkLoader[K, V]) Cancel() {
+	l.loader.Cancel()
+}
+
+// Stats returns the cache counters if the underlying storage keeps them
+func (m *msgpackAdapter[K, V]) Stats(ctx context.Context) (CacheStats, error) {
+	if s, ok := m.storage.(IMightyMapStatsStorage); ok {
+		return s.Stats(ctx)
+	}
+	return CacheStats{}, ErrNotSupported
+}
+
 // Close closes the storage
 func (m *msgpackAdapter[K, V]) Close(ctx context.Context) error {
 	return m.storage.Close(ctx)
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"testing"
 )
 
@@ -10,3 +11,41 @@ func TestMsgpackDecodeValue_Error(t *testing.T) {
 		t.Error("Expected error when decoding invalid msgpack data, got nil")
 	}
 }
+
+func TestMsgpackAdapterSupports(t *testing.T) {
+	ctx := context.Background()
+	arena := NewMightyMapArenaStorage[int, string]()
+	sharded := NewMightyMapSwissStorage[int, string](WithSwissShards(2), WithSwissEncoding(true))
+	defer arena.Close(ctx)
+	defer sharded.Close(ctx)
+
+	for _, tc := range []struct {
+		name  string
+		store IMightyMapStorage[int, string]
+		c     Capability
+		want  bool
+	}{
+		{"arena memory usage", arena, CapabilityMemoryUsage, true},
+		{"arena compact", arena, CapabilityCompact, true},
+		{"arena priority", arena, CapabilityPriority, false},
+		{"arena versions", arena, CapabilityVersions, false},
+		{"sharded touch", sharded, CapabilityTouch, true},
+		{"sharded schedule", sharded, CapabilitySchedule, false},
+		{"sharded query", sharded, CapabilityQuery, false},
+	} {
+		if _, ok := tc.store.(IMightyMapPriorityStorage[int, string]); !ok {
+			t.Fatalf("%s: adapter does not satisfy IMightyMapPriorityStorage", tc.name)
+		}
+		if got := Supports(tc.store, tc.c); got != tc.want {
+			t.Errorf("%s: Supports() = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParallelRangeNotSupported(t *testing.T) {
+	store := newMsgpackAdapter[int, int](newMockByteStorage[int]())
+	err := store.ParallelRange(context.Background(), 4, func(int, int) bool { return true })
+	if err != ErrNotSupported {
+		t.Errorf("ParallelRange() error = %v; want ErrNotSupported", err)
+	}
+}